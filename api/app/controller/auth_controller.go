@@ -4,12 +4,32 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthController struct{}
 
+// 管理员账号，部分高风险操作（如安装未校验的服务端）只允许管理员执行
+var adminUsers = map[string]bool{
+	"admin": true,
+}
+
+// 登录会话有效期
+const sessionTTL = 7 * 24 * time.Hour
+
+// authSession 已登录的会话
+type authSession struct {
+	username  string
+	expiresAt time.Time
+}
+
+// sessions 已签发的 token（进程重启后需要重新登录）
+var sessions sync.Map
+
 func NewAuthController() *AuthController {
 	return &AuthController{}
 }
@@ -62,6 +82,7 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 	// 生成token（简单的随机token，生产环境应该使用JWT）
 	token := generateToken()
+	sessions.Store(token, authSession{username: req.Username, expiresAt: time.Now().Add(sessionTTL)})
 
 	// 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
@@ -80,3 +101,27 @@ func generateToken() string {
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
+
+// currentUser 根据请求头中的 Bearer token 获取当前用户
+func currentUser(c *gin.Context) (string, bool) {
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if token == "" {
+		return "", false
+	}
+	value, ok := sessions.Load(token)
+	if !ok {
+		return "", false
+	}
+	session := value.(authSession)
+	if time.Now().After(session.expiresAt) {
+		sessions.Delete(token)
+		return "", false
+	}
+	return session.username, true
+}
+
+// isAdmin 当前请求是否来自管理员
+func isAdmin(c *gin.Context) bool {
+	username, ok := currentUser(c)
+	return ok && adminUsers[username]
+}
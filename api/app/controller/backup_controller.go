@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"strconv"
+	"terraria-api/app/model"
+	"terraria-api/app/service"
+	"terraria-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupController 房间备份控制器
+type BackupController struct {
+	backupService *service.BackupService
+}
+
+// NewBackupController 创建备份控制器
+func NewBackupController() *BackupController {
+	return &BackupController{
+		backupService: service.NewBackupService(),
+	}
+}
+
+// GetBackups 获取房间的备份列表
+func (bc *BackupController) GetBackups(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	backups, err := bc.backupService.ListBackups(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取备份列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, backups)
+}
+
+// CreateBackup 立即备份房间（运行中的房间会先保存世界）
+func (bc *BackupController) CreateBackup(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ResponseError(c, "参数错误: "+err.Error())
+			return
+		}
+	}
+
+	backup, err := bc.backupService.CreateBackup(uint(roomId), model.BackupTriggerManual, req.Note)
+	if err != nil {
+		utils.ResponseError(c, "创建备份失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, backup)
+}
+
+// DownloadBackup 下载备份归档
+func (bc *BackupController) DownloadBackup(c *gin.Context) {
+	backup, ok := bc.getBackup(c)
+	if !ok {
+		return
+	}
+
+	archivePath, cleanup, err := bc.backupService.OpenArchive(backup)
+	if err != nil {
+		utils.ResponseError(c, "下载备份失败: "+err.Error())
+		return
+	}
+	defer cleanup()
+
+	c.FileAttachment(archivePath, service.BackupArchiveName(backup))
+}
+
+// DeleteBackup 删除备份
+func (bc *BackupController) DeleteBackup(c *gin.Context) {
+	backup, ok := bc.getBackup(c)
+	if !ok {
+		return
+	}
+
+	if err := bc.backupService.DeleteBackup(backup.RoomID, backup.ID); err != nil {
+		utils.ResponseError(c, "删除备份失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "备份删除成功"})
+}
+
+// RestoreBackup 将备份恢复到房间（scope: world / config / all）
+func (bc *BackupController) RestoreBackup(c *gin.Context) {
+	backup, ok := bc.getBackup(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Scope string `json:"scope"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ResponseError(c, "参数错误: "+err.Error())
+			return
+		}
+	}
+
+	result, err := bc.backupService.Restore(backup.RoomID, backup.ID, req.Scope)
+	if err != nil {
+		utils.ResponseError(c, "恢复备份失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
+
+// CloneBackup 从备份创建新房间
+func (bc *BackupController) CloneBackup(c *gin.Context) {
+	backup, ok := bc.getBackup(c)
+	if !ok {
+		return
+	}
+
+	var req service.CloneBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	result, err := bc.backupService.Clone(backup.RoomID, backup.ID, req)
+	if err != nil {
+		utils.ResponseError(c, "从备份创建房间失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
+
+// UploadBackupCopy 把备份上传到指定的备份存储（重试失败的上传或补传到新添加的存储）
+func (bc *BackupController) UploadBackupCopy(c *gin.Context) {
+	backup, ok := bc.getBackup(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TargetID uint `json:"targetId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	backupCopy, err := bc.backupService.UploadCopy(backup.RoomID, backup.ID, req.TargetID)
+	if err != nil {
+		utils.ResponseError(c, "上传备份失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, backupCopy)
+}
+
+// VerifyBackups 检查房间备份的块和索引是否完整
+func (bc *BackupController) VerifyBackups(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	result, err := bc.backupService.VerifyBackups(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "检查备份失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
+
+// GetUsage 获取房间备份的原始大小和实际占用空间
+func (bc *BackupController) GetUsage(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	usage, err := bc.backupService.GetUsage(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取备份空间占用失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, usage)
+}
+
+// GetAllUsage 获取所有房间备份的空间占用
+func (bc *BackupController) GetAllUsage(c *gin.Context) {
+	usages, err := bc.backupService.ListUsage()
+	if err != nil {
+		utils.ResponseError(c, "获取备份空间占用失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, usages)
+}
+
+// GetSchedule 获取定时备份设置
+func (bc *BackupController) GetSchedule(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	schedule, err := bc.backupService.GetSchedule(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取定时备份设置失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, schedule)
+}
+
+// UpdateSchedule 保存定时备份设置
+func (bc *BackupController) UpdateSchedule(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req service.BackupScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	schedule, err := bc.backupService.UpdateSchedule(uint(roomId), req)
+	if err != nil {
+		utils.ResponseError(c, "保存定时备份设置失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, schedule)
+}
+
+// getBackup 解析路径中的房间ID和备份ID并获取备份，失败时已写入响应
+func (bc *BackupController) getBackup(c *gin.Context) (*model.Backup, bool) {
+	roomId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return nil, false
+	}
+	backupId, err := strconv.ParseUint(c.Param("backupId"), 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的备份ID")
+		return nil, false
+	}
+
+	backup, err := bc.backupService.GetBackup(uint(roomId), uint(backupId))
+	if err != nil {
+		utils.ResponseError(c, err.Error())
+		return nil, false
+	}
+	return backup, true
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"strconv"
+	"terraria-api/app/service"
+	"terraria-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupTargetController 备份存储控制器
+type BackupTargetController struct {
+	backupService *service.BackupService
+}
+
+// NewBackupTargetController 创建备份存储控制器
+func NewBackupTargetController() *BackupTargetController {
+	return &BackupTargetController{
+		backupService: service.NewBackupService(),
+	}
+}
+
+// GetTargets 获取备份存储列表
+func (tc *BackupTargetController) GetTargets(c *gin.Context) {
+	targets, err := tc.backupService.ListTargets()
+	if err != nil {
+		utils.ResponseError(c, "获取备份存储列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, targets)
+}
+
+// CreateTarget 添加备份存储（仅管理员）
+func (tc *BackupTargetController) CreateTarget(c *gin.Context) {
+	if !isAdmin(c) {
+		utils.ResponseError(c, "只有管理员可以添加备份存储")
+		return
+	}
+
+	var req service.BackupTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	target, err := tc.backupService.CreateTarget(req)
+	if err != nil {
+		utils.ResponseError(c, "添加备份存储失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, target)
+}
+
+// UpdateTarget 修改备份存储（仅管理员）
+func (tc *BackupTargetController) UpdateTarget(c *gin.Context) {
+	if !isAdmin(c) {
+		utils.ResponseError(c, "只有管理员可以修改备份存储")
+		return
+	}
+
+	id, ok := parseTargetID(c)
+	if !ok {
+		return
+	}
+
+	var req service.BackupTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	target, err := tc.backupService.UpdateTarget(id, req)
+	if err != nil {
+		utils.ResponseError(c, "修改备份存储失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, target)
+}
+
+// DeleteTarget 删除备份存储（存储中的归档保留）（仅管理员）
+func (tc *BackupTargetController) DeleteTarget(c *gin.Context) {
+	if !isAdmin(c) {
+		utils.ResponseError(c, "只有管理员可以删除备份存储")
+		return
+	}
+
+	id, ok := parseTargetID(c)
+	if !ok {
+		return
+	}
+
+	if err := tc.backupService.DeleteTarget(id); err != nil {
+		utils.ResponseError(c, "删除备份存储失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "备份存储删除成功"})
+}
+
+// TestTarget 检查备份存储能否写入
+func (tc *BackupTargetController) TestTarget(c *gin.Context) {
+	id, ok := parseTargetID(c)
+	if !ok {
+		return
+	}
+
+	if err := tc.backupService.TestTarget(id); err != nil {
+		utils.ResponseError(c, "备份存储不可用: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "备份存储可以正常写入"})
+}
+
+// GetTargetBackups 列出备份存储中的备份归档
+func (tc *BackupTargetController) GetTargetBackups(c *gin.Context) {
+	id, ok := parseTargetID(c)
+	if !ok {
+		return
+	}
+
+	objects, err := tc.backupService.ListTargetBackups(id)
+	if err != nil {
+		utils.ResponseError(c, "获取备份存储中的备份失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, objects)
+}
+
+// ImportBackup 从备份存储导入备份到房间（仅管理员）
+func (tc *BackupTargetController) ImportBackup(c *gin.Context) {
+	if !isAdmin(c) {
+		utils.ResponseError(c, "只有管理员可以从备份存储导入备份")
+		return
+	}
+
+	id, ok := parseTargetID(c)
+	if !ok {
+		return
+	}
+
+	var req service.ImportBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	backup, err := tc.backupService.ImportFromTarget(id, req)
+	if err != nil {
+		utils.ResponseError(c, "导入备份失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, backup)
+}
+
+// parseTargetID 解析路径中的备份存储ID，失败时已写入响应
+func parseTargetID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的备份存储ID")
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -1,14 +1,10 @@
 package controller
 
 import (
-	"fmt"
 	"io"
-	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"strings"
+	"strconv"
+	"terraria-api/app/model"
+	"terraria-api/app/service"
 	"terraria-api/utils"
 
 	"github.com/gin-gonic/gin"
@@ -16,190 +12,202 @@ import (
 
 // InstallController 游戏安装控制器
 type InstallController struct {
-	installDir string
+	installService      *service.InstallService
+	installationService *service.InstallationService
+	catalogService      *service.VersionCatalogService
+	runtimeService      *service.RuntimeService
 }
 
 // NewInstallController 创建安装控制器
 func NewInstallController() *InstallController {
-	installDir := os.Getenv("TERRARIA_INSTALL_DIR")
-	if installDir == "" {
-		installDir = "./terraria_servers"
-	}
 	return &InstallController{
-		installDir: installDir,
+		installService:      service.NewInstallService(),
+		installationService: service.NewInstallationService(),
+		catalogService:      service.NewVersionCatalogService(),
+		runtimeService:      service.NewRuntimeService(),
 	}
 }
 
-// GameVersion 游戏版本信息
-type GameVersion struct {
-	Name        string `json:"name"`
-	Version     string `json:"version"`
-	Type        string `json:"type"` // vanilla, tshock, tmodloader
-	Description string `json:"description"`
-	DownloadURL string `json:"download_url"`
-	Size        string `json:"size"`
-	Recommended bool   `json:"recommended"`
-}
-
 // GetVersions 获取可用的游戏版本列表
 func (ic *InstallController) GetVersions(c *gin.Context) {
-	versions := []GameVersion{
-		{
-			Name:        "TShock 5.2.0",
-			Version:     "5.2.0",
-			Type:        "tshock",
-			Description: "TShock服务端 - 支持插件和管理命令（推荐）",
-			DownloadURL: "https://github.com/Pryaxis/TShock/releases/download/v5.2.0/TShock-5.2.0-for-Terraria-1.4.4.9-linux-x64-Release.zip",
-			Size:        "~15MB",
-			Recommended: true,
-		},
-		{
-			Name:        "TShock 4.5.20",
-			Version:     "4.5.20",
-			Type:        "tshock",
-			Description: "TShock服务端 - 旧版稳定版",
-			DownloadURL: "https://github.com/Pryaxis/TShock/releases/download/v4.5.20/TShock4.5.20_Terraria1.4.3.6.zip",
-			Size:        "~12MB",
-			Recommended: false,
-		},
-		{
-			Name:        "官方原版服务端",
-			Version:     "1.4.4.9",
-			Type:        "vanilla",
-			Description: "官方原版Terraria服务端 - 无插件支持",
-			DownloadURL: "https://terraria.org/api/download/pc-dedicated-server/terraria-server-1449.zip",
-			Size:        "~10MB",
-			Recommended: false,
-		},
-		{
-			Name:        "tModLoader",
-			Version:     "2023.8",
-			Type:        "tmodloader",
-			Description: "tModLoader服务端 - 支持模组",
-			DownloadURL: "https://github.com/tModLoader/tModLoader/releases/download/v2023.8.3.0/tModLoader.zip",
-			Size:        "~50MB",
-			Recommended: false,
-		},
-	}
+	utils.ResponseSuccess(c, ic.catalogService.GetVersions())
+}
 
-	utils.ResponseSuccess(c, versions)
+// RefreshVersions 立即重新拉取版本目录
+func (ic *InstallController) RefreshVersions(c *gin.Context) {
+	if err := ic.catalogService.Refresh(); err != nil {
+		utils.ResponseErrorWithData(c, "部分版本来源拉取失败，已使用缓存: "+err.Error(), ic.catalogService.GetVersions())
+		return
+	}
+	utils.ResponseSuccess(c, ic.catalogService.GetVersions())
 }
 
 // InstallRequest 安装请求
+// 版本目录中的版本使用目录中的下载地址和校验和；自定义 download_url 或没有校验和的版本
+// 需要管理员并显式设置 unverified
 type InstallRequest struct {
 	Version     string `json:"version" binding:"required"`
 	Type        string `json:"type" binding:"required"`
-	DownloadURL string `json:"download_url" binding:"required"`
+	DownloadURL string `json:"download_url"`
 	Name        string `json:"name" binding:"required"`
+	Unverified  bool   `json:"unverified"`
 }
 
-// InstallGame 安装游戏服务器
+// InstallGame 创建安装任务，下载和解压在后台进行
+// 通过 GET /install/jobs/:id 或 /install/jobs/:id/events 查询进度
 func (ic *InstallController) InstallGame(c *gin.Context) {
 	var req InstallRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.ResponseError(c, "参数错误: "+err.Error())
 		return
 	}
-
-	// 创建安装目录
-	targetDir := filepath.Join(ic.installDir, fmt.Sprintf("%s-%s", req.Type, req.Version))
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		utils.ResponseError(c, "创建目录失败: "+err.Error())
+	if err := ic.installService.ValidateTarget(req.Type, req.Version); err != nil {
+		utils.ResponseError(c, err.Error())
 		return
 	}
 
 	// 检查是否已安装
-	if _, err := os.Stat(filepath.Join(targetDir, "TerrariaServer.exe")); err == nil {
+	if ic.installService.IsInstalled(req.Type, req.Version) {
 		utils.ResponseSuccess(c, gin.H{
 			"status":      "already_installed",
 			"message":     "该版本已安装",
-			"install_dir": targetDir,
+			"install_dir": ic.installService.InstallDir(req.Type, req.Version),
 		})
 		return
 	}
 
-	// 开始下载
-	zipFile := filepath.Join(targetDir, "download.zip")
-	if err := ic.downloadFile(req.DownloadURL, zipFile); err != nil {
-		utils.ResponseError(c, "下载失败: "+err.Error())
-		return
+	source := service.InstallSource{
+		Name:        req.Name,
+		Type:        req.Type,
+		Version:     req.Version,
+		DownloadURL: req.DownloadURL,
 	}
-
-	// 解压文件
-	if err := ic.unzip(zipFile, targetDir); err != nil {
-		os.Remove(zipFile)
-		utils.ResponseError(c, "解压失败: "+err.Error())
+	if v := ic.catalogService.FindVersion(req.Type, req.Version); v != nil && (req.DownloadURL == "" || req.DownloadURL == v.DownloadURL) {
+		source.DownloadURL = v.DownloadURL
+		source.Mirrors = v.Mirrors
+		source.SHA256 = v.SHA256
+	}
+	if source.DownloadURL == "" {
+		utils.ResponseError(c, "版本目录中没有该版本，请提供 download_url")
 		return
 	}
-
-	// 删除zip文件
-	os.Remove(zipFile)
-
-	// 设置执行权限（Linux）
-	if runtime.GOOS == "linux" {
-		serverExe := filepath.Join(targetDir, "TerrariaServer.bin.x86_64")
-		if _, err := os.Stat(serverExe); err == nil {
-			os.Chmod(serverExe, 0755)
+	if source.SHA256 == "" {
+		if !req.Unverified {
+			utils.ResponseError(c, "该安装包没有可用的校验和，需由管理员设置 unverified=true 后安装")
+			return
+		}
+		if !isAdmin(c) {
+			utils.ResponseError(c, "只有管理员可以安装未经校验的安装包")
+			return
 		}
 	}
 
+	job, err := ic.installService.StartInstall(source)
+	if err != nil {
+		utils.ResponseError(c, "创建安装任务失败: "+err.Error())
+		return
+	}
+
 	utils.ResponseSuccess(c, gin.H{
-		"status":      "success",
-		"message":     "安装成功",
-		"install_dir": targetDir,
+		"status":      job.State,
+		"message":     "安装任务已创建",
+		"job":         job,
+		"install_dir": job.InstallDir,
 		"version":     req.Version,
 		"type":        req.Type,
 	})
 }
 
-// GetInstallStatus 获取安装状态
-func (ic *InstallController) GetInstallStatus(c *gin.Context) {
-	// 扫描安装目录
-	installedVersions := []map[string]string{}
+// GetInstallJobs 获取安装任务列表
+func (ic *InstallController) GetInstallJobs(c *gin.Context) {
+	utils.ResponseSuccess(c, ic.installService.ListJobs())
+}
+
+// GetInstallJob 获取安装任务状态
+func (ic *InstallController) GetInstallJob(c *gin.Context) {
+	job, err := ic.installService.GetJob(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, job)
+}
 
-	entries, err := os.ReadDir(ic.installDir)
+// StreamInstallJob 通过SSE推送安装任务进度，任务结束后关闭连接
+func (ic *InstallController) StreamInstallJob(c *gin.Context) {
+	updates, unsubscribe, err := ic.installService.Subscribe(c.Param("id"))
 	if err != nil {
-		utils.ResponseSuccess(c, installedVersions)
+		utils.ResponseError(c, err.Error())
 		return
 	}
+	defer unsubscribe()
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			dirPath := filepath.Join(ic.installDir, entry.Name())
-			// 检查是否包含服务器可执行文件
-			if _, err := os.Stat(filepath.Join(dirPath, "TerrariaServer.exe")); err == nil {
-				parts := strings.Split(entry.Name(), "-")
-				if len(parts) >= 2 {
-					installedVersions = append(installedVersions, map[string]string{
-						"name":        entry.Name(),
-						"type":        parts[0],
-						"version":     strings.Join(parts[1:], "-"),
-						"install_dir": dirPath,
-					})
-				}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case job, ok := <-updates:
+			if !ok {
+				return false
 			}
+			c.SSEvent("progress", job)
+			return !job.Finished()
+		case <-c.Request.Context().Done():
+			return false
 		}
+	})
+}
+
+// CancelInstallJob 取消安装任务
+func (ic *InstallController) CancelInstallJob(c *gin.Context) {
+	if err := ic.installService.CancelJob(c.Param("id")); err != nil {
+		utils.ResponseError(c, "取消失败: "+err.Error())
+		return
 	}
 
-	utils.ResponseSuccess(c, installedVersions)
+	utils.ResponseSuccess(c, gin.H{
+		"message": "已取消安装任务",
+	})
 }
 
-// UninstallGame 卸载游戏服务器
-func (ic *InstallController) UninstallGame(c *gin.Context) {
-	installDir := c.Query("install_dir")
-	if installDir == "" {
-		utils.ResponseError(c, "参数错误: install_dir不能为空")
+// GetInstallStatus 获取已安装的服务端版本
+func (ic *InstallController) GetInstallStatus(c *gin.Context) {
+	installations, err := ic.installationService.List()
+	if err != nil {
+		utils.ResponseError(c, "获取安装列表失败: "+err.Error())
 		return
 	}
 
-	// 安全检查：确保路径在安装目录下
-	if !strings.HasPrefix(installDir, ic.installDir) {
-		utils.ResponseError(c, "非法路径")
-		return
+	utils.ResponseSuccess(c, installations)
+}
+
+// UninstallGame 卸载游戏服务器（按 id 或 install_dir），仍被房间使用的版本不能卸载
+func (ic *InstallController) UninstallGame(c *gin.Context) {
+	var installation *model.Installation
+	if idStr := c.Query("id"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			utils.ResponseError(c, "无效的安装ID")
+			return
+		}
+		if installation, err = ic.installationService.Get(uint(id)); err != nil {
+			utils.ResponseError(c, err.Error())
+			return
+		}
+	} else {
+		installDir := c.Query("install_dir")
+		if installDir == "" {
+			utils.ResponseError(c, "参数错误: id或install_dir不能为空")
+			return
+		}
+		if installation = ic.installationService.FindByPath(installDir); installation == nil {
+			utils.ResponseError(c, "该目录不是已安装的服务端")
+			return
+		}
 	}
 
-	// 删除目录
-	if err := os.RemoveAll(installDir); err != nil {
+	if err := ic.installationService.Uninstall(installation.ID); err != nil {
 		utils.ResponseError(c, "卸载失败: "+err.Error())
 		return
 	}
@@ -209,52 +217,33 @@ func (ic *InstallController) UninstallGame(c *gin.Context) {
 	})
 }
 
-// downloadFile 下载文件
-func (ic *InstallController) downloadFile(url, filepath string) error {
-	// 创建文件
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// 发送GET请求
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// GetRuntimes 获取检测到的 .NET / Mono 运行时
+func (ic *InstallController) GetRuntimes(c *gin.Context) {
+	utils.ResponseSuccess(c, gin.H{
+		"runtimes":     ic.runtimeService.DetectRuntimes(),
+		"private_root": ic.runtimeService.PrivateDotnetRoot(),
+	})
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+// InstallRuntime 安装私有 .NET 运行时（仅管理员）
+// 可以指定服务器本机上的压缩包（archive），或从 url / 配置的地址模板下载
+func (ic *InstallController) InstallRuntime(c *gin.Context) {
+	if !isAdmin(c) {
+		utils.ResponseError(c, "只有管理员可以安装运行时")
+		return
 	}
 
-	// 写入文件
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
-
-// unzip 解压zip文件
-func (ic *InstallController) unzip(zipFile, targetDir string) error {
-	// 使用系统的unzip命令
-	if runtime.GOOS == "linux" {
-		cmd := exec.Command("unzip", "-o", zipFile, "-d", targetDir)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("解压失败: %s, %w", string(output), err)
-		}
-		return nil
+	var req service.RuntimeInstallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
 	}
 
-	// Windows下使用PowerShell
-	if runtime.GOOS == "windows" {
-		cmd := exec.Command("powershell", "-Command", fmt.Sprintf("Expand-Archive -Path '%s' -DestinationPath '%s' -Force", zipFile, targetDir))
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("解压失败: %s, %w", string(output), err)
-		}
-		return nil
+	rt, err := ic.runtimeService.InstallDotnet(c.Request.Context(), req)
+	if err != nil {
+		utils.ResponseError(c, "安装运行时失败: "+err.Error())
+		return
 	}
 
-	return fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
+	utils.ResponseSuccess(c, rt)
 }
@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"encoding/json"
+	"strconv"
+	"terraria-api/app/model"
 	"terraria-api/app/service"
 	"terraria-api/utils"
 
@@ -9,13 +12,21 @@ import (
 
 // ModController Mod市场控制器
 type ModController struct {
-	modService *service.ModService
+	modService       *service.ModService
+	roomService      *service.RoomService
+	roomModService   *service.RoomModService
+	modUpdateService *service.ModUpdateService
+	modConfigService *service.ModConfigService
 }
 
 // NewModController 创建Mod控制器
 func NewModController() *ModController {
 	return &ModController{
-		modService: service.NewModService(),
+		modService:       service.NewModService(),
+		roomService:      service.NewRoomService(),
+		roomModService:   service.NewRoomModService(),
+		modUpdateService: service.NewModUpdateService(),
+		modConfigService: service.NewModConfigService(),
 	}
 }
 
@@ -33,6 +44,25 @@ func (mc *ModController) SearchWorkshopMods(c *gin.Context) {
 	utils.ResponseSuccess(c, mods)
 }
 
+// DownloadWorkshopMod 下载Workshop模组到本地缓存
+func (mc *ModController) DownloadWorkshopMod(c *gin.Context) {
+	var req struct {
+		WorkshopID string `json:"workshopId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	item, err := mc.modService.DownloadWorkshopMod(req.WorkshopID)
+	if err != nil {
+		utils.ResponseError(c, "下载模组失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, item)
+}
+
 // GetPopularMods 获取热门模组
 func (mc *ModController) GetPopularMods(c *gin.Context) {
 	limit := c.DefaultQuery("limit", "20")
@@ -42,9 +72,398 @@ func (mc *ModController) GetPopularMods(c *gin.Context) {
 }
 
 // GetTShockPlugins 获取TShock插件库
+// 传入 roomId 时按房间安装的TShock版本过滤，也可直接传 tshockVersion
 func (mc *ModController) GetTShockPlugins(c *gin.Context) {
 	category := c.Query("category")
+	tshockVersion := c.Query("tshockVersion")
+
+	if roomIdStr := c.Query("roomId"); roomIdStr != "" {
+		roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+		if err != nil {
+			utils.ResponseError(c, "无效的房间ID")
+			return
+		}
+		room, err := mc.roomService.GetRoomByID(uint(roomId))
+		if err != nil {
+			utils.ResponseError(c, "获取房间详情失败: "+err.Error())
+			return
+		}
+		if room.Type != model.ServerTypeTShock {
+			utils.ResponseError(c, "此房间不是TShock服务器")
+			return
+		}
+		tshockVersion = room.Version
+	}
+
+	plugins, err := mc.modService.GetTShockPlugins(category, tshockVersion)
+	if err != nil {
+		utils.ResponseError(c, "获取插件库失败: "+err.Error())
+		return
+	}
 
-	plugins := mc.modService.GetTShockPlugins(category)
 	utils.ResponseSuccess(c, plugins)
 }
+
+// RefreshTShockPlugins 刷新插件注册表
+func (mc *ModController) RefreshTShockPlugins(c *gin.Context) {
+	if err := mc.modService.RefreshTShockPlugins(); err != nil {
+		utils.ResponseError(c, "刷新插件库失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "插件库已刷新"})
+}
+
+// GetMods 获取房间的Mod列表
+func (mc *ModController) GetMods(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	mods, err := mc.roomModService.GetRoomMods(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取Mod列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, mods)
+}
+
+// InstallMod 上传Mod到房间
+func (mc *ModController) InstallMod(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.ResponseError(c, "获取上传文件失败: "+err.Error())
+		return
+	}
+	enable := c.DefaultPostForm("enable", "true") == "true"
+
+	mod, err := mc.roomModService.UploadMod(uint(roomId), file, enable)
+	if err != nil {
+		utils.ResponseError(c, "上传Mod失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, mod)
+}
+
+// ToggleMod 启用/禁用Mod
+func (mc *ModController) ToggleMod(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	if err := mc.roomModService.ToggleMod(uint(roomId), c.Param("name"), req.Enabled); err != nil {
+		utils.ResponseError(c, "修改Mod状态失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Mod状态已更新"})
+}
+
+// DeleteMod 删除Mod
+func (mc *ModController) DeleteMod(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	if err := mc.roomModService.DeleteMod(uint(roomId), c.Param("name")); err != nil {
+		utils.ResponseError(c, "删除Mod失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Mod删除成功"})
+}
+
+// InstallWorkshopMod 从Workshop安装Mod到房间
+func (mc *ModController) InstallWorkshopMod(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		WorkshopID string `json:"workshopId" binding:"required"`
+		Enable     *bool  `json:"enable"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+	enable := req.Enable == nil || *req.Enable
+
+	mod, err := mc.roomModService.InstallWorkshopMod(uint(roomId), req.WorkshopID, enable)
+	if err != nil {
+		utils.ResponseError(c, "安装Workshop模组失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, mod)
+}
+
+// InstallURLMod 从URL安装Mod到房间
+func (mc *ModController) InstallURLMod(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		URL    string `json:"url" binding:"required,url"`
+		Enable *bool  `json:"enable"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+	enable := req.Enable == nil || *req.Enable
+
+	mod, err := mc.roomModService.InstallModFromURL(uint(roomId), req.URL, enable)
+	if err != nil {
+		utils.ResponseError(c, "安装Mod失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, mod)
+}
+
+// GetModUpdates 获取房间Mod的来源与更新状态
+func (mc *ModController) GetModUpdates(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	updates, err := mc.modUpdateService.GetRoomUpdates(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取Mod更新状态失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, updates)
+}
+
+// CheckModUpdates 立即检查房间Mod更新
+func (mc *ModController) CheckModUpdates(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	updates, err := mc.modUpdateService.CheckRoom(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "检查Mod更新失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, updates)
+}
+
+// UpdateMod 更新房间Mod到最新版本
+func (mc *ModController) UpdateMod(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		Restart bool `json:"restart"`
+	}
+	c.ShouldBindJSON(&req)
+
+	mod, err := mc.modUpdateService.UpdateMod(uint(roomId), c.Param("name"), req.Restart)
+	if err != nil {
+		utils.ResponseError(c, "更新Mod失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, mod)
+}
+
+// RollbackMod 回滚房间Mod到更新前的版本
+func (mc *ModController) RollbackMod(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		Restart bool `json:"restart"`
+	}
+	c.ShouldBindJSON(&req)
+
+	mod, err := mc.modUpdateService.RollbackMod(uint(roomId), c.Param("name"), req.Restart)
+	if err != nil {
+		utils.ResponseError(c, "回滚Mod失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, mod)
+}
+
+// GetModConfigs 获取房间已启用Mod的配置文件列表
+func (mc *ModController) GetModConfigs(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	files, err := mc.modConfigService.ListConfigFiles(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取Mod配置列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, files)
+}
+
+// GetModConfig 读取Mod配置文件
+func (mc *ModController) GetModConfig(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	config, err := mc.modConfigService.GetConfigFile(uint(roomId), c.Query("path"))
+	if err != nil {
+		utils.ResponseError(c, "读取Mod配置失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, config)
+}
+
+// UpdateModConfig 保存Mod配置
+func (mc *ModController) UpdateModConfig(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	// 保持数字原样，避免大整数精度丢失
+	var updates map[string]interface{}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&updates); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	result, err := mc.modConfigService.SaveConfigFile(uint(roomId), c.Query("path"), updates)
+	if err != nil {
+		utils.ResponseError(c, "保存Mod配置失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
+
+// SetModConfigScope 手动设置Mod配置的作用域
+func (mc *ModController) SetModConfigScope(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		Scope string `json:"scope"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	file, err := mc.modConfigService.SetConfigScope(uint(roomId), c.Query("path"), req.Scope)
+	if err != nil {
+		utils.ResponseError(c, "设置作用域失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, file)
+}
+
+// GetModConfigHistory 获取Mod配置文件的历史版本
+func (mc *ModController) GetModConfigHistory(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	revisions, err := mc.modConfigService.GetHistory(uint(roomId), c.Query("path"))
+	if err != nil {
+		utils.ResponseError(c, "获取配置历史失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, revisions)
+}
+
+// RevertModConfig 将Mod配置恢复到历史版本
+func (mc *ModController) RevertModConfig(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	revisionId, err := strconv.ParseUint(c.Param("revisionId"), 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的版本ID")
+		return
+	}
+
+	result, err := mc.modConfigService.RevertConfigFile(uint(roomId), uint(revisionId))
+	if err != nil {
+		utils.ResponseError(c, "恢复Mod配置失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
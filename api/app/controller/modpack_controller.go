@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"path/filepath"
+	"strconv"
+	"terraria-api/app/service"
+	"terraria-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModPackController 模组包控制器
+type ModPackController struct {
+	modPackService *service.ModPackService
+}
+
+// NewModPackController 创建模组包控制器
+func NewModPackController() *ModPackController {
+	return &ModPackController{
+		modPackService: service.NewModPackService(),
+	}
+}
+
+// GetModPacks 获取模组包列表
+func (mc *ModPackController) GetModPacks(c *gin.Context) {
+	packs, err := mc.modPackService.GetModPacks()
+	if err != nil {
+		utils.ResponseError(c, "获取模组包列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, packs)
+}
+
+// GetModPackDetail 获取模组包详情
+func (mc *ModPackController) GetModPackDetail(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的模组包ID")
+		return
+	}
+
+	pack, err := mc.modPackService.GetModPack(uint(id))
+	if err != nil {
+		utils.ResponseError(c, "获取模组包详情失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, pack)
+}
+
+// BuildModPack 从房间构建模组包
+func (mc *ModPackController) BuildModPack(c *gin.Context) {
+	var req service.BuildModPackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	pack, err := mc.modPackService.BuildFromRoom(req)
+	if err != nil {
+		utils.ResponseError(c, "构建模组包失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, pack)
+}
+
+// ImportModPack 导入模组包（上传归档文件，或提交 url 从远程下载）
+func (mc *ModPackController) ImportModPack(c *gin.Context) {
+	if file, err := c.FormFile("file"); err == nil {
+		pack, err := mc.modPackService.ImportFromUpload(file)
+		if err != nil {
+			utils.ResponseError(c, "导入模组包失败: "+err.Error())
+			return
+		}
+		utils.ResponseSuccess(c, pack)
+		return
+	}
+
+	var req struct {
+		URL string `json:"url" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: 需要上传文件或提供url")
+		return
+	}
+
+	pack, err := mc.modPackService.ImportFromURL(req.URL)
+	if err != nil {
+		utils.ResponseError(c, "导入模组包失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, pack)
+}
+
+// ApplyModPack 将模组包应用到房间
+func (mc *ModPackController) ApplyModPack(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的模组包ID")
+		return
+	}
+
+	var req struct {
+		RoomIDs []uint `json:"roomIds" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	results, err := mc.modPackService.ApplyToRooms(uint(id), req.RoomIDs)
+	if err != nil {
+		utils.ResponseError(c, "应用模组包失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, results)
+}
+
+// DownloadModPack 下载模组包归档（玩家可用同一个包保持客户端一致）
+func (mc *ModPackController) DownloadModPack(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的模组包ID")
+		return
+	}
+
+	pack, err := mc.modPackService.GetModPack(uint(id))
+	if err != nil {
+		utils.ResponseError(c, "下载模组包失败: "+err.Error())
+		return
+	}
+
+	c.FileAttachment(pack.ArchivePath, filepath.Base(pack.ArchivePath))
+}
+
+// DeleteModPack 删除模组包
+func (mc *ModPackController) DeleteModPack(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的模组包ID")
+		return
+	}
+
+	if err := mc.modPackService.DeleteModPack(uint(id)); err != nil {
+		utils.ResponseError(c, "删除模组包失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
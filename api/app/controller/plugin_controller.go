@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"encoding/json"
+	"strconv"
+	"terraria-api/app/service"
+	"terraria-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PluginController 房间插件管理控制器
+type PluginController struct {
+	pluginService       *service.PluginService
+	pluginConfigService *service.PluginConfigService
+}
+
+// NewPluginController 创建插件控制器
+func NewPluginController() *PluginController {
+	return &PluginController{
+		pluginService:       service.NewPluginService(),
+		pluginConfigService: service.NewPluginConfigService(),
+	}
+}
+
+// PluginInstallRequest 插件安装请求
+type PluginInstallRequest struct {
+	Plugins []service.PluginRequest `json:"plugins" binding:"required,min=1,dive"`
+}
+
+// GetPlugins 获取房间已安装的插件
+func (pc *PluginController) GetPlugins(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	plugins, err := pc.pluginService.GetRoomPlugins(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取插件列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, plugins)
+}
+
+// PlanInstall 生成插件安装计划
+func (pc *PluginController) PlanInstall(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req PluginInstallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	plan, err := pc.pluginService.PlanInstall(uint(roomId), req.Plugins)
+	if err != nil {
+		utils.ResponseError(c, "生成安装计划失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, plan)
+}
+
+// InstallPlugins 安装插件（会重新生成安装计划，存在冲突或错误时拒绝执行）
+func (pc *PluginController) InstallPlugins(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req PluginInstallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	plan, err := pc.pluginService.InstallPlugins(uint(roomId), req.Plugins)
+	if err != nil {
+		if plan != nil {
+			utils.ResponseErrorWithData(c, "安装插件失败: "+err.Error(), plan)
+			return
+		}
+		utils.ResponseError(c, "安装插件失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, plan)
+}
+
+// UninstallPlugin 卸载插件
+func (pc *PluginController) UninstallPlugin(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	force := c.Query("force") == "true"
+	dependents, err := pc.pluginService.UninstallPlugin(uint(roomId), c.Param("pluginId"), force)
+	if err != nil {
+		if len(dependents) > 0 {
+			utils.ResponseErrorWithData(c, "卸载插件失败: "+err.Error(), gin.H{"dependents": dependents})
+			return
+		}
+		utils.ResponseError(c, "卸载插件失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "插件卸载成功", "dependents": dependents})
+}
+
+// GetPluginConfigs 获取已安装插件的配置文件列表
+func (pc *PluginController) GetPluginConfigs(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	files, err := pc.pluginConfigService.ListConfigFiles(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取插件配置列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, files)
+}
+
+// GetPluginConfig 读取插件配置文件
+func (pc *PluginController) GetPluginConfig(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	config, err := pc.pluginConfigService.GetConfigFile(uint(roomId), c.Query("path"))
+	if err != nil {
+		utils.ResponseError(c, "读取插件配置失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, config)
+}
+
+// UpdatePluginConfig 保存插件配置并重载插件
+func (pc *PluginController) UpdatePluginConfig(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	// 保持数字原样，避免大整数精度丢失
+	var updates map[string]interface{}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&updates); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	result, err := pc.pluginConfigService.SaveConfigFile(uint(roomId), c.Query("path"), updates)
+	if err != nil {
+		utils.ResponseError(c, "保存插件配置失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
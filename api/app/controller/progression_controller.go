@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/app/service"
+	"terraria-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProgressionController 世界进度控制器
+type ProgressionController struct {
+	progressionService *service.ProgressionService
+}
+
+// NewProgressionController 创建进度控制器
+func NewProgressionController() *ProgressionController {
+	return &ProgressionController{
+		progressionService: service.NewProgressionService(),
+	}
+}
+
+// GetProgression 获取房间当前世界的进度
+func (pc *ProgressionController) GetProgression(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	progression, err := pc.progressionService.GetProgression(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取进度失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, progression)
+}
+
+// GetTimeline 获取房间的进度快照和事件
+func (pc *ProgressionController) GetTimeline(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	timeline, err := pc.progressionService.GetTimeline(uint(roomId), c.Query("world"), limit)
+	if err != nil {
+		utils.ResponseError(c, "获取进度记录失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, timeline)
+}
+
+// CaptureSnapshot 立即记录进度快照
+func (pc *ProgressionController) CaptureSnapshot(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	snapshot, err := pc.progressionService.Capture(uint(roomId), model.ProgressionTriggerManual)
+	if err != nil {
+		utils.ResponseError(c, "记录进度快照失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, snapshot)
+}
+
+// CompareProgression 对比多个房间的进度（?rooms=1,2,3）
+func (pc *ProgressionController) CompareProgression(c *gin.Context) {
+	var roomIds []uint
+	for _, idStr := range strings.Split(c.Query("rooms"), ",") {
+		if idStr = strings.TrimSpace(idStr); idStr == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			utils.ResponseError(c, "无效的房间ID: "+idStr)
+			return
+		}
+		roomIds = append(roomIds, uint(id))
+	}
+
+	result, err := pc.progressionService.Compare(roomIds)
+	if err != nil {
+		utils.ResponseError(c, "对比进度失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
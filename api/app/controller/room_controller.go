@@ -11,13 +11,17 @@ import (
 
 // RoomController 房间控制器
 type RoomController struct {
-	roomService *service.RoomService
+	roomService    *service.RoomService
+	upgradeService *service.RoomUpgradeService
+	worldService   *service.WorldService
 }
 
 // NewRoomController 创建房间控制器
 func NewRoomController() *RoomController {
 	return &RoomController{
-		roomService: service.NewRoomService(),
+		roomService:    service.NewRoomService(),
+		upgradeService: service.NewRoomUpgradeService(),
+		worldService:   service.NewWorldService(),
 	}
 }
 
@@ -46,6 +50,7 @@ func (rc *RoomController) GetRoomDetail(c *gin.Context) {
 		utils.ResponseError(c, "获取房间详情失败: "+err.Error())
 		return
 	}
+	rc.worldService.FillRoomWorld(room)
 
 	utils.ResponseSuccess(c, room)
 }
@@ -183,3 +188,72 @@ func (rc *RoomController) GetServerStatus(c *gin.Context) {
 
 	utils.ResponseSuccess(c, status)
 }
+
+// UpgradeRequest 升级请求
+type UpgradeRequest struct {
+	InstallationID uint `json:"installationId" binding:"required"`
+}
+
+// UpgradeRoom 将房间升级到更新的已安装版本，升级在后台进行，失败时自动回滚
+func (rc *RoomController) UpgradeRoom(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req UpgradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	upgrade, err := rc.upgradeService.StartUpgrade(uint(id), req.InstallationID)
+	if err != nil {
+		utils.ResponseError(c, "升级失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, upgrade)
+}
+
+// GetRoomUpgrades 获取房间的升级记录
+func (rc *RoomController) GetRoomUpgrades(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	upgrades, err := rc.upgradeService.GetUpgrades(uint(id))
+	if err != nil {
+		utils.ResponseError(c, "获取升级记录失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, upgrades)
+}
+
+// GetRoomUpgrade 获取一次升级的状态和结果
+func (rc *RoomController) GetRoomUpgrade(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+	upgradeId, err := strconv.ParseUint(c.Param("upgradeId"), 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的升级记录ID")
+		return
+	}
+
+	upgrade, err := rc.upgradeService.GetUpgrade(uint(id), uint(upgradeId))
+	if err != nil {
+		utils.ResponseError(c, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, upgrade)
+}
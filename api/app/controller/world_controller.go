@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"terraria-api/app/service"
+	"terraria-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorldController 世界管理控制器
+type WorldController struct {
+	worldService    *service.WorldService
+	worldMapService *service.WorldMapService
+}
+
+// NewWorldController 创建世界控制器
+func NewWorldController() *WorldController {
+	return &WorldController{
+		worldService:    service.NewWorldService(),
+		worldMapService: service.NewWorldMapService(),
+	}
+}
+
+// GetWorlds 获取房间的世界列表
+func (wc *WorldController) GetWorlds(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	worlds, err := wc.worldService.GetWorlds(uint(roomId))
+	if err != nil {
+		utils.ResponseError(c, "获取世界列表失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, worlds)
+}
+
+// UploadWorld 上传世界文件
+func (wc *WorldController) UploadWorld(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.ResponseError(c, "获取上传文件失败: "+err.Error())
+		return
+	}
+
+	world, err := wc.worldService.UploadWorld(uint(roomId), file)
+	if err != nil {
+		utils.ResponseError(c, "上传世界失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, world)
+}
+
+// DownloadWorld 下载世界文件（?backup=bak|bak2 下载备份）
+func (wc *WorldController) DownloadWorld(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	path, err := wc.worldService.GetWorldFilePath(uint(roomId), c.Param("name"), c.Query("backup"))
+	if err != nil {
+		utils.ResponseError(c, "下载世界失败: "+err.Error())
+		return
+	}
+
+	c.FileAttachment(path, filepath.Base(path))
+}
+
+// DeleteWorld 删除世界
+func (wc *WorldController) DeleteWorld(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	if err := wc.worldService.DeleteWorld(uint(roomId), c.Param("name")); err != nil {
+		utils.ResponseError(c, "删除世界失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "世界删除成功"})
+}
+
+// SwitchWorld 设置房间使用的世界
+func (wc *WorldController) SwitchWorld(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	result, err := wc.worldService.SwitchWorld(uint(roomId), req.Name)
+	if err != nil {
+		utils.ResponseError(c, "切换世界失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
+
+// GetWorldMap 获取世界地图PNG（?scale=每像素图格数）
+// 地图尚未生成时在后台开始渲染，并返回渲染任务供轮询
+func (wc *WorldController) GetWorldMap(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+	scale, err := parseMapScale(c.Query("scale"))
+	if err != nil {
+		utils.ResponseError(c, err.Error())
+		return
+	}
+
+	path, job, err := wc.worldMapService.GetMap(uint(roomId), c.Param("name"), scale)
+	if err != nil {
+		utils.ResponseError(c, "获取世界地图失败: "+err.Error())
+		return
+	}
+	if job != nil {
+		utils.ResponseSuccess(c, job)
+		return
+	}
+
+	c.File(path)
+}
+
+// RenderWorldMap 开始渲染世界地图（?force=true 忽略缓存重新渲染）
+func (wc *WorldController) RenderWorldMap(c *gin.Context) {
+	roomIdStr := c.Param("id")
+	roomId, err := strconv.ParseUint(roomIdStr, 10, 32)
+	if err != nil {
+		utils.ResponseError(c, "无效的房间ID")
+		return
+	}
+	scale, err := parseMapScale(c.Query("scale"))
+	if err != nil {
+		utils.ResponseError(c, err.Error())
+		return
+	}
+
+	job, err := wc.worldMapService.Render(uint(roomId), c.Param("name"), scale, c.Query("force") == "true")
+	if err != nil {
+		utils.ResponseError(c, "渲染世界地图失败: "+err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, job)
+}
+
+// parseMapScale 解析地图缩放参数，未指定时为 0（自动）
+func parseMapScale(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	scale, err := strconv.Atoi(s)
+	if err != nil || scale < 1 {
+		return 0, errors.New("无效的缩放参数")
+	}
+	return scale, nil
+}
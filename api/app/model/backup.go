@@ -0,0 +1,124 @@
+package model
+
+import (
+	"time"
+)
+
+// 备份触发方式
+const (
+	BackupTriggerSchedule = "schedule" // 定时备份，按保留策略清理
+	BackupTriggerManual   = "manual"   // 手动备份，不会被自动清理
+	BackupTriggerRestore  = "restore"  // 恢复备份前自动创建的安全快照，不会被自动清理
+	BackupTriggerImport   = "import"   // 从备份存储导入，不会被自动清理
+)
+
+// 恢复备份的范围
+const (
+	BackupScopeWorld  = "world"  // 只恢复世界文件
+	BackupScopeConfig = "config" // 只恢复配置文件和世界设置
+	BackupScopeAll    = "all"
+)
+
+// 备份的存储格式
+const (
+	BackupFormatArchive = "archive" // tar.gz 归档（导入的备份）
+	BackupFormatChunked = "chunked" // 分块索引，文件内容按块保存在房间的块存储中，相同的块只保存一份
+)
+
+// Backup 房间备份（世界文件和配置）
+type Backup struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	RoomID      uint      `json:"roomId" gorm:"not null;index"`
+	Trigger     string    `json:"trigger"`
+	Format      string    `json:"format" gorm:"default:archive"`
+	FileName    string    `json:"fileName"`    // 归档或分块索引的文件名
+	Size        int64     `json:"size"`        // 归档或分块索引的大小
+	LogicalSize int64     `json:"logicalSize"` // 备份的文件原始大小之和
+	StoredSize  int64     `json:"storedSize"`  // 本次备份新占用的磁盘空间（分块备份只计新增的块）
+	SHA256      string    `json:"sha256"`
+	WorldName   string    `json:"worldName"`                      // 备份时房间使用的世界
+	Worlds      []string  `json:"worlds" gorm:"serializer:json"`  // 归档中的世界文件（相对房间目录）
+	Configs     []string  `json:"configs" gorm:"serializer:json"` // 归档中的配置文件（相对房间目录）
+	ServerSaved bool      `json:"serverSaved"`                    // 备份前是否让运行中的服务端保存了世界
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"createdAt" gorm:"index"`
+
+	Copies []BackupCopy `json:"copies" gorm:"foreignKey:BackupID"` // 上传到备份存储的副本
+}
+
+func (Backup) TableName() string {
+	return "backups"
+}
+
+// BackupSchedule 房间的定时备份设置
+type BackupSchedule struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	RoomID     uint       `json:"roomId" gorm:"not null;uniqueIndex"`
+	Enabled    bool       `json:"enabled"`
+	Cron       string     `json:"cron"`       // 分 时 日 月 周，按服务器本地时间
+	KeepLast   int        `json:"keepLast"`   // 保留最近 N 个
+	KeepDaily  int        `json:"keepDaily"`  // 最近 N 天每天保留最后一个
+	KeepWeekly int        `json:"keepWeekly"` // 最近 N 周每周保留最后一个
+	NextRunAt  *time.Time `json:"nextRunAt"`
+	LastRunAt  *time.Time `json:"lastRunAt"`
+	LastError  string     `json:"lastError"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+func (BackupSchedule) TableName() string {
+	return "backup_schedules"
+}
+
+// 备份存储类型
+const (
+	BackupTargetLocal = "local" // 本地目录（如挂载的另一块磁盘或网络存储）
+	BackupTargetS3    = "s3"    // S3 兼容的对象存储
+)
+
+// BackupTarget 备份存储，启用后新备份会自动上传
+type BackupTarget struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null;uniqueIndex"`
+	Type      string    `json:"type" gorm:"not null"`
+	Enabled   bool      `json:"enabled"`
+	Path      string    `json:"path"` // local：目录
+	Endpoint  string    `json:"endpoint"`
+	Region    string    `json:"region"`
+	Bucket    string    `json:"bucket"`
+	AccessKey string    `json:"accessKey"`
+	SecretKey string    `json:"-"`
+	PathStyle bool      `json:"pathStyle"`
+	Prefix    string    `json:"prefix"` // 对象键（或目录）前缀
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (BackupTarget) TableName() string {
+	return "backup_targets"
+}
+
+// 备份副本的状态
+const (
+	BackupCopyUploading = "uploading"
+	BackupCopyUploaded  = "uploaded"
+	BackupCopyFailed    = "failed"
+)
+
+// BackupCopy 备份在某个备份存储中的副本
+type BackupCopy struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	BackupID   uint       `json:"backupId" gorm:"not null;index"`
+	TargetID   uint       `json:"targetId" gorm:"not null;index"`
+	Key        string     `json:"key"`    // 在备份存储中的对象键（相对前缀）
+	SHA256     string     `json:"sha256"` // 上传的归档的 SHA-256（分块备份上传时导出为归档）
+	Size       int64      `json:"size"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error"`
+	UploadedAt *time.Time `json:"uploadedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (BackupCopy) TableName() string {
+	return "backup_copies"
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// 配置历史的类型
+const (
+	ConfigKindModConfig = "modconfig"
+	// ConfigKindModConfigScope 手动设置的Mod配置作用域，内容为作用域名称，为空表示清除
+	ConfigKindModConfigScope = "modconfig_scope"
+)
+
+// ConfigRevision 配置文件的历史版本，用于查看改动和回滚
+type ConfigRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RoomID    uint      `json:"roomId" gorm:"not null;index:idx_config_revision_file"`
+	Kind      string    `json:"kind" gorm:"not null;index:idx_config_revision_file"`
+	Path      string    `json:"path" gorm:"not null;index:idx_config_revision_file"` // 相对配置目录的路径
+	Content   string    `json:"content"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (ConfigRevision) TableName() string {
+	return "config_revisions"
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+// 服务端运行时
+const (
+	RuntimeNative = "native" // 可直接执行（含自包含的 .NET 程序）
+	RuntimeDotnet = "dotnet" // 需要 .NET 运行时，入口为 .dll
+	RuntimeMono   = "mono"   // 需要 Mono 运行 .exe（Windows 上直接执行）
+)
+
+// Installation 已安装的服务端版本，由安装任务记录，房间通过 InstallationID 引用
+type Installation struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Name           string     `json:"name"`
+	Type           ServerType `json:"type" gorm:"not null;uniqueIndex:idx_installation_version"`
+	Version        string     `json:"version" gorm:"not null;uniqueIndex:idx_installation_version"`
+	Path           string     `json:"install_dir" gorm:"not null"`
+	EntryBinary    string     `json:"entry_binary"`    // 相对安装目录的启动程序
+	Runtime        string     `json:"runtime"`         // native / dotnet / mono
+	RuntimeVersion string     `json:"runtime_version"` // 需要的 .NET 版本（如 6.0.0），来自 runtimeconfig.json
+	DownloadURL    string     `json:"download_url"`
+	SHA256         string     `json:"sha256"`
+	Verified       bool       `json:"verified"`
+	RoomCount      int64      `json:"room_count" gorm:"-"`    // 引用该版本的房间数
+	RuntimeError   string     `json:"runtime_error" gorm:"-"` // 运行时不可用的原因，为空表示可以启动
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (Installation) TableName() string {
+	return "installations"
+}
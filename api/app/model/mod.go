@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+)
+
+// Mod来源
+const (
+	ModSourceUpload   = "upload"
+	ModSourceWorkshop = "workshop"
+	ModSourceURL      = "url"
+	ModSourceModPack  = "modpack"
+)
+
+// InstalledMod 房间已安装Mod的来源与版本记录（tModLoader）
+type InstalledMod struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	RoomID          uint       `json:"roomId" gorm:"not null;index"`
+	Name            string     `json:"name" gorm:"not null"` // Mod内部名称
+	Version         string     `json:"version"`
+	SHA256          string     `json:"sha256"`
+	Source          string     `json:"source"`    // upload / workshop / url / modpack
+	SourceRef       string     `json:"sourceRef"` // 创意工坊ID、下载地址或模组包ID
+	LatestVersion   string     `json:"latestVersion"`
+	UpdateAvailable bool       `json:"updateAvailable"`
+	CheckedAt       *time.Time `json:"checkedAt"`
+	CheckError      string     `json:"checkError"`
+	PreviousVersion string     `json:"previousVersion"`
+	BackupPath      string     `json:"-"` // 更新前旧 .tmod 的备份
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+func (InstalledMod) TableName() string {
+	return "installed_mods"
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+// ModPack 模组包（一组固定版本的Mod及可选配置文件）
+type ModPack struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	Name              string    `json:"name" gorm:"not null;uniqueIndex:idx_modpack_name_version"`
+	Version           string    `json:"version" gorm:"not null;uniqueIndex:idx_modpack_name_version"`
+	Description       string    `json:"description"`
+	TModLoaderVersion string    `json:"tModLoaderVersion"` // 构建时的tModLoader版本
+	Manifest          string    `json:"manifest"`          // modpack.json 内容
+	ArchivePath       string    `json:"-"`
+	SHA256            string    `json:"sha256"` // 归档文件的 SHA-256
+	Size              int64     `json:"size"`
+	SourceURL         string    `json:"sourceUrl"` // 从URL导入时的来源地址
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+func (ModPack) TableName() string {
+	return "modpacks"
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// RoomPlugin 房间已安装的TShock插件
+type RoomPlugin struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RoomID       uint      `json:"roomId" gorm:"not null;index"`
+	PluginID     string    `json:"pluginId" gorm:"not null"` // 注册表中的插件ID
+	Name         string    `json:"name"`
+	Version      string    `json:"version"`
+	FileName     string    `json:"fileName"` // ServerPlugins 目录下的文件名
+	SHA256       string    `json:"sha256"`
+	Dependencies string    `json:"dependencies"` // 依赖的插件ID，JSON数组
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func (RoomPlugin) TableName() string {
+	return "room_plugins"
+}
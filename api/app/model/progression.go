@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+)
+
+// 进度事件类型
+const (
+	ProgressionEventBoss     = "boss"     // 击败Boss
+	ProgressionEventInvasion = "invasion" // 击退入侵
+	ProgressionEventHardmode = "hardmode" // 进入困难模式
+	ProgressionEventDeath    = "death"    // 玩家死亡
+)
+
+// 进度事件来源
+const (
+	ProgressionSourceLog      = "log"      // 服务端日志，时间为事件发生时间
+	ProgressionSourceSnapshot = "snapshot" // 世界文件快照，时间为发现变化的时间（事件不晚于该时间）
+)
+
+// 快照触发方式
+const (
+	ProgressionTriggerSchedule = "schedule" // 定时记录（运行中的房间）
+	ProgressionTriggerStop     = "stop"     // 服务端退出后
+	ProgressionTriggerManual   = "manual"
+)
+
+// ProgressionSnapshot 房间世界进度快照（定时、停服时或手动记录）
+type ProgressionSnapshot struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RoomID       uint      `json:"roomId" gorm:"not null;index"`
+	WorldName    string    `json:"worldName"`
+	WorldUID     string    `json:"worldUid"` // 世界文件中的唯一ID
+	Trigger      string    `json:"trigger"`
+	Hardmode     bool      `json:"hardmode"`
+	DownedBosses []string  `json:"downedBosses" gorm:"serializer:json"`
+	Invasions    []string  `json:"invasions" gorm:"serializer:json"`
+	Deaths       int64     `json:"deaths"` // 截至快照时记录到的玩家死亡次数
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (ProgressionSnapshot) TableName() string {
+	return "progression_snapshots"
+}
+
+// ProgressionEvent 房间世界进度事件
+type ProgressionEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	RoomID     uint      `json:"roomId" gorm:"not null;index"`
+	WorldName  string    `json:"worldName" gorm:"index"`
+	WorldUID   string    `json:"worldUid"` // 记录时尚未有快照的日志事件为空，之后由快照补全
+	Kind       string    `json:"kind"`     // boss / invasion / hardmode / death
+	Key        string    `json:"key"`      // Boss或入侵标识（如 eyeOfCthulhu），死亡为死因
+	Player     string    `json:"player"`   // 死亡的玩家
+	Message    string    `json:"message"`
+	Source     string    `json:"source"` // log / snapshot
+	OccurredAt time.Time `json:"occurredAt" gorm:"index"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func (ProgressionEvent) TableName() string {
+	return "progression_events"
+}
@@ -35,6 +35,8 @@ type Room struct {
 	MaxPlayers     int          `json:"maxPlayers" gorm:"default:8"`
 	CurrentPlayers int          `json:"currentPlayers" gorm:"default:0"`
 	WorldName      string       `json:"worldName" gorm:"not null"`
+	Version        string       `json:"version"` // 房间运行的服务端版本（如 TShock 5.2.0）
+	InstallationID *uint        `json:"installationId" gorm:"index"` // 运行的服务端安装
 	ProcessPID     int          `json:"processPID" gorm:"default:0"`
 	CreatedAt      time.Time    `json:"createdAt"`
 	UpdatedAt      time.Time    `json:"updatedAt"`
@@ -43,6 +45,11 @@ type Room struct {
 	WorldConfig       *WorldConfig       `json:"worldConfig" gorm:"foreignKey:RoomID"`
 	TShockConfig      *TShockConfig      `json:"tshockConfig" gorm:"foreignKey:RoomID"`
 	TModLoaderConfig  *TModLoaderConfig  `json:"tmodloaderConfig" gorm:"foreignKey:RoomID"`
+	Installation      *Installation      `json:"installation,omitempty" gorm:"foreignKey:InstallationID"`
+
+	// 当前世界文件的头部信息（仅房间详情返回）
+	World      *WorldInfo `json:"world,omitempty" gorm:"-"`
+	WorldError string     `json:"worldError,omitempty" gorm:"-"`
 }
 
 // WorldConfig 世界配置
@@ -79,6 +86,7 @@ type TModLoaderConfig struct {
 	RoomID      uint   `json:"roomId" gorm:"not null;unique"`
 	EnabledMods string `json:"enabledMods"` // JSON数组
 	ModPackURL  string `json:"modPackUrl"`
+	ModPackID   uint   `json:"modPackId"` // 当前应用的模组包
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 }
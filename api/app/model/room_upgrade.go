@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+// 房间升级状态
+const (
+	UpgradeStateRunning    = "running"
+	UpgradeStateSucceeded  = "succeeded"
+	UpgradeStateRolledBack = "rolled_back" // 升级失败，已恢复到升级前的版本和快照
+	UpgradeStateFailed     = "failed"      // 升级和回滚都失败，需要人工处理
+)
+
+// RoomUpgrade 房间服务端版本升级记录
+type RoomUpgrade struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	RoomID             uint       `json:"roomId" gorm:"not null;index"`
+	FromInstallationID *uint      `json:"fromInstallationId"`
+	ToInstallationID   uint       `json:"toInstallationId"`
+	FromVersion        string     `json:"fromVersion"`
+	ToVersion          string     `json:"toVersion"`
+	State              string     `json:"state"`
+	Step               string     `json:"step"` // 当前步骤
+	Warnings           []string   `json:"warnings" gorm:"serializer:json"`
+	Error              string     `json:"error"`
+	SnapshotPath       string     `json:"-"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+	FinishedAt         *time.Time `json:"finishedAt"`
+}
+
+func (RoomUpgrade) TableName() string {
+	return "room_upgrades"
+}
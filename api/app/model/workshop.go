@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+// WorkshopItem 已下载到本地缓存的Steam创意工坊物品
+type WorkshopItem struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	WorkshopID   string    `json:"workshopId" gorm:"not null;uniqueIndex"`
+	Name         string    `json:"name"` // Mod内部名称
+	DisplayName  string    `json:"displayName"`
+	Author       string    `json:"author"`
+	Version      string    `json:"version"` // 最新构建的Mod版本
+	Description  string    `json:"description"`
+	Builds       string    `json:"builds"` // 各tModLoader版本的构建，JSON数组
+	Path         string    `json:"-"`      // 缓存目录
+	Size         int64     `json:"size"`
+	DownloadedAt time.Time `json:"downloadedAt"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func (WorkshopItem) TableName() string {
+	return "workshop_items"
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// WorldInfo .wld 世界文件头部中的信息
+type WorldInfo struct {
+	Release      int32      `json:"release"` // 世界文件版本号（如 279 对应 1.4.4.9）
+	Revision     uint32     `json:"revision"`
+	Name         string     `json:"name"`
+	Seed         string     `json:"seed"`
+	UniqueID     string     `json:"uniqueId"`
+	Width        int32      `json:"width"`  // 横向图格数
+	Height       int32      `json:"height"` // 纵向图格数
+	Size         string     `json:"size"`   // 1=小型, 2=中型, 3=大型，非标准尺寸为空
+	SpawnX       int32      `json:"spawnX"`
+	SpawnY       int32      `json:"spawnY"`
+	SurfaceLevel float64    `json:"surfaceLevel"` // 地表层的图格高度
+	RockLevel    float64    `json:"rockLevel"`    // 岩石层（洞穴）的图格高度
+	Difficulty   string     `json:"difficulty"`   // 0=普通, 1=专家, 2=大师, 3=旅途
+	Evil         string     `json:"evil"`         // corruption / crimson
+	Hardmode     bool       `json:"hardmode"`
+	SpecialSeeds []string   `json:"specialSeeds"` // drunk / getGoodWorld / tenthAnniversary / dontStarve / notTheBees / remix / noTraps / zenith
+	CreatedAt    *time.Time `json:"createdAt"`    // 1.3 之前的世界没有记录
+	PlayTime     *int64     `json:"playTime"`     // 游玩时长（秒），世界文件中没有记录，始终为空
+	DayTime      bool       `json:"dayTime"`
+	Time         float64    `json:"time"` // 游戏内时间（当前昼夜已经过的刻数）
+	DownedBosses []string   `json:"downedBosses"`
+	Invasions    []string   `json:"invasions"` // 已击退的入侵事件
+}
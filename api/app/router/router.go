@@ -17,6 +17,12 @@ func SetupRouter(r *gin.Engine, staticPath string, enableStatic bool) {
 	fileController := controller.NewFileController()
 	modController := controller.NewModController()
 	installController := controller.NewInstallController()
+	pluginController := controller.NewPluginController()
+	modPackController := controller.NewModPackController()
+	worldController := controller.NewWorldController()
+	progressionController := controller.NewProgressionController()
+	backupController := controller.NewBackupController()
+	backupTargetController := controller.NewBackupTargetController()
 
 	// API分组
 	api := r.Group("/api")
@@ -39,6 +45,9 @@ func SetupRouter(r *gin.Engine, staticPath string, enableStatic bool) {
 			rooms.POST("/:id/stop", roomController.StopServer)          // 停止服务器
 			rooms.POST("/:id/restart", roomController.RestartServer)    // 重启服务器
 			rooms.GET("/:id/status", roomController.GetServerStatus)    // 获取服务器状态
+			rooms.POST("/:id/upgrade", roomController.UpgradeRoom)       // 升级服务端版本（失败自动回滚）
+			rooms.GET("/:id/upgrades", roomController.GetRoomUpgrades)   // 升级记录
+			rooms.GET("/:id/upgrades/:upgradeId", roomController.GetRoomUpgrade) // 升级状态与结果
 
 			// TShock配置管理
 			rooms.GET("/:id/tshock/config", tshockController.GetTShockConfig)       // 获取TShock配置
@@ -52,45 +61,120 @@ func SetupRouter(r *gin.Engine, staticPath string, enableStatic bool) {
 			rooms.POST("/:id/files/save", fileController.SaveFile)          // 保存文件
 			rooms.DELETE("/:id/files", fileController.DeleteFile)           // 删除文件
 			rooms.POST("/:id/files/upload", fileController.UploadFile)      // 上传文件
+
+			// 插件管理 (TShock)
+			rooms.GET("/:id/plugins", pluginController.GetPlugins)                  // 获取已安装插件
+			rooms.POST("/:id/plugins/plan", pluginController.PlanInstall)           // 生成安装计划
+			rooms.POST("/:id/plugins", pluginController.InstallPlugins)             // 安装插件及依赖
+			rooms.DELETE("/:id/plugins/:pluginId", pluginController.UninstallPlugin) // 卸载插件
+			rooms.GET("/:id/plugins/configs", pluginController.GetPluginConfigs)      // 获取插件配置文件列表
+			rooms.GET("/:id/plugins/configs/file", pluginController.GetPluginConfig)  // 读取插件配置
+			rooms.PUT("/:id/plugins/configs/file", pluginController.UpdatePluginConfig) // 保存插件配置并重载
+
+			// Mod管理 (tModLoader)
+			rooms.GET("/:id/mods", modController.GetMods)              // 获取房间Mod列表
+			rooms.POST("/:id/mods", modController.InstallMod)          // 上传Mod
+			rooms.POST("/:id/mods/workshop", modController.InstallWorkshopMod) // 从Workshop安装Mod
+			rooms.POST("/:id/mods/url", modController.InstallURLMod)       // 从URL安装Mod
+			rooms.GET("/:id/mods/updates", modController.GetModUpdates)    // 获取Mod来源与更新状态
+			rooms.POST("/:id/mods/updates/check", modController.CheckModUpdates) // 立即检查Mod更新
+			rooms.POST("/:id/mods/:name/update", modController.UpdateMod)  // 更新Mod（旧版本自动备份）
+			rooms.POST("/:id/mods/:name/rollback", modController.RollbackMod) // 回滚到更新前的版本
+			rooms.GET("/:id/mods/configs", modController.GetModConfigs)         // 获取Mod配置文件列表
+			rooms.GET("/:id/mods/configs/file", modController.GetModConfig)     // 读取Mod配置
+			rooms.PUT("/:id/mods/configs/file", modController.UpdateModConfig)  // 保存Mod配置
+			rooms.PUT("/:id/mods/configs/scope", modController.SetModConfigScope) // 手动设置Mod配置作用域
+			rooms.GET("/:id/mods/configs/history", modController.GetModConfigHistory) // 获取Mod配置历史
+			rooms.POST("/:id/mods/configs/history/:revisionId/revert", modController.RevertModConfig) // 恢复到历史版本
+			rooms.PUT("/:id/mods/:name", modController.ToggleMod)      // 启用/禁用Mod
+			rooms.DELETE("/:id/mods/:name", modController.DeleteMod)   // 删除Mod
+
+			// 世界管理
+			rooms.GET("/:id/worlds", worldController.GetWorlds)                     // 获取世界列表
+			rooms.POST("/:id/worlds", worldController.UploadWorld)                  // 上传世界
+			rooms.PUT("/:id/worlds/active", worldController.SwitchWorld)            // 切换房间使用的世界
+			rooms.GET("/:id/worlds/:name/download", worldController.DownloadWorld)  // 下载世界
+			rooms.GET("/:id/worlds/:name/map", worldController.GetWorldMap)         // 获取世界地图（PNG）
+			rooms.POST("/:id/worlds/:name/map", worldController.RenderWorldMap)     // 渲染世界地图
+			rooms.DELETE("/:id/worlds/:name", worldController.DeleteWorld)          // 删除世界
+
+			// 世界进度
+			rooms.GET("/:id/progression", progressionController.GetProgression)              // 当前世界的Boss、入侵和死亡统计
+			rooms.GET("/:id/progression/timeline", progressionController.GetTimeline)        // 进度快照和事件
+			rooms.POST("/:id/progression/snapshot", progressionController.CaptureSnapshot)   // 立即记录进度快照
+
+			// 备份
+			rooms.GET("/:id/backups", backupController.GetBackups)                              // 获取备份列表
+			rooms.POST("/:id/backups", backupController.CreateBackup)                           // 立即备份
+			rooms.GET("/:id/backups/schedule", backupController.GetSchedule)                    // 获取定时备份设置
+			rooms.PUT("/:id/backups/schedule", backupController.UpdateSchedule)                 // 保存定时备份设置
+			rooms.GET("/:id/backups/usage", backupController.GetUsage)                          // 原始大小与实际占用空间
+			rooms.POST("/:id/backups/verify", backupController.VerifyBackups)                   // 检查备份块是否完整
+			rooms.GET("/:id/backups/:backupId/download", backupController.DownloadBackup)       // 下载备份
+			rooms.POST("/:id/backups/:backupId/restore", backupController.RestoreBackup)        // 恢复备份
+			rooms.POST("/:id/backups/:backupId/clone", backupController.CloneBackup)            // 从备份创建新房间
+			rooms.POST("/:id/backups/:backupId/copies", backupController.UploadBackupCopy)      // 上传到备份存储
+			rooms.DELETE("/:id/backups/:backupId", backupController.DeleteBackup)               // 删除备份
 		}
 
 		// Mod市场
 		mods := api.Group("/terraria/mods")
 		{
-			mods.GET("/workshop/search", modController.SearchWorkshopMods)  // 搜索Workshop模组
+			mods.GET("/workshop/search", modController.SearchWorkshopMods)    // 搜索已下载的Workshop模组
+			mods.POST("/workshop/download", modController.DownloadWorkshopMod) // 通过steamcmd下载Workshop模组
 			mods.GET("/popular", modController.GetPopularMods)              // 获取热门模组
 		}
 
+		// 模组包
+		modPacks := api.Group("/terraria/modpacks")
+		{
+			modPacks.GET("", modPackController.GetModPacks)                   // 获取模组包列表
+			modPacks.GET("/:id", modPackController.GetModPackDetail)          // 获取模组包详情
+			modPacks.POST("/build", modPackController.BuildModPack)           // 从房间构建模组包
+			modPacks.POST("/import", modPackController.ImportModPack)         // 导入模组包
+			modPacks.POST("/:id/apply", modPackController.ApplyModPack)       // 应用到房间
+			modPacks.GET("/:id/download", modPackController.DownloadModPack)  // 下载模组包
+			modPacks.DELETE("/:id", modPackController.DeleteModPack)          // 删除模组包
+		}
+
+		// 所有房间的备份空间占用
+		api.GET("/terraria/backups/usage", backupController.GetAllUsage) // 各房间备份的原始大小与实际占用
+
+		// 备份存储
+		backupTargets := api.Group("/terraria/backup-targets")
+		{
+			backupTargets.GET("", backupTargetController.GetTargets)                   // 获取备份存储列表
+			backupTargets.POST("", backupTargetController.CreateTarget)                // 添加备份存储
+			backupTargets.PUT("/:id", backupTargetController.UpdateTarget)             // 修改备份存储
+			backupTargets.DELETE("/:id", backupTargetController.DeleteTarget)          // 删除备份存储
+			backupTargets.POST("/:id/test", backupTargetController.TestTarget)         // 检查能否写入
+			backupTargets.GET("/:id/backups", backupTargetController.GetTargetBackups) // 存储中的备份归档
+			backupTargets.POST("/:id/import", backupTargetController.ImportBackup)     // 导入备份到房间
+		}
+
+		// 房间进度对比
+		api.GET("/terraria/progression/compare", progressionController.CompareProgression) // 对比多个房间的进度
+
 		// TShock插件库
-		api.GET("/terraria/plugins", modController.GetTShockPlugins)  // 获取插件库
+		api.GET("/terraria/plugins", modController.GetTShockPlugins)              // 获取插件库
+		api.POST("/terraria/plugins/refresh", modController.RefreshTShockPlugins) // 刷新插件注册表
 
 		// 游戏安装管理
 		install := api.Group("/terraria/install")
 		{
 			install.GET("/versions", installController.GetVersions)       // 获取可用版本列表
+			install.POST("/versions/refresh", installController.RefreshVersions) // 刷新版本目录
 			install.POST("/game", installController.InstallGame)          // 安装游戏
 			install.GET("/status", installController.GetInstallStatus)    // 获取安装状态
 			install.DELETE("/game", installController.UninstallGame)      // 卸载游戏
+			install.GET("/jobs", installController.GetInstallJobs)        // 安装任务列表
+			install.GET("/jobs/:id", installController.GetInstallJob)     // 安装任务状态
+			install.GET("/jobs/:id/events", installController.StreamInstallJob) // 安装进度（SSE）
+			install.POST("/jobs/:id/cancel", installController.CancelInstallJob) // 取消安装任务
+			install.GET("/runtimes", installController.GetRuntimes)        // 检测到的 .NET / Mono 运行时
+			install.POST("/runtimes", installController.InstallRuntime)    // 安装私有 .NET 运行时（管理员）
 		}
 
-		// TODO: 插件管理 (TShock) - 需要实现具体房间的插件安装
-		// plugins := api.Group("/terraria/rooms/:roomId/plugins")
-		// {
-		//     plugins.GET("", pluginController.GetPlugins)
-		//     plugins.POST("", pluginController.InstallPlugin)
-		//     plugins.PUT("/:id", pluginController.TogglePlugin)
-		//     plugins.DELETE("/:id", pluginController.DeletePlugin)
-		// }
-
-		// TODO: Mod管理 (TModLoader) - 需要实现具体房间的Mod安装
-		// roomMods := api.Group("/terraria/rooms/:roomId/mods")
-		// {
-		//     roomMods.GET("", modController.GetMods)
-		//     roomMods.POST("", modController.InstallMod)
-		//     roomMods.PUT("/:id", modController.ToggleMod)
-		//     roomMods.DELETE("/:id", modController.DeleteMod)
-		// }
-
 		// TODO: 玩家管理
 		// players := api.Group("/terraria/rooms/:roomId/players")
 		// {
@@ -99,15 +183,6 @@ func SetupRouter(r *gin.Engine, staticPath string, enableStatic bool) {
 		//     players.POST("/:id/ban", playerController.BanPlayer)
 		// }
 
-		// TODO: 世界管理
-		// worlds := api.Group("/terraria/rooms/:roomId/worlds")
-		// {
-		//     worlds.GET("", worldController.GetWorlds)
-		//     worlds.POST("", worldController.UploadWorld)
-		//     worlds.GET("/:name/download", worldController.DownloadWorld)
-		//     worlds.DELETE("/:name", worldController.DeleteWorld)
-		// }
-
 		// TODO: 控制台
 		// console := api.Group("/terraria/rooms/:roomId/console")
 		// {
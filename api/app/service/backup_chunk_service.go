@@ -0,0 +1,542 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// 分块索引的格式版本
+const backupIndexVersion = 1
+
+// backupIndex 分块备份的索引：清单和每个文件由哪些块组成
+type backupIndex struct {
+	Version  int               `json:"version"`
+	Manifest *BackupManifest   `json:"manifest"`
+	Files    []backupIndexFile `json:"files"`
+}
+
+// backupIndexFile 索引中的文件
+type backupIndexFile struct {
+	Path    string    `json:"path"` // 相对房间目录
+	Size    int64     `json:"size"`
+	Mode    int64     `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+	Chunks  []string  `json:"chunks"` // 块的 SHA-256，按顺序拼接即为文件内容
+}
+
+// chunkedBackupResult 写入分块备份的结果
+type chunkedBackupResult struct {
+	manifest    *BackupManifest
+	sha256      string // 索引文件的 SHA-256
+	size        int64  // 索引文件的大小
+	logicalSize int64
+	storedSize  int64 // 新写入的块和索引的大小
+}
+
+// BackupVerifyResult 备份完整性检查结果
+type BackupVerifyResult struct {
+	RoomID         uint     `json:"roomId"`
+	Chunks         int      `json:"chunks"`         // 检查的块数
+	CorruptChunks  []string `json:"corruptChunks"`  // 内容与哈希不一致的块（已删除，之后的备份遇到相同内容会重新写入）
+	MissingChunks  []string `json:"missingChunks"`  // 备份引用但不存在的块
+	Backups        int      `json:"backups"`        // 检查的备份数
+	DamagedBackups []uint   `json:"damagedBackups"` // 无法完整恢复的备份
+	OK             bool     `json:"ok"`
+}
+
+// BackupUsage 房间备份的空间占用
+type BackupUsage struct {
+	RoomID       uint    `json:"roomId"`
+	RoomName     string  `json:"roomName"`
+	Backups      int     `json:"backups"`
+	LogicalSize  int64   `json:"logicalSize"`  // 各备份文件原始大小之和（不去重时需要的空间）
+	PhysicalSize int64   `json:"physicalSize"` // 备份目录实际占用：块、索引和归档
+	ChunkCount   int     `json:"chunkCount"`
+	ChunkSize    int64   `json:"chunkSize"`
+	Ratio        float64 `json:"ratio"` // LogicalSize / PhysicalSize
+}
+
+// chunkStore 房间的块存储：chunks/<哈希前两位>/<SHA-256>，块内容用 deflate 压缩保存
+// 同一房间的所有备份共用，相同内容的块只保存一份
+type chunkStore struct {
+	dir string
+}
+
+func roomChunkStore(roomId uint) *chunkStore {
+	return &chunkStore{dir: filepath.Join(getRoomBackupDir(roomId), "chunks")}
+}
+
+func (cs *chunkStore) path(hash string) string {
+	return filepath.Join(cs.dir, hash[:2], hash)
+}
+
+// isChunkHash 是否为合法的块哈希（64 位小写十六进制），防止索引被篡改后访问其他路径
+func isChunkHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// put 保存一个块，已存在时跳过，返回新写入的字节数
+func (cs *chunkStore) put(hash string, data []byte) (int64, error) {
+	target := cs.path(hash)
+	if _, err := os.Stat(target); err == nil {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".chunk-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	fw, _ := flate.NewWriter(tmp, flate.BestSpeed)
+	if _, err := fw.Write(data); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := fw.Close(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// read 读取一个块并校验 SHA-256
+func (cs *chunkStore) read(hash string) ([]byte, error) {
+	if !isChunkHash(hash) {
+		return nil, fmt.Errorf("无效的块: %s", hash)
+	}
+	f, err := os.Open(cs.path(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("块 %s 缺失", hash[:12])
+		}
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(f), utils.ChunkMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("块 %s 已损坏: %w", hash[:12], err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("块 %s 已损坏: 内容与哈希不一致", hash[:12])
+	}
+	return data, nil
+}
+
+// addFile 切分文件并保存新的块，返回索引条目和新写入的字节数
+func (cs *chunkStore) addFile(p, rel string) (*backupIndexFile, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entry := &backupIndexFile{Path: rel, Mode: int64(info.Mode().Perm()), ModTime: info.ModTime(), Chunks: []string{}}
+	fileHash := sha256.New()
+	// 按打开时的大小读取，避免文件同时被追加时内容与大小不一致
+	chunker := utils.NewChunker(io.TeeReader(io.LimitReader(f, info.Size()), fileHash))
+	var stored int64
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		n, err := cs.put(hash, chunk)
+		if err != nil {
+			return nil, 0, err
+		}
+		stored += n
+		entry.Size += int64(len(chunk))
+		entry.Chunks = append(entry.Chunks, hash)
+	}
+	entry.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+	return entry, stored, nil
+}
+
+// writeChunkedBackup 把房间的世界文件和配置写入块存储，并把索引写到 target
+func writeChunkedBackup(room *model.Room, target string, now time.Time) (*chunkedBackupResult, error) {
+	manifest, files, err := collectBackupFiles(room, now)
+	if err != nil {
+		return nil, err
+	}
+	store := roomChunkStore(room.ID)
+	roomDir := getRoomDir(room.ID)
+	index := &backupIndex{Version: backupIndexVersion, Manifest: manifest, Files: make([]backupIndexFile, 0, len(files))}
+	result := &chunkedBackupResult{manifest: manifest}
+	for _, rel := range files {
+		entry, stored, err := store.addFile(filepath.Join(roomDir, filepath.FromSlash(rel)), rel)
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", rel, err)
+		}
+		index.Files = append(index.Files, *entry)
+		result.logicalSize += entry.Size
+		result.storedSize += stored
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(target, data, 0644); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	result.sha256 = hex.EncodeToString(sum[:])
+	result.size = int64(len(data))
+	result.storedSize += result.size
+	return result, nil
+}
+
+// loadBackupIndex 读取分块备份的索引并校验 SHA-256
+func (s *BackupService) loadBackupIndex(backup *model.Backup) (*backupIndex, error) {
+	data, err := os.ReadFile(s.BackupFilePath(backup))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("备份索引不存在")
+		}
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); backup.SHA256 != "" && hex.EncodeToString(sum[:]) != backup.SHA256 {
+		return nil, errors.New("备份索引校验失败，文件可能已损坏")
+	}
+	var index backupIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("备份索引格式错误: %w", err)
+	}
+	if index.Version > backupIndexVersion || index.Manifest == nil {
+		return nil, errors.New("不支持的备份索引版本")
+	}
+	return &index, nil
+}
+
+// exportChunkedArchive 把分块备份导出为与普通备份相同格式的 tar.gz 临时文件（调用方负责删除）
+// 导出时校验每个块和每个文件的 SHA-256
+func (s *BackupService) exportChunkedArchive(backup *model.Backup) (string, error) {
+	index, err := s.loadBackupIndex(backup)
+	if err != nil {
+		return "", err
+	}
+	tmpRoot := filepath.Join(config.GlobalConfig.DataPath, "backups")
+	if err := os.MkdirAll(tmpRoot, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(tmpRoot, ".export-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	err = writeIndexArchive(tmp, index, roomChunkStore(backup.RoomID))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// writeIndexArchive 按索引从块存储读取文件，写出 tar.gz（第一个文件为 backup.json）
+func writeIndexArchive(w io.Writer, index *backupIndex, store *chunkStore) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	manifest, err := json.MarshalIndent(index.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: backupManifestName, Mode: 0644, Size: int64(len(manifest)), ModTime: index.Manifest.CreatedAt, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, file := range index.Files {
+		if !utils.IsSafeArchivePath(file.Path) {
+			return fmt.Errorf("备份索引中的路径无效: %s", file.Path)
+		}
+		header := &tar.Header{Name: file.Path, Mode: file.Mode, Size: file.Size, ModTime: file.ModTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		fileHash := sha256.New()
+		for _, hash := range file.Chunks {
+			data, err := store.read(hash)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file.Path, err)
+			}
+			fileHash.Write(data)
+			if _, err := tw.Write(data); err != nil {
+				return fmt.Errorf("%s: %w", file.Path, err)
+			}
+		}
+		if hex.EncodeToString(fileHash.Sum(nil)) != file.SHA256 {
+			return fmt.Errorf("%s: 文件校验失败", file.Path)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// pruneChunks 删除房间块存储中不再被任何备份引用的块，返回删除的块数和释放的空间
+// 房间正在备份或恢复时跳过（下次清理时再删除）；有索引无法读取时不删除任何块
+func (s *BackupService) pruneChunks(roomId uint) (int, int64, error) {
+	if !s.lock(roomId) {
+		return 0, 0, nil
+	}
+	defer s.unlock(roomId)
+
+	referenced, err := s.referencedChunks(roomId)
+	if err != nil {
+		return 0, 0, err
+	}
+	store := roomChunkStore(roomId)
+	removed, freed := 0, int64(0)
+	err = filepath.WalkDir(store.dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || referenced[d.Name()] || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return removed, freed, err
+	}
+	return removed, freed, nil
+}
+
+// referencedChunks 房间所有分块备份引用的块
+func (s *BackupService) referencedChunks(roomId uint) (map[string]bool, error) {
+	var backups []model.Backup
+	if err := utils.DB.Where("room_id = ? AND format = ?", roomId, model.BackupFormatChunked).Find(&backups).Error; err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	for i := range backups {
+		index, err := s.loadBackupIndex(&backups[i])
+		if err != nil {
+			return nil, fmt.Errorf("备份 #%d: %w", backups[i].ID, err)
+		}
+		for _, file := range index.Files {
+			for _, hash := range file.Chunks {
+				referenced[hash] = true
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// collectRoomChunks 清理块存储并记录日志（删除备份后调用）
+func (s *BackupService) collectRoomChunks(roomId uint) {
+	removed, freed, err := s.pruneChunks(roomId)
+	if err != nil {
+		log.Printf("⚠️ 清理房间 %d 的备份块失败: %v", roomId, err)
+	} else if removed > 0 {
+		log.Printf("✅ 已清理房间 %d 的 %d 个未使用的备份块（%.1f MB）", roomId, removed, float64(freed)/1024/1024)
+	}
+}
+
+// VerifyBackups 检查房间块存储中每个块的内容，以及每个备份能否完整恢复
+// 损坏的块会被删除，之后的备份遇到相同内容时重新写入
+func (s *BackupService) VerifyBackups(roomId uint) (*BackupVerifyResult, error) {
+	if _, err := getWorldRoom(roomId); err != nil {
+		return nil, err
+	}
+	if !s.lock(roomId) {
+		return nil, errors.New("房间正在备份或恢复中，请稍后再试")
+	}
+	defer s.unlock(roomId)
+
+	result := &BackupVerifyResult{RoomID: roomId, CorruptChunks: []string{}, MissingChunks: []string{}, DamagedBackups: []uint{}}
+	store := roomChunkStore(roomId)
+	present := map[string]bool{}
+	err := filepath.WalkDir(store.dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		result.Chunks++
+		if _, err := store.read(d.Name()); err != nil {
+			result.CorruptChunks = append(result.CorruptChunks, d.Name())
+			return os.Remove(p)
+		}
+		present[d.Name()] = true
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var backups []model.Backup
+	if err := utils.DB.Where("room_id = ?", roomId).Order("created_at DESC").Find(&backups).Error; err != nil {
+		return nil, err
+	}
+	missing := map[string]bool{}
+	for i := range backups {
+		backup := &backups[i]
+		result.Backups++
+		if !s.verifyBackupData(backup, present, missing) {
+			result.DamagedBackups = append(result.DamagedBackups, backup.ID)
+		}
+	}
+	for hash := range missing {
+		result.MissingChunks = append(result.MissingChunks, hash)
+	}
+	sort.Strings(result.MissingChunks)
+	result.OK = len(result.CorruptChunks) == 0 && len(result.DamagedBackups) == 0
+
+	if result.OK {
+		log.Printf("✅ 房间 %d 的备份检查通过（%d 个备份，%d 个块）", roomId, result.Backups, result.Chunks)
+	} else {
+		log.Printf("⚠️ 房间 %d 的备份检查发现问题: %d 个损坏的块，%d 个无法完整恢复的备份", roomId, len(result.CorruptChunks), len(result.DamagedBackups))
+	}
+	return result, nil
+}
+
+// verifyBackupData 分块备份检查索引和引用的块，归档备份检查 SHA-256，缺失的块记录到 missing
+func (s *BackupService) verifyBackupData(backup *model.Backup, present, missing map[string]bool) bool {
+	if backup.Format != model.BackupFormatChunked {
+		sum, _, err := fileSHA256(s.BackupFilePath(backup))
+		return err == nil && (backup.SHA256 == "" || sum == backup.SHA256)
+	}
+	index, err := s.loadBackupIndex(backup)
+	if err != nil {
+		return false
+	}
+	ok := true
+	for _, file := range index.Files {
+		for _, hash := range file.Chunks {
+			if !present[hash] {
+				missing[hash] = true
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// GetUsage 房间备份的原始大小和实际占用的空间
+func (s *BackupService) GetUsage(roomId uint) (*BackupUsage, error) {
+	room, err := getWorldRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+	return roomBackupUsage(room)
+}
+
+// ListUsage 所有房间备份的空间占用
+func (s *BackupService) ListUsage() ([]BackupUsage, error) {
+	var rooms []model.Room
+	if err := utils.DB.Order("id").Find(&rooms).Error; err != nil {
+		return nil, err
+	}
+	usages := make([]BackupUsage, 0, len(rooms))
+	for i := range rooms {
+		usage, err := roomBackupUsage(&rooms[i])
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, *usage)
+	}
+	return usages, nil
+}
+
+func roomBackupUsage(room *model.Room) (*BackupUsage, error) {
+	usage := &BackupUsage{RoomID: room.ID, RoomName: room.Name}
+	var backups []model.Backup
+	if err := utils.DB.Where("room_id = ?", room.ID).Find(&backups).Error; err != nil {
+		return nil, err
+	}
+	usage.Backups = len(backups)
+	for _, backup := range backups {
+		if backup.LogicalSize > 0 {
+			usage.LogicalSize += backup.LogicalSize
+		} else {
+			usage.LogicalSize += backup.Size // 导入的归档没有记录原始大小
+		}
+	}
+
+	chunksDir := roomChunkStore(room.ID).dir
+	err := filepath.WalkDir(getRoomBackupDir(room.ID), func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		usage.PhysicalSize += info.Size()
+		if strings.HasPrefix(p, chunksDir+string(filepath.Separator)) {
+			usage.ChunkCount++
+			usage.ChunkSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if usage.PhysicalSize > 0 {
+		usage.Ratio = float64(usage.LogicalSize) / float64(usage.PhysicalSize)
+	}
+	return usage, nil
+}
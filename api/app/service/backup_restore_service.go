@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// 停止服务器后等待进程退出的最长时间
+const restoreStopTimeout = 15 * time.Second
+
+// RestoreResult 恢复备份的结果
+type RestoreResult struct {
+	BackupID      uint          `json:"backupId"`
+	Scope         string        `json:"scope"`
+	SafetyBackup  *model.Backup `json:"safetyBackup"` // 恢复前房间状态的快照，房间没有可备份的文件时为空
+	RestoredFiles []string      `json:"restoredFiles"`
+	WorldName     string        `json:"worldName"` // 恢复后房间使用的世界
+	Restarted     bool          `json:"restarted"` // 恢复前运行中的房间已重新启动
+	Warnings      []string      `json:"warnings"`
+}
+
+// CloneBackupRequest 从备份创建新房间的参数
+type CloneBackupRequest struct {
+	Name string `json:"name"` // 为空时使用“原房间名 (副本)”
+	Port int    `json:"port" binding:"required"`
+}
+
+// CloneResult 从备份创建的房间
+type CloneResult struct {
+	Room     *model.Room `json:"room"`
+	BackupID uint        `json:"backupId"`
+	Warnings []string    `json:"warnings"`
+}
+
+// Restore 将备份恢复到房间：停止服务器、创建安全快照、写入备份中的文件，原来运行中的房间恢复后重新启动
+// 备份中没有的文件保持不变；恢复文件失败时用安全快照回滚
+func (s *BackupService) Restore(roomId, backupId uint, scope string) (*RestoreResult, error) {
+	if scope == "" {
+		scope = model.BackupScopeAll
+	}
+	if scope != model.BackupScopeWorld && scope != model.BackupScopeConfig && scope != model.BackupScopeAll {
+		return nil, fmt.Errorf("无效的恢复范围: %s", scope)
+	}
+	if !s.lock(roomId) {
+		return nil, errors.New("房间正在备份或恢复中，请稍后再试")
+	}
+	defer s.unlock(roomId)
+
+	backup, err := s.GetBackup(roomId, backupId)
+	if err != nil {
+		return nil, err
+	}
+	room, err := NewRoomService().GetRoomByID(roomId)
+	if err != nil {
+		return nil, errors.New("房间不存在")
+	}
+	if room.Status == model.StatusStarting || room.Status == model.StatusStopping {
+		return nil, fmt.Errorf("房间正在%s，请稍后再试", map[model.ServerStatus]string{model.StatusStarting: "启动", model.StatusStopping: "停止"}[room.Status])
+	}
+
+	// 先校验并解压备份，失败时不影响房间
+	stageDir, manifest, err := s.openBackup(backup)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stageDir)
+	files := backupScopeFiles(manifest, scope)
+	if len(files) == 0 {
+		return nil, errors.New("备份中没有该范围的文件")
+	}
+
+	result := &RestoreResult{BackupID: backup.ID, Scope: scope, RestoredFiles: files, WorldName: room.WorldName, Warnings: []string{}}
+	wasRunning := room.Status == model.StatusRunning
+	if wasRunning {
+		// 先保存世界，使安全快照包含停止前的进度
+		if _, err := saveRunningWorld(room, backupSaveTimeout); err != nil {
+			result.Warnings = append(result.Warnings, "停止前保存世界失败，安全快照为最近一次保存的世界: "+err.Error())
+		}
+		if err := NewRoomService().StopServer(roomId); err != nil {
+			return nil, fmt.Errorf("停止服务器失败: %w", err)
+		}
+		waitProcessExit(roomId, restoreStopTimeout)
+	}
+
+	restart := func() {
+		if !wasRunning {
+			return
+		}
+		if err := NewRoomService().StartServer(roomId); err != nil {
+			result.Warnings = append(result.Warnings, "重新启动服务器失败: "+err.Error())
+			return
+		}
+		result.Restarted = true
+	}
+
+	safety, err := s.createBackup(room, model.BackupTriggerRestore, fmt.Sprintf("恢复备份 #%d 前自动创建", backup.ID), wasRunning)
+	if err != nil && !errors.Is(err, errNothingToBackup) {
+		restart()
+		return nil, fmt.Errorf("创建安全快照失败，未恢复: %w", err)
+	}
+	result.SafetyBackup = safety
+
+	if err := applyBackupFiles(stageDir, getRoomDir(roomId), files); err != nil {
+		err = fmt.Errorf("恢复文件失败: %w", err)
+		if safety != nil {
+			if rollbackErr := s.rollbackRestore(safety); rollbackErr != nil {
+				err = fmt.Errorf("%w；回滚失败: %v", err, rollbackErr)
+			}
+		}
+		restart()
+		return nil, err
+	}
+
+	warnings, err := applyBackupSettings(room, manifest, scope)
+	result.Warnings = append(result.Warnings, warnings...)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "恢复房间设置失败: "+err.Error())
+	}
+	result.WorldName = room.WorldName
+
+	restart()
+	log.Printf("✅ 房间 %s (ID:%d) 已从备份 #%d 恢复（%s，%d 个文件）", room.Name, roomId, backup.ID, scope, len(files))
+	return result, nil
+}
+
+// Clone 用备份中的房间设置和文件创建新房间
+func (s *BackupService) Clone(roomId, backupId uint, req CloneBackupRequest) (*CloneResult, error) {
+	backup, err := s.GetBackup(roomId, backupId)
+	if err != nil {
+		return nil, err
+	}
+	roomService := NewRoomService()
+	if roomService.IsPortInUse(req.Port) {
+		return nil, errors.New("端口已被占用")
+	}
+
+	stageDir, manifest, err := s.openBackup(backup)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stageDir)
+	if manifest.Room == nil {
+		return nil, errors.New("备份中没有房间设置，无法克隆")
+	}
+
+	result := &CloneResult{BackupID: backup.ID, Warnings: []string{}}
+	source := manifest.Room
+	room := &model.Room{
+		Name:       req.Name,
+		Type:       source.Type,
+		Port:       req.Port,
+		Password:   source.Password,
+		MaxPlayers: source.MaxPlayers,
+		WorldName:  manifest.WorldName,
+	}
+	if room.Name == "" {
+		room.Name = source.Name + " (副本)"
+	}
+	// 原来的安装已卸载时使用该类型最新的安装
+	if source.InstallationID != nil {
+		if _, err := NewInstallationService().Get(*source.InstallationID); err == nil {
+			room.InstallationID = source.InstallationID
+		} else {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("备份使用的 %s %s 已卸载，新房间使用该类型最新的安装", source.Type, source.Version))
+		}
+	}
+
+	created, err := roomService.CreateRoom(room)
+	if err != nil {
+		return nil, err
+	}
+	// 世界设置单独写入，避免随房间一起创建关联记录时重复插入
+	if source.WorldConfig != nil {
+		worldConfig := *source.WorldConfig
+		worldConfig.ID, worldConfig.RoomID = 0, created.ID
+		worldConfig.CreatedAt, worldConfig.UpdatedAt = time.Time{}, time.Time{}
+		if err := utils.DB.Create(&worldConfig).Error; err != nil {
+			roomService.DeleteRoom(created.ID)
+			return nil, fmt.Errorf("保存世界设置失败: %w", err)
+		}
+		created.WorldConfig = &worldConfig
+	}
+	if err := applyBackupFiles(stageDir, getRoomDir(created.ID), backupScopeFiles(manifest, model.BackupScopeAll)); err != nil {
+		roomService.DeleteRoom(created.ID)
+		os.RemoveAll(getRoomDir(created.ID))
+		return nil, fmt.Errorf("写入房间文件失败: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(stageDir, "tshock", "config.json")); err == nil {
+		result.Warnings = append(result.Warnings, "tshock/config.json 与原房间相同，同时运行两个房间前请修改 REST 接口端口")
+	}
+
+	result.Room = created
+	log.Printf("✅ 已从房间 %d 的备份 #%d 创建房间 %s (ID:%d)", roomId, backup.ID, created.Name, created.ID)
+	return result, nil
+}
+
+// openBackup 校验备份归档并解压到临时目录，返回目录和清单（调用方负责删除目录）
+func (s *BackupService) openBackup(backup *model.Backup) (string, *BackupManifest, error) {
+	archivePath, cleanup, err := s.OpenArchive(backup)
+	if err != nil {
+		return "", nil, err
+	}
+	defer cleanup()
+	// 分块备份导出时已逐块校验
+	if backup.Format != model.BackupFormatChunked {
+		sum, _, err := fileSHA256(archivePath)
+		if err != nil {
+			return "", nil, fmt.Errorf("读取备份失败: %w", err)
+		}
+		if backup.SHA256 != "" && sum != backup.SHA256 {
+			return "", nil, errors.New("备份文件校验失败，文件可能已损坏")
+		}
+	}
+
+	tmpRoot := filepath.Join(config.GlobalConfig.DataPath, "backups")
+	if err := os.MkdirAll(tmpRoot, 0755); err != nil {
+		return "", nil, err
+	}
+	stageDir, err := os.MkdirTemp(tmpRoot, ".restore-*")
+	if err != nil {
+		return "", nil, err
+	}
+	if err := utils.ExtractArchive(context.Background(), archivePath, stageDir, utils.ExtractOptions{}); err != nil {
+		os.RemoveAll(stageDir)
+		return "", nil, fmt.Errorf("解压备份失败: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(stageDir, backupManifestName))
+	if err != nil {
+		os.RemoveAll(stageDir)
+		return "", nil, errors.New("备份中缺少 " + backupManifestName)
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		os.RemoveAll(stageDir)
+		return "", nil, fmt.Errorf("备份清单格式错误: %w", err)
+	}
+	return stageDir, &manifest, nil
+}
+
+// rollbackRestore 用安全快照中的全部文件覆盖房间目录
+func (s *BackupService) rollbackRestore(safety *model.Backup) error {
+	stageDir, manifest, err := s.openBackup(safety)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+	return applyBackupFiles(stageDir, getRoomDir(safety.RoomID), backupScopeFiles(manifest, model.BackupScopeAll))
+}
+
+// backupScopeFiles 恢复范围内的文件（相对房间目录）
+func backupScopeFiles(manifest *BackupManifest, scope string) []string {
+	var files []string
+	if scope == model.BackupScopeWorld || scope == model.BackupScopeAll {
+		files = append(files, manifest.Worlds...)
+	}
+	if scope == model.BackupScopeConfig || scope == model.BackupScopeAll {
+		files = append(files, manifest.Configs...)
+	}
+	return files
+}
+
+// applyBackupFiles 将解压目录中的文件复制到房间目录
+func applyBackupFiles(stageDir, roomDir string, files []string) error {
+	for _, rel := range files {
+		if !utils.IsSafeArchivePath(rel) || backupFileKind(rel) == "" {
+			return fmt.Errorf("备份中的路径无效: %s", rel)
+		}
+		if err := copyFile(filepath.Join(stageDir, filepath.FromSlash(rel)), filepath.Join(roomDir, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyBackupSettings 恢复房间设置：世界范围切换到备份时使用的世界，配置范围恢复世界设置、人数和密码
+// 服务端配置（serverconfig.txt）按恢复后的设置重新生成
+func applyBackupSettings(room *model.Room, manifest *BackupManifest, scope string) ([]string, error) {
+	var warnings []string
+	updates := map[string]interface{}{}
+	if scope != model.BackupScopeConfig && manifest.WorldName != "" && manifest.WorldName != room.WorldName {
+		if _, err := os.Stat(filepath.Join(getRoomWorldsDir(room.ID), worldFileName(manifest.WorldName))); err == nil {
+			room.WorldName = manifest.WorldName
+			updates["world_name"] = room.WorldName
+		} else {
+			warnings = append(warnings, fmt.Sprintf("备份时使用的世界 %s 不在备份中，房间仍使用 %s", manifest.WorldName, room.WorldName))
+		}
+	}
+	if scope != model.BackupScopeWorld && manifest.Room != nil {
+		room.MaxPlayers, room.Password = manifest.Room.MaxPlayers, manifest.Room.Password
+		updates["max_players"], updates["password"] = room.MaxPlayers, room.Password
+		if source := manifest.Room.WorldConfig; source != nil && room.WorldConfig != nil {
+			worldConfig := *source
+			worldConfig.ID, worldConfig.RoomID, worldConfig.CreatedAt = room.WorldConfig.ID, room.ID, room.WorldConfig.CreatedAt
+			if err := utils.DB.Save(&worldConfig).Error; err != nil {
+				return warnings, err
+			}
+			room.WorldConfig = &worldConfig
+		}
+	}
+	if len(updates) > 0 {
+		if err := utils.DB.Model(&model.Room{}).Where("id = ?", room.ID).Updates(updates).Error; err != nil {
+			return warnings, err
+		}
+	}
+	_, err := writeServerConfig(room)
+	return warnings, err
+}
+
+// waitProcessExit 等待房间的服务端进程退出
+func waitProcessExit(roomId uint, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, ok := roomProcesses.Load(roomId); !ok {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
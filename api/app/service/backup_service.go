@@ -0,0 +1,489 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+const (
+	// 定时备份的检查间隔
+	backupSchedulerInterval = time.Minute
+	// 等待运行中的服务端保存世界的最长时间
+	backupSaveTimeout = 2 * time.Minute
+	// 备份归档中的清单文件
+	backupManifestName = "backup.json"
+)
+
+// errNothingToBackup 房间目录中没有需要备份的文件
+var errNothingToBackup = errors.New("房间没有可备份的世界或配置文件")
+
+// 房间没有定时备份设置时返回的默认值（未启用）
+var defaultBackupSchedule = model.BackupSchedule{Cron: "0 4 * * *", KeepLast: 7, KeepDaily: 7, KeepWeekly: 4}
+
+// BackupManifest 备份归档中的清单
+type BackupManifest struct {
+	RoomID    uint        `json:"roomId"`
+	RoomName  string      `json:"roomName"`
+	Type      string      `json:"type"`
+	Version   string      `json:"version"`
+	WorldName string      `json:"worldName"`
+	Worlds    []string    `json:"worlds"`
+	Configs   []string    `json:"configs"`
+	Room      *model.Room `json:"room"` // 备份时的房间设置（含世界配置）
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// BackupScheduleRequest 定时备份设置
+type BackupScheduleRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Cron       string `json:"cron" binding:"required"`
+	KeepLast   int    `json:"keepLast" binding:"min=0"`
+	KeepDaily  int    `json:"keepDaily" binding:"min=0"`
+	KeepWeekly int    `json:"keepWeekly" binding:"min=0"`
+}
+
+// BackupService 房间备份服务
+type BackupService struct {
+	running sync.Map // 正在备份或恢复的房间ID
+	uploads sync.Map // 正在上传的副本（备份ID:存储ID）
+}
+
+var (
+	backupServiceOnce     sync.Once
+	backupServiceInstance *BackupService
+)
+
+// NewBackupService 获取备份服务（全局共享备份状态）
+func NewBackupService() *BackupService {
+	backupServiceOnce.Do(func() {
+		backupServiceInstance = &BackupService{}
+	})
+	return backupServiceInstance
+}
+
+// ListBackups 获取房间的备份（新的在前）
+func (s *BackupService) ListBackups(roomId uint) ([]model.Backup, error) {
+	if _, err := getWorldRoom(roomId); err != nil {
+		return nil, err
+	}
+	backups := []model.Backup{}
+	err := utils.DB.Preload("Copies").Where("room_id = ?", roomId).Order("created_at DESC").Find(&backups).Error
+	return backups, err
+}
+
+// GetBackup 获取房间的一个备份
+func (s *BackupService) GetBackup(roomId, backupId uint) (*model.Backup, error) {
+	var backup model.Backup
+	if err := utils.DB.Preload("Copies").Where("room_id = ?", roomId).First(&backup, backupId).Error; err != nil {
+		return nil, errors.New("备份不存在")
+	}
+	return &backup, nil
+}
+
+// BackupFilePath 备份归档的路径
+func (s *BackupService) BackupFilePath(backup *model.Backup) string {
+	return filepath.Join(getRoomBackupDir(backup.RoomID), backup.FileName)
+}
+
+// CreateBackup 备份房间的世界文件和配置
+// 运行中的房间先发送 save 命令，等待世界保存完成后再打包
+func (s *BackupService) CreateBackup(roomId uint, trigger, note string) (*model.Backup, error) {
+	if !s.lock(roomId) {
+		return nil, errors.New("房间正在备份或恢复中，请稍后再试")
+	}
+	defer s.unlock(roomId)
+
+	room, err := NewRoomService().GetRoomByID(roomId)
+	if err != nil {
+		return nil, errors.New("房间不存在")
+	}
+
+	saved := false
+	if room.Status == model.StatusRunning {
+		if saved, err = saveRunningWorld(room, backupSaveTimeout); err != nil {
+			return nil, fmt.Errorf("保存世界失败: %w", err)
+		}
+	}
+	backup, err := s.createBackup(room, trigger, note, saved)
+	if err != nil {
+		return nil, err
+	}
+	go s.replicateBackup(backup)
+	return backup, nil
+}
+
+// lock 标记房间正在备份或恢复，已有操作时返回 false
+func (s *BackupService) lock(roomId uint) bool {
+	_, busy := s.running.LoadOrStore(roomId, true)
+	return !busy
+}
+
+func (s *BackupService) unlock(roomId uint) {
+	s.running.Delete(roomId)
+}
+
+// createBackup 打包房间当前的文件并记录备份（调用方已持有房间的锁）
+func (s *BackupService) createBackup(room *model.Room, trigger, note string, saved bool) (*model.Backup, error) {
+	roomId := room.ID
+	now := time.Now()
+	backupDir := getRoomBackupDir(roomId)
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return nil, err
+	}
+	fileName := fmt.Sprintf("room%d-%s.json", roomId, now.Format("20060102-150405"))
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(backupDir, fileName)); os.IsNotExist(err) {
+			break
+		}
+		fileName = fmt.Sprintf("room%d-%s-%d.json", roomId, now.Format("20060102-150405"), i)
+	}
+
+	result, err := writeChunkedBackup(room, filepath.Join(backupDir, fileName), now)
+	if err != nil {
+		if errors.Is(err, errNothingToBackup) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("写入备份失败: %w", err)
+	}
+
+	backup := &model.Backup{
+		RoomID:      roomId,
+		Trigger:     trigger,
+		Format:      model.BackupFormatChunked,
+		FileName:    fileName,
+		Size:        result.size,
+		LogicalSize: result.logicalSize,
+		StoredSize:  result.storedSize,
+		SHA256:      result.sha256,
+		WorldName:   room.WorldName,
+		Worlds:      result.manifest.Worlds,
+		Configs:     result.manifest.Configs,
+		ServerSaved: saved,
+		Note:        note,
+		CreatedAt:   now,
+	}
+	if err := utils.DB.Create(backup).Error; err != nil {
+		os.Remove(filepath.Join(backupDir, fileName))
+		return nil, err
+	}
+	log.Printf("✅ 房间 %s (ID:%d) 已备份: %s（%d 个世界文件，%d 个配置文件，新增 %.1f MB）", room.Name, roomId, fileName,
+		len(result.manifest.Worlds), len(result.manifest.Configs), float64(result.storedSize)/1024/1024)
+	return backup, nil
+}
+
+// DeleteBackup 删除备份，并清理不再被其他备份引用的块
+func (s *BackupService) DeleteBackup(roomId, backupId uint) error {
+	backup, err := s.GetBackup(roomId, backupId)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteBackup(backup); err != nil {
+		return err
+	}
+	if backup.Format == model.BackupFormatChunked {
+		s.collectRoomChunks(roomId)
+	}
+	return nil
+}
+
+// DeleteRoomBackups 删除房间的所有备份及其副本（删除房间时调用）
+func (s *BackupService) DeleteRoomBackups(roomId uint) error {
+	var backups []model.Backup
+	utils.DB.Where("room_id = ?", roomId).Find(&backups)
+	for i := range backups {
+		s.deleteCopies(&backups[i])
+	}
+	if err := utils.DB.Where("room_id = ?", roomId).Delete(&model.Backup{}).Error; err != nil {
+		return err
+	}
+	return os.RemoveAll(getRoomBackupDir(roomId))
+}
+
+func (s *BackupService) deleteBackup(backup *model.Backup) error {
+	s.deleteCopies(backup)
+	if err := os.Remove(s.BackupFilePath(backup)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return utils.DB.Delete(&model.Backup{}, backup.ID).Error
+}
+
+// GetSchedule 获取房间的定时备份设置，未设置时返回默认值（未启用）
+func (s *BackupService) GetSchedule(roomId uint) (*model.BackupSchedule, error) {
+	if _, err := getWorldRoom(roomId); err != nil {
+		return nil, err
+	}
+	var schedules []model.BackupSchedule
+	if err := utils.DB.Where("room_id = ?", roomId).Limit(1).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		schedule := defaultBackupSchedule
+		schedule.RoomID = roomId
+		return &schedule, nil
+	}
+	return &schedules[0], nil
+}
+
+// UpdateSchedule 保存房间的定时备份设置并计算下次执行时间
+func (s *BackupService) UpdateSchedule(roomId uint, req BackupScheduleRequest) (*model.BackupSchedule, error) {
+	schedule, err := s.GetSchedule(roomId)
+	if err != nil {
+		return nil, err
+	}
+	cron, err := utils.ParseCron(req.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Enabled = req.Enabled
+	schedule.Cron = strings.TrimSpace(req.Cron)
+	schedule.KeepLast = req.KeepLast
+	schedule.KeepDaily = req.KeepDaily
+	schedule.KeepWeekly = req.KeepWeekly
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		next := cron.Next(time.Now())
+		if next.IsZero() {
+			return nil, errors.New("cron 表达式在 5 年内不会执行")
+		}
+		schedule.NextRunAt = &next
+	}
+	if err := utils.DB.Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+var backupSchedulerOnce sync.Once
+
+// StartScheduler 启动定时备份，停机期间错过的备份在启动后补做一次
+func (s *BackupService) StartScheduler() {
+	backupSchedulerOnce.Do(func() {
+		// 上次运行时没有完成的上传
+		utils.DB.Model(&model.BackupCopy{}).Where("status = ?", model.BackupCopyUploading).
+			Updates(map[string]interface{}{"status": model.BackupCopyFailed, "error": "服务重启，上传中断"})
+		go func() {
+			ticker := time.NewTicker(backupSchedulerInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				var schedules []model.BackupSchedule
+				utils.DB.Where("enabled = ? AND next_run_at <= ?", true, time.Now()).Find(&schedules)
+				for i := range schedules {
+					schedule := schedules[i]
+					// 先推进下次执行时间，避免备份耗时较长时重复触发
+					if cron, err := utils.ParseCron(schedule.Cron); err == nil {
+						next := cron.Next(time.Now())
+						schedule.NextRunAt = &next
+					} else {
+						schedule.Enabled, schedule.NextRunAt, schedule.LastError = false, nil, err.Error()
+					}
+					utils.DB.Model(&model.BackupSchedule{}).Where("id = ?", schedule.ID).Updates(map[string]interface{}{
+						"enabled":     schedule.Enabled,
+						"next_run_at": schedule.NextRunAt,
+						"last_error":  schedule.LastError,
+					})
+					if schedule.Enabled {
+						go s.runSchedule(schedule)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// runSchedule 执行一次定时备份，成功后按保留策略清理旧备份
+func (s *BackupService) runSchedule(schedule model.BackupSchedule) {
+	lastError := ""
+	if _, err := s.CreateBackup(schedule.RoomID, model.BackupTriggerSchedule, ""); err != nil {
+		lastError = err.Error()
+		log.Printf("❌ 房间 %d 定时备份失败: %v", schedule.RoomID, err)
+	} else if pruned, err := s.applyRetention(&schedule); err != nil {
+		log.Printf("⚠️ 清理房间 %d 的旧备份失败: %v", schedule.RoomID, err)
+	} else if pruned > 0 {
+		log.Printf("✅ 已按保留策略清理房间 %d 的 %d 个旧备份", schedule.RoomID, pruned)
+		s.collectRoomChunks(schedule.RoomID)
+	}
+
+	now := time.Now()
+	utils.DB.Model(&model.BackupSchedule{}).Where("id = ?", schedule.ID).Updates(map[string]interface{}{
+		"last_run_at": now,
+		"last_error":  lastError,
+	})
+}
+
+// applyRetention 删除不在保留策略内的定时备份（手动备份不受影响），三项都为 0 时全部保留
+func (s *BackupService) applyRetention(schedule *model.BackupSchedule) (int, error) {
+	if schedule.KeepLast <= 0 && schedule.KeepDaily <= 0 && schedule.KeepWeekly <= 0 {
+		return 0, nil
+	}
+	var backups []model.Backup
+	if err := utils.DB.Where("room_id = ? AND `trigger` = ?", schedule.RoomID, model.BackupTriggerSchedule).
+		Order("created_at DESC").Find(&backups).Error; err != nil {
+		return 0, err
+	}
+
+	keep := retainedBackups(backups, schedule, time.Now())
+	pruned := 0
+	for i := range backups {
+		if keep[backups[i].ID] {
+			continue
+		}
+		if err := s.deleteBackup(&backups[i]); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// retainedBackups 按保留策略选出要保留的备份（backups 按时间从新到旧排列）
+// 最近 N 个全部保留；最近 N 天（含今天）、最近 N 周（含本周）各保留每天、每周最新的一个
+func retainedBackups(backups []model.Backup, schedule *model.BackupSchedule, now time.Time) map[uint]bool {
+	now = now.Local()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dayCutoff := today.AddDate(0, 0, -(schedule.KeepDaily - 1))
+	// ISO 周从周一开始
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	weekCutoff := weekStart.AddDate(0, 0, -7*(schedule.KeepWeekly-1))
+
+	keep := map[uint]bool{}
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+	for i, backup := range backups {
+		t := backup.CreatedAt.Local()
+		if i < schedule.KeepLast {
+			keep[backup.ID] = true
+		}
+		if schedule.KeepDaily > 0 && !t.Before(dayCutoff) {
+			if day := t.Format("2006-01-02"); !days[day] {
+				days[day] = true
+				keep[backup.ID] = true
+			}
+		}
+		if schedule.KeepWeekly > 0 && !t.Before(weekCutoff) {
+			year, week := t.ISOWeek()
+			if key := fmt.Sprintf("%d-%d", year, week); !weeks[key] {
+				weeks[key] = true
+				keep[backup.ID] = true
+			}
+		}
+	}
+	return keep
+}
+
+// saveRunningWorld 让运行中的服务端保存世界，并等待世界文件写入完成（修改时间变化且 1 秒内不再变化）
+// 服务端进程不存在时返回 false
+func saveRunningWorld(room *model.Room, timeout time.Duration) (bool, error) {
+	if _, ok := roomProcesses.Load(room.ID); !ok {
+		return false, nil
+	}
+	worldPath := filepath.Join(getRoomWorldsDir(room.ID), worldFileName(room.WorldName))
+	before, _ := os.Stat(worldPath)
+	if err := sendConsoleCommand(room.ID, "save"); err != nil {
+		return false, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	var last os.FileInfo
+	var stableSince time.Time
+	for time.Now().Before(deadline) {
+		time.Sleep(250 * time.Millisecond)
+		info, err := os.Stat(worldPath)
+		if err != nil || (before != nil && info.ModTime().Equal(before.ModTime()) && info.Size() == before.Size()) {
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last, stableSince = info, time.Now()
+			continue
+		}
+		if time.Since(stableSince) >= time.Second {
+			return true, nil
+		}
+	}
+	return true, errors.New("等待世界保存超时")
+}
+
+// collectBackupFiles 列出房间中需要备份的世界文件和配置（按路径排序），并生成清单
+func collectBackupFiles(room *model.Room, now time.Time) (*BackupManifest, []string, error) {
+	roomDir := getRoomDir(room.ID)
+	manifest := &BackupManifest{
+		RoomID:    room.ID,
+		RoomName:  room.Name,
+		Type:      string(room.Type),
+		Version:   room.Version,
+		WorldName: room.WorldName,
+		Worlds:    []string{},
+		Configs:   []string{},
+		Room:      room,
+		CreatedAt: now,
+	}
+	var files []string
+	err := filepath.WalkDir(roomDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(roomDir, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		switch backupFileKind(rel) {
+		case "world":
+			manifest.Worlds = append(manifest.Worlds, rel)
+		case "config":
+			manifest.Configs = append(manifest.Configs, rel)
+		default:
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, errNothingToBackup
+	}
+	sort.Strings(files)
+	return manifest, files, nil
+}
+
+// backupFileKind 房间目录中的文件属于世界（world）、配置（config）还是不需要备份（空）
+// 世界：Worlds 中的 .wld / .twld（不含服务端生成的 .bak）
+// 配置：serverconfig.txt、tshock 目录（日志和 TShock 自身的备份除外）、ModConfigs、Mods/enabled.json
+func backupFileKind(rel string) string {
+	if strings.HasPrefix(path.Base(rel), ".") {
+		return "" // 上传或写入中的临时文件
+	}
+	switch {
+	case strings.HasPrefix(rel, "Worlds/"):
+		ext := strings.ToLower(filepath.Ext(rel))
+		if ext == ".wld" || ext == ".twld" {
+			return "world"
+		}
+	case rel == "serverconfig.txt", rel == "Mods/enabled.json", strings.HasPrefix(rel, "ModConfigs/"):
+		return "config"
+	case strings.HasPrefix(rel, "tshock/"):
+		if strings.HasPrefix(rel, "tshock/logs/") || strings.HasPrefix(rel, "tshock/backups/") || strings.HasSuffix(rel, ".log") {
+			return ""
+		}
+		return "config"
+	}
+	return ""
+}
+
+// getRoomBackupDir 房间备份的保存目录
+func getRoomBackupDir(roomId uint) string {
+	return filepath.Join(config.GlobalConfig.DataPath, "backups", fmt.Sprintf("room_%d", roomId))
+}
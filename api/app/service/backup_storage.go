@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// 上传到 S3 的分片大小（S3 要求除最后一片外至少 5MB）
+const backupStoragePartSize = 16 << 20
+
+// BackupStorage 保存备份归档的位置，key 为相对前缀的路径（room_1/room1-20240101-120000.tar.gz）
+type BackupStorage interface {
+	// Put 上传归档，sum 为归档的 SHA-256，写入后校验
+	Put(ctx context.Context, key string, r io.Reader, sum string) error
+	// Get 读取归档，调用方负责关闭
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除归档，不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// List 列出前缀下的所有文件
+	List(ctx context.Context) ([]StoredObject, error)
+	// Check 检查存储是否可以写入
+	Check(ctx context.Context) error
+}
+
+// StoredObject 备份存储中的文件
+type StoredObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// newBackupStorage 按备份存储的设置创建对应的实现
+func newBackupStorage(target *model.BackupTarget) (BackupStorage, error) {
+	prefix := strings.Trim(target.Prefix, "/")
+	switch target.Type {
+	case model.BackupTargetLocal:
+		if !filepath.IsAbs(target.Path) {
+			return nil, errors.New("本地目录需要使用绝对路径")
+		}
+		if err := checkLocalBackupRoot(target.Path); err != nil {
+			return nil, err
+		}
+		return &localBackupStorage{root: filepath.Join(target.Path, filepath.FromSlash(prefix))}, nil
+	case model.BackupTargetS3:
+		client, err := utils.NewS3Client(utils.S3Config{
+			Endpoint:  target.Endpoint,
+			Region:    target.Region,
+			Bucket:    target.Bucket,
+			AccessKey: target.AccessKey,
+			SecretKey: target.SecretKey,
+			PathStyle: target.PathStyle,
+		}, downloadClient)
+		if err != nil {
+			return nil, err
+		}
+		return &s3BackupStorage{client: client, prefix: prefix}, nil
+	default:
+		return nil, fmt.Errorf("不支持的备份存储类型: %s", target.Type)
+	}
+}
+
+// checkLocalBackupRoot 确认本地目录位于配置允许的目录（TERRARIA_BACKUP_LOCAL_ROOTS）中
+// 符号链接解析后再比较，避免通过链接指向其他位置
+func checkLocalBackupRoot(dir string) error {
+	roots := config.GlobalConfig.BackupLocalRoots
+	if len(roots) == 0 {
+		return errors.New("未配置允许的本地备份目录（TERRARIA_BACKUP_LOCAL_ROOTS）")
+	}
+	dir = resolveExistingPath(dir)
+	for _, root := range roots {
+		rel, err := filepath.Rel(resolveExistingPath(root), dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("本地目录不在允许的目录中: %s", strings.Join(roots, ", "))
+}
+
+// resolveExistingPath 解析路径中已存在部分的符号链接，不存在的部分原样拼接
+func resolveExistingPath(p string) string {
+	p = filepath.Clean(p)
+	var rest []string
+	for dir := p; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		if filepath.Dir(dir) == dir {
+			return p
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
+
+// localBackupStorage 本地目录（挂载的其他磁盘、NFS 等）
+type localBackupStorage struct {
+	root string
+}
+
+func (l *localBackupStorage) path(key string) (string, error) {
+	if !utils.IsSafeArchivePath(key) {
+		return "", fmt.Errorf("无效的路径: %s", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *localBackupStorage) Put(ctx context.Context, key string, r io.Reader, sum string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), r); err != nil {
+		tmp.Close()
+		return err
+	}
+	// 落盘后再改名，避免断电后留下不完整的归档
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); sum != "" && got != sum {
+		return fmt.Errorf("写入校验失败: SHA-256 为 %s，应为 %s", got, sum)
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (l *localBackupStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(target)
+}
+
+func (l *localBackupStorage) Delete(ctx context.Context, key string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *localBackupStorage) List(ctx context.Context) ([]StoredObject, error) {
+	objects := []StoredObject{}
+	err := filepath.WalkDir(l.root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(l.root, p)
+		objects = append(objects, StoredObject{Key: filepath.ToSlash(rel), Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return objects, nil
+}
+
+func (l *localBackupStorage) Check(ctx context.Context) error {
+	if err := os.MkdirAll(l.root, 0755); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(l.root, ".probe-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// s3BackupStorage S3 兼容的对象存储，大于一个分片的归档使用分片上传
+type s3BackupStorage struct {
+	client *utils.S3Client
+	prefix string
+}
+
+func (s *s3BackupStorage) objectKey(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func (s *s3BackupStorage) Put(ctx context.Context, key string, r io.Reader, sum string) error {
+	objectKey := s.objectKey(key)
+	meta := map[string]string{"Sha256": sum}
+	hash := sha256.New()
+	r = io.TeeReader(r, hash)
+
+	buf := make([]byte, backupStoragePartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if got := hex.EncodeToString(hash.Sum(nil)); sum != "" && got != sum {
+			return fmt.Errorf("读取校验失败: SHA-256 为 %s，应为 %s", got, sum)
+		}
+		return s.client.PutObject(ctx, objectKey, buf[:n], meta)
+	}
+	if err != nil {
+		return err
+	}
+
+	uploadID, err := s.client.CreateMultipartUpload(ctx, objectKey, meta)
+	if err != nil {
+		return err
+	}
+	parts, err := func() ([]utils.S3Part, error) {
+		var parts []utils.S3Part
+		for {
+			part, err := s.client.UploadPart(ctx, objectKey, uploadID, len(parts)+1, buf[:n])
+			if err != nil {
+				return nil, fmt.Errorf("上传第 %d 个分片失败: %w", len(parts)+1, err)
+			}
+			parts = append(parts, part)
+			n, err = io.ReadFull(r, buf)
+			if err == io.EOF {
+				return parts, nil
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, err
+			}
+		}
+	}()
+	if err == nil {
+		// 本地文件在上传期间被改动时放弃上传
+		if got := hex.EncodeToString(hash.Sum(nil)); sum != "" && got != sum {
+			err = fmt.Errorf("读取校验失败: SHA-256 为 %s，应为 %s", got, sum)
+		}
+	}
+	if err != nil {
+		s.client.AbortMultipartUpload(context.WithoutCancel(ctx), objectKey, uploadID)
+		return err
+	}
+	return s.client.CompleteMultipartUpload(ctx, objectKey, uploadID, parts)
+}
+
+func (s *s3BackupStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.objectKey(key))
+}
+
+func (s *s3BackupStorage) Delete(ctx context.Context, key string) error {
+	return s.client.DeleteObject(ctx, s.objectKey(key))
+}
+
+func (s *s3BackupStorage) List(ctx context.Context) ([]StoredObject, error) {
+	prefix := ""
+	if s.prefix != "" {
+		prefix = s.prefix + "/"
+	}
+	objects, err := s.client.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]StoredObject, 0, len(objects))
+	for _, obj := range objects {
+		result = append(result, StoredObject{Key: strings.TrimPrefix(obj.Key, prefix), Size: obj.Size, LastModified: obj.LastModified})
+	}
+	return result, nil
+}
+
+func (s *s3BackupStorage) Check(ctx context.Context) error {
+	if err := s.client.HeadBucket(ctx); err != nil {
+		return err
+	}
+	// 写入并删除一个小对象，确认密钥有写权限
+	key := s.objectKey(path.Join(".probe", fmt.Sprintf("%d", time.Now().UnixNano())))
+	if err := s.client.PutObject(ctx, key, []byte("ok"), nil); err != nil {
+		return err
+	}
+	return s.client.DeleteObject(ctx, key)
+}
@@ -0,0 +1,554 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+const (
+	// 上传或取回一个备份的最长时间
+	backupTransferTimeout = 2 * time.Hour
+	// 检查备份存储连接的最长时间
+	backupTargetCheckTimeout = 30 * time.Second
+)
+
+// backupObjectKeyPattern 备份存储中的归档路径：room_<房间ID>/<文件名>.tar.gz
+var backupObjectKeyPattern = regexp.MustCompile(`^room_(\d+)/([^/]+\.tar\.gz)$`)
+
+// BackupTargetRequest 备份存储设置
+type BackupTargetRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Type      string `json:"type" binding:"required,oneof=local s3"`
+	Enabled   bool   `json:"enabled"`
+	Path      string `json:"path"`
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"` // 修改时为空表示不变
+	PathStyle bool   `json:"pathStyle"`
+	Prefix    string `json:"prefix"`
+}
+
+// TargetBackupObject 备份存储中的归档
+type TargetBackupObject struct {
+	StoredObject
+	RoomID   uint  `json:"roomId"`   // 归档所属的房间（按路径解析）
+	BackupID *uint `json:"backupId"` // 已登记的备份，未导入时为空
+}
+
+// ImportBackupRequest 从备份存储导入备份
+type ImportBackupRequest struct {
+	Key    string `json:"key" binding:"required"`
+	RoomID uint   `json:"roomId" binding:"required"` // 导入到哪个房间（可以不是原来的房间）
+}
+
+// ListTargets 获取备份存储列表
+func (s *BackupService) ListTargets() ([]model.BackupTarget, error) {
+	targets := []model.BackupTarget{}
+	err := utils.DB.Order("id").Find(&targets).Error
+	return targets, err
+}
+
+// GetTarget 获取备份存储
+func (s *BackupService) GetTarget(id uint) (*model.BackupTarget, error) {
+	var target model.BackupTarget
+	if err := utils.DB.First(&target, id).Error; err != nil {
+		return nil, errors.New("备份存储不存在")
+	}
+	return &target, nil
+}
+
+// CreateTarget 添加备份存储，启用的存储会先检查能否写入
+func (s *BackupService) CreateTarget(req BackupTargetRequest) (*model.BackupTarget, error) {
+	target := &model.BackupTarget{}
+	applyTargetRequest(target, req)
+	if err := checkBackupTarget(target); err != nil {
+		return nil, err
+	}
+	if err := utils.DB.Create(target).Error; err != nil {
+		return nil, fmt.Errorf("保存备份存储失败（名称不能重复）: %w", err)
+	}
+	log.Printf("✅ 已添加备份存储 %s (%s)", target.Name, target.Type)
+	return target, nil
+}
+
+// UpdateTarget 修改备份存储，已上传的副本保持原来的路径
+func (s *BackupService) UpdateTarget(id uint, req BackupTargetRequest) (*model.BackupTarget, error) {
+	target, err := s.GetTarget(id)
+	if err != nil {
+		return nil, err
+	}
+	applyTargetRequest(target, req)
+	if err := checkBackupTarget(target); err != nil {
+		return nil, err
+	}
+	if err := utils.DB.Save(target).Error; err != nil {
+		return nil, fmt.Errorf("保存备份存储失败（名称不能重复）: %w", err)
+	}
+	return target, nil
+}
+
+// DeleteTarget 删除备份存储的设置和副本记录，存储中已上传的归档保留
+func (s *BackupService) DeleteTarget(id uint) error {
+	if _, err := s.GetTarget(id); err != nil {
+		return err
+	}
+	if err := utils.DB.Where("target_id = ?", id).Delete(&model.BackupCopy{}).Error; err != nil {
+		return err
+	}
+	return utils.DB.Delete(&model.BackupTarget{}, id).Error
+}
+
+// TestTarget 检查备份存储能否写入
+func (s *BackupService) TestTarget(id uint) error {
+	target, err := s.GetTarget(id)
+	if err != nil {
+		return err
+	}
+	storage, err := newBackupStorage(target)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backupTargetCheckTimeout)
+	defer cancel()
+	return storage.Check(ctx)
+}
+
+// applyTargetRequest 把请求写入备份存储设置，密钥为空时保留原值
+func applyTargetRequest(target *model.BackupTarget, req BackupTargetRequest) {
+	target.Name = strings.TrimSpace(req.Name)
+	target.Type = req.Type
+	target.Enabled = req.Enabled
+	target.Path = strings.TrimSpace(req.Path)
+	target.Endpoint = strings.TrimSpace(req.Endpoint)
+	target.Region = strings.TrimSpace(req.Region)
+	target.Bucket = strings.TrimSpace(req.Bucket)
+	target.AccessKey = strings.TrimSpace(req.AccessKey)
+	if req.SecretKey != "" {
+		target.SecretKey = req.SecretKey
+	}
+	target.PathStyle = req.PathStyle
+	target.Prefix = strings.Trim(strings.TrimSpace(req.Prefix), "/")
+}
+
+// checkBackupTarget 校验设置，启用的存储还要确认可以写入
+func checkBackupTarget(target *model.BackupTarget) error {
+	if target.Prefix != "" && !utils.IsSafeArchivePath(target.Prefix) {
+		return fmt.Errorf("无效的前缀: %s", target.Prefix)
+	}
+	storage, err := newBackupStorage(target)
+	if err != nil {
+		return err
+	}
+	if !target.Enabled {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backupTargetCheckTimeout)
+	defer cancel()
+	if err := storage.Check(ctx); err != nil {
+		return fmt.Errorf("无法写入备份存储: %w", err)
+	}
+	return nil
+}
+
+// backupObjectKey 备份在备份存储中的路径
+func backupObjectKey(backup *model.Backup) string {
+	return fmt.Sprintf("room_%d/%s", backup.RoomID, BackupArchiveName(backup))
+}
+
+// BackupArchiveName 下载或上传时的归档文件名（分块备份导出为同名的 .tar.gz）
+func BackupArchiveName(backup *model.Backup) string {
+	if backup.Format == model.BackupFormatChunked {
+		return strings.TrimSuffix(backup.FileName, ".json") + ".tar.gz"
+	}
+	return backup.FileName
+}
+
+// replicateBackup 把新备份上传到所有启用的备份存储（后台执行，失败记录在副本上）
+func (s *BackupService) replicateBackup(backup *model.Backup) {
+	var targets []model.BackupTarget
+	if err := utils.DB.Where("enabled = ?", true).Order("id").Find(&targets).Error; err != nil || len(targets) == 0 {
+		return
+	}
+	for i := range targets {
+		if _, err := s.uploadCopy(backup, &targets[i]); err != nil {
+			log.Printf("❌ 备份 %s 上传到 %s 失败: %v", backup.FileName, targets[i].Name, err)
+		}
+	}
+}
+
+// UploadCopy 把备份上传到指定的备份存储（已上传时重新上传）
+func (s *BackupService) UploadCopy(roomId, backupId, targetId uint) (*model.BackupCopy, error) {
+	backup, err := s.GetBackup(roomId, backupId)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.GetTarget(targetId)
+	if err != nil {
+		return nil, err
+	}
+	return s.uploadCopy(backup, target)
+}
+
+// uploadCopy 上传备份并记录副本状态，同一副本同时只上传一次
+func (s *BackupService) uploadCopy(backup *model.Backup, target *model.BackupTarget) (*model.BackupCopy, error) {
+	guard := fmt.Sprintf("%d:%d", backup.ID, target.ID)
+	if _, busy := s.uploads.LoadOrStore(guard, true); busy {
+		return nil, errors.New("该备份正在上传到此存储")
+	}
+	defer s.uploads.Delete(guard)
+
+	var copies []model.BackupCopy
+	utils.DB.Where("backup_id = ? AND target_id = ?", backup.ID, target.ID).Limit(1).Find(&copies)
+	backupCopy := &model.BackupCopy{BackupID: backup.ID, TargetID: target.ID, Key: backupObjectKey(backup)}
+	if len(copies) > 0 {
+		backupCopy = &copies[0]
+	}
+	backupCopy.Status, backupCopy.Error = model.BackupCopyUploading, ""
+	if err := utils.DB.Save(backupCopy).Error; err != nil {
+		return nil, err
+	}
+
+	err := func() error {
+		storage, err := newBackupStorage(target)
+		if err != nil {
+			return err
+		}
+		archivePath, cleanup, err := s.OpenArchive(backup)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		// 分块备份导出的归档与索引不同，按实际上传的文件计算
+		sum, size, err := fileSHA256(archivePath)
+		if err != nil {
+			return err
+		}
+		if backup.Format != model.BackupFormatChunked && backup.SHA256 != "" && sum != backup.SHA256 {
+			return errors.New("本地备份文件校验失败，文件可能已损坏")
+		}
+		backupCopy.SHA256, backupCopy.Size = sum, size
+		f, err := os.Open(archivePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), backupTransferTimeout)
+		defer cancel()
+		return storage.Put(ctx, backupCopy.Key, f, sum)
+	}()
+
+	// 上传期间备份被删除时，同时删除刚上传的副本
+	var count int64
+	utils.DB.Model(&model.Backup{}).Where("id = ?", backup.ID).Count(&count)
+	if count == 0 {
+		if err == nil {
+			s.deleteRemoteCopy(backupCopy, target)
+		}
+		utils.DB.Delete(&model.BackupCopy{}, backupCopy.ID)
+		return nil, errors.New("备份已被删除")
+	}
+
+	if err != nil {
+		backupCopy.Status, backupCopy.Error = model.BackupCopyFailed, err.Error()
+	} else {
+		now := time.Now()
+		backupCopy.Status, backupCopy.UploadedAt = model.BackupCopyUploaded, &now
+		log.Printf("✅ 备份 %s 已上传到 %s", backup.FileName, target.Name)
+	}
+	utils.DB.Save(backupCopy)
+	return backupCopy, err
+}
+
+// deleteCopies 删除备份在各备份存储中的副本（删除备份时调用，存储不可用时只记录日志）
+func (s *BackupService) deleteCopies(backup *model.Backup) {
+	var copies []model.BackupCopy
+	utils.DB.Where("backup_id = ?", backup.ID).Find(&copies)
+	for i := range copies {
+		if copies[i].Status == model.BackupCopyUploading {
+			continue // 上传结束后会发现备份已删除并清理
+		}
+		// 导入到其他房间的备份和原备份共用同一个归档
+		var shared int64
+		utils.DB.Model(&model.BackupCopy{}).Where("target_id = ? AND key = ? AND backup_id <> ?", copies[i].TargetID, copies[i].Key, backup.ID).Count(&shared)
+		if shared > 0 {
+			continue
+		}
+		if target, err := s.GetTarget(copies[i].TargetID); err == nil {
+			s.deleteRemoteCopy(&copies[i], target)
+		}
+	}
+	utils.DB.Where("backup_id = ? AND status <> ?", backup.ID, model.BackupCopyUploading).Delete(&model.BackupCopy{})
+}
+
+func (s *BackupService) deleteRemoteCopy(backupCopy *model.BackupCopy, target *model.BackupTarget) {
+	storage, err := newBackupStorage(target)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), backupTargetCheckTimeout)
+		err = storage.Delete(ctx, backupCopy.Key)
+		cancel()
+	}
+	if err != nil {
+		log.Printf("⚠️ 删除 %s 中的备份副本 %s 失败: %v", target.Name, backupCopy.Key, err)
+	}
+}
+
+// OpenArchive 返回备份的 tar.gz 归档路径，用完后调用 cleanup
+// 分块备份临时导出为归档；本地数据丢失或损坏时从已上传的副本取回
+func (s *BackupService) OpenArchive(backup *model.Backup) (string, func(), error) {
+	noop := func() {}
+	if backup.Format == model.BackupFormatChunked {
+		exported, err := s.exportChunkedArchive(backup)
+		if err == nil {
+			return exported, func() { os.Remove(exported) }, nil
+		}
+		dest := filepath.Join(config.GlobalConfig.DataPath, "backups", fmt.Sprintf(".copy-%d-%d.tar.gz", backup.ID, time.Now().UnixNano()))
+		if fetchErr := s.fetchCopy(backup, dest); fetchErr != nil {
+			return "", nil, fmt.Errorf("%v；%w", err, fetchErr)
+		}
+		log.Printf("⚠️ 备份 #%d 的本地数据不完整（%v），已改用备份存储中的副本", backup.ID, err)
+		return dest, func() { os.Remove(dest) }, nil
+	}
+
+	archivePath := s.BackupFilePath(backup)
+	if _, err := os.Stat(archivePath); err == nil {
+		return archivePath, noop, nil
+	}
+	if err := s.fetchCopy(backup, archivePath); err != nil {
+		return "", nil, fmt.Errorf("本地备份文件不存在，%w", err)
+	}
+	return archivePath, noop, nil
+}
+
+// fetchCopy 从已上传的副本取回归档到 dest，依次尝试每个备份存储
+func (s *BackupService) fetchCopy(backup *model.Backup, dest string) error {
+	var copies []model.BackupCopy
+	utils.DB.Where("backup_id = ? AND status = ?", backup.ID, model.BackupCopyUploaded).Order("id").Find(&copies)
+	if len(copies) == 0 {
+		return errors.New("没有已上传的副本")
+	}
+	var lastErr error
+	for i := range copies {
+		target, err := s.GetTarget(copies[i].TargetID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		sum := copies[i].SHA256
+		if sum == "" {
+			sum = backup.SHA256
+		}
+		if _, _, err := fetchFromTarget(target, copies[i].Key, dest, sum); err != nil {
+			lastErr = fmt.Errorf("%s: %w", target.Name, err)
+			continue
+		}
+		log.Printf("✅ 已从备份存储 %s 取回备份 #%d", target.Name, backup.ID)
+		return nil
+	}
+	return fmt.Errorf("从备份存储取回失败: %w", lastErr)
+}
+
+// fetchFromTarget 下载归档到本地文件并校验 SHA-256（sum 为空时不校验），返回实际的 SHA-256 和大小
+func fetchFromTarget(target *model.BackupTarget, key, dest, sum string) (string, int64, error) {
+	storage, err := newBackupStorage(target)
+	if err != nil {
+		return "", 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backupTransferTimeout)
+	defer cancel()
+	body, err := storage.Get(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".fetch-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	got := hex.EncodeToString(hash.Sum(nil))
+	if sum != "" && got != sum {
+		return "", 0, errors.New("副本校验失败，文件可能已损坏")
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", 0, err
+	}
+	return got, size, nil
+}
+
+// ListTargetBackups 列出备份存储中的备份归档，并标出已登记的备份
+func (s *BackupService) ListTargetBackups(targetId uint) ([]TargetBackupObject, error) {
+	target, err := s.GetTarget(targetId)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := newBackupStorage(target)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backupTargetCheckTimeout)
+	defer cancel()
+	objects, err := storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var copies []model.BackupCopy
+	utils.DB.Where("target_id = ?", targetId).Find(&copies)
+	registered := map[string]uint{}
+	for _, c := range copies {
+		registered[c.Key] = c.BackupID
+	}
+
+	result := []TargetBackupObject{}
+	for _, obj := range objects {
+		m := backupObjectKeyPattern.FindStringSubmatch(obj.Key)
+		if m == nil {
+			continue
+		}
+		roomId, _ := strconv.ParseUint(m[1], 10, 32)
+		item := TargetBackupObject{StoredObject: obj, RoomID: uint(roomId)}
+		if id, ok := registered[obj.Key]; ok {
+			item.BackupID = &id
+		}
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastModified.After(result[j].LastModified) })
+	return result, nil
+}
+
+// ImportFromTarget 把备份存储中的归档登记为房间的备份（如数据库和本地备份丢失后），之后可以恢复或克隆
+func (s *BackupService) ImportFromTarget(targetId uint, req ImportBackupRequest) (*model.Backup, error) {
+	target, err := s.GetTarget(targetId)
+	if err != nil {
+		return nil, err
+	}
+	if !backupObjectKeyPattern.MatchString(req.Key) {
+		return nil, fmt.Errorf("无效的备份路径: %s", req.Key)
+	}
+	room, err := getWorldRoom(req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	var existing int64
+	utils.DB.Model(&model.BackupCopy{}).
+		Joins("JOIN backups ON backups.id = backup_copies.backup_id").
+		Where("backup_copies.target_id = ? AND backup_copies.key = ? AND backups.room_id = ?", targetId, req.Key, room.ID).
+		Count(&existing)
+	if existing > 0 {
+		return nil, errors.New("该备份已导入到此房间")
+	}
+
+	backupDir := getRoomBackupDir(room.ID)
+	fileName := path.Base(req.Key)
+	base := strings.TrimSuffix(fileName, ".tar.gz")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(backupDir, fileName)); os.IsNotExist(err) {
+			break
+		}
+		fileName = fmt.Sprintf("%s-%d.tar.gz", base, i)
+	}
+	archivePath := filepath.Join(backupDir, fileName)
+	sum, size, err := fetchFromTarget(target, req.Key, archivePath, "")
+	if err != nil {
+		return nil, fmt.Errorf("下载备份失败: %w", err)
+	}
+	manifest, err := readBackupManifest(archivePath)
+	if err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+
+	now := time.Now()
+	backup := &model.Backup{
+		RoomID:    room.ID,
+		Trigger:   model.BackupTriggerImport,
+		Format:    model.BackupFormatArchive,
+		FileName:  fileName,
+		Size:      size,
+		SHA256:    sum,
+		WorldName: manifest.WorldName,
+		Worlds:    manifest.Worlds,
+		Configs:   manifest.Configs,
+		Note:      fmt.Sprintf("从 %s 导入（原房间 %s，%s）", target.Name, manifest.RoomName, manifest.CreatedAt.Local().Format("2006-01-02 15:04")),
+		CreatedAt: now,
+		Copies: []model.BackupCopy{{
+			TargetID:   target.ID,
+			Key:        req.Key,
+			SHA256:     sum,
+			Size:       size,
+			Status:     model.BackupCopyUploaded,
+			UploadedAt: &now,
+		}},
+	}
+	if err := utils.DB.Create(backup).Error; err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+	log.Printf("✅ 已从备份存储 %s 导入备份 %s 到房间 %s (ID:%d)", target.Name, req.Key, room.Name, room.ID)
+	return backup, nil
+}
+
+// readBackupManifest 读取归档中的 backup.json（打包时写在第一个）
+func readBackupManifest(archivePath string) (*BackupManifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.New("不是有效的备份归档")
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("备份中缺少 " + backupManifestName)
+		}
+		if err != nil {
+			return nil, errors.New("不是有效的备份归档")
+		}
+		if header.Name != backupManifestName {
+			continue
+		}
+		var manifest BackupManifest
+		if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("备份清单格式错误: %w", err)
+		}
+		return &manifest, nil
+	}
+}
@@ -0,0 +1,581 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"terraria-api/app/model"
+	"terraria-api/utils"
+)
+
+const (
+	fakeS3Bucket    = "backups"
+	fakeS3AccessKey = "test-access"
+	fakeS3SecretKey = "test-secret"
+	fakeS3Region    = "us-east-1"
+)
+
+// fakeS3 进程内的 S3 兼容服务（路径风格），校验签名、Content-MD5 和 SHA-256
+type fakeS3 struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	meta     map[string]http.Header
+	uploads  map[string]map[int][]byte
+	nextID   int
+	maxKeys  int  // 每页最多返回的对象数
+	badETag  bool // 上传后返回错误的 ETag，模拟传输中数据被改动
+	requests []string
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	f := &fakeS3{
+		objects: map[string][]byte{},
+		meta:    map[string]http.Header{},
+		uploads: map[string]map[int][]byte{},
+		maxKeys: 1000,
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeS3) target(name string) BackupTargetRequest {
+	return BackupTargetRequest{
+		Name:      name,
+		Type:      model.BackupTargetS3,
+		Enabled:   true,
+		Endpoint:  f.URL,
+		Region:    fakeS3Region,
+		Bucket:    fakeS3Bucket,
+		AccessKey: fakeS3AccessKey,
+		SecretKey: fakeS3SecretKey,
+		PathStyle: true,
+	}
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[key]
+	return data, ok
+}
+
+func (f *fakeS3) pendingUploads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.uploads)
+}
+
+func (f *fakeS3) countRequests(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if code := verifyS3Request(r, body); code != "" {
+		s3Error(w, http.StatusForbidden, code)
+		return
+	}
+	if r.Header.Get("Content-MD5") != "" {
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			s3Error(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != fakeS3Bucket {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.RequestURI())
+
+	etag := func(data []byte) string {
+		sum := md5.Sum(data)
+		if f.badETag {
+			sum[0] ^= 0xff
+		}
+		return `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		f.list(w, query)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = map[int][]byte{}
+		f.meta[key] = r.Header.Clone()
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n] = body
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var complete struct {
+			Parts []utils.S3Part `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			s3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var data []byte
+		for i, p := range complete.Parts {
+			part, ok := parts[p.PartNumber]
+			sum := md5.Sum(part)
+			if !ok || p.PartNumber != i+1 || strings.Trim(p.ETag, `"`) != hex.EncodeToString(sum[:]) {
+				// 与 S3 一致：合并失败时返回 200 和错误内容
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>InvalidPart</Message></Error>")
+				return
+			}
+			data = append(data, part...)
+		}
+		delete(f.uploads, query.Get("uploadId"))
+		f.objects[key] = data
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><ETag>\"x-%d\"</ETag></CompleteMultipartUploadResult>", len(complete.Parts))
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.meta[key] = r.Header.Clone()
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(data)
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list ListObjectsV2，continuation-token 为上一页最后一个 key
+func (f *fakeS3) list(w http.ResponseWriter, query map[string][]string) {
+	get := func(k string) string {
+		if v := query[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	prefix, token := get("prefix"), get("continuation-token")
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) && k > token {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	truncated := len(keys) > f.maxKeys
+	if truncated {
+		keys = keys[:f.maxKeys]
+	}
+
+	var b strings.Builder
+	b.WriteString("<ListBucketResult>")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified><ETag>\"etag\"</ETag></Contents>",
+			k, len(f.objects[k]), time.Now().UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "<IsTruncated>%t</IsTruncated>", truncated)
+	if truncated {
+		fmt.Fprintf(&b, "<NextContinuationToken>%s</NextContinuationToken>", keys[len(keys)-1])
+	}
+	b.WriteString("</ListBucketResult>")
+	fmt.Fprint(w, b.String())
+}
+
+// verifyS3Request 按 Signature V4 重新计算签名，返回错误码，通过时返回空
+func verifyS3Request(r *http.Request, body []byte) string {
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		return "XAmzContentSHA256Mismatch"
+	}
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	fields := map[string]string{}
+	for _, part := range strings.Split(auth, ", ") {
+		k, v, _ := strings.Cut(part, "=")
+		fields[k] = v
+	}
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[0] != fakeS3AccessKey {
+		return "InvalidAccessKeyId"
+	}
+	date, region := credential[1], credential[2]
+
+	var headers strings.Builder
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	pairs := strings.Split(r.URL.RawQuery, "&")
+	sort.Strings(pairs)
+	canonicalQuery := strings.Join(pairs, "&")
+
+	canonical := strings.Join([]string{r.Method, r.URL.EscapedPath(), canonicalQuery, headers.String(),
+		fields["SignedHeaders"], r.Header.Get("X-Amz-Content-Sha256")}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	scope := strings.Join(credential[1:], "/")
+	stringToSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("X-Amz-Date") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + fakeS3SecretKey)
+	for _, s := range []string{date, region, "s3", "aws4_request", stringToSign} {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(s))
+		key = h.Sum(nil)
+	}
+	if hex.EncodeToString(key) != fields["Signature"] {
+		return "SignatureDoesNotMatch"
+	}
+	return ""
+}
+
+func newTestS3Storage(t *testing.T, f *fakeS3) *s3BackupStorage {
+	t.Helper()
+	req := f.target("s3")
+	storage, err := newBackupStorage(&model.BackupTarget{
+		Type: req.Type, Endpoint: req.Endpoint, Region: req.Region, Bucket: req.Bucket,
+		AccessKey: req.AccessKey, SecretKey: req.SecretKey, PathStyle: req.PathStyle, Prefix: "panel",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage.(*s3BackupStorage)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestS3StorageMultipartUpload(t *testing.T) {
+	f := newFakeS3(t)
+	storage := newTestS3Storage(t, f)
+	ctx := context.Background()
+
+	// 两个完整分片加一个不完整的分片
+	data := make([]byte, 2*backupStoragePartSize+1234)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := storage.Put(ctx, "room_1/big.tar.gz", bytes.NewReader(data), sha256Hex(data)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	stored, ok := f.object("panel/room_1/big.tar.gz")
+	if !ok || !bytes.Equal(stored, data) {
+		t.Fatal("合并后的对象与上传的数据不一致")
+	}
+	if n := f.countRequests("PUT /backups/panel/room_1/big.tar.gz?partNumber="); n != 3 {
+		t.Errorf("期望上传 3 个分片，实际 %d 个", n)
+	}
+	if got := f.meta["panel/room_1/big.tar.gz"].Get("X-Amz-Meta-Sha256"); got != sha256Hex(data) {
+		t.Errorf("元数据中的 SHA-256 不符: %s", got)
+	}
+
+	body, err := storage.Get(ctx, "room_1/big.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if !bytes.Equal(got, data) {
+		t.Error("下载的数据与上传的不一致")
+	}
+}
+
+func TestS3StorageChecksumMismatch(t *testing.T) {
+	f := newFakeS3(t)
+	storage := newTestS3Storage(t, f)
+	ctx := context.Background()
+	wrong := strings.Repeat("0", 64)
+
+	small := []byte("small archive")
+	if err := storage.Put(ctx, "room_1/small.tar.gz", bytes.NewReader(small), wrong); err == nil {
+		t.Error("SHA-256 不一致时应拒绝上传")
+	}
+	if _, ok := f.object("panel/room_1/small.tar.gz"); ok {
+		t.Error("校验失败的小文件不应上传")
+	}
+
+	big := make([]byte, backupStoragePartSize+1)
+	if err := storage.Put(ctx, "room_1/big.tar.gz", bytes.NewReader(big), wrong); err == nil {
+		t.Error("SHA-256 不一致时应拒绝上传")
+	}
+	if _, ok := f.object("panel/room_1/big.tar.gz"); ok {
+		t.Error("校验失败的分片上传不应合并")
+	}
+	if n := f.pendingUploads(); n != 0 {
+		t.Errorf("校验失败后应放弃分片上传，仍有 %d 个未结束", n)
+	}
+}
+
+func TestS3StorageETagMismatch(t *testing.T) {
+	f := newFakeS3(t)
+	storage := newTestS3Storage(t, f)
+	f.badETag = true
+	ctx := context.Background()
+
+	small := []byte("small archive")
+	err := storage.Put(ctx, "room_1/small.tar.gz", bytes.NewReader(small), sha256Hex(small))
+	if err == nil || !strings.Contains(err.Error(), "ETag") {
+		t.Errorf("ETag 不一致时应返回错误，实际为 %v", err)
+	}
+
+	big := make([]byte, backupStoragePartSize+1)
+	err = storage.Put(ctx, "room_1/big.tar.gz", bytes.NewReader(big), sha256Hex(big))
+	if err == nil || !strings.Contains(err.Error(), "ETag") {
+		t.Errorf("分片 ETag 不一致时应返回错误，实际为 %v", err)
+	}
+	if n := f.pendingUploads(); n != 0 {
+		t.Errorf("分片失败后应放弃分片上传，仍有 %d 个未结束", n)
+	}
+}
+
+func TestS3StorageBadCredentials(t *testing.T) {
+	f := newFakeS3(t)
+	req := f.target("s3")
+	storage, err := newBackupStorage(&model.BackupTarget{
+		Type: req.Type, Endpoint: req.Endpoint, Region: req.Region, Bucket: req.Bucket,
+		AccessKey: req.AccessKey, SecretKey: "wrong-secret", PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("archive")
+	err = storage.Put(context.Background(), "room_1/a.tar.gz", bytes.NewReader(data), sha256Hex(data))
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("密钥错误时应返回签名错误，实际为 %v", err)
+	}
+}
+
+func TestS3StorageListPagination(t *testing.T) {
+	f := newFakeS3(t)
+	f.maxKeys = 2
+	storage := newTestS3Storage(t, f)
+	ctx := context.Background()
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("room_%d/room%d-20240101-120000.tar.gz", i, i)
+		data := []byte(key)
+		if err := storage.Put(ctx, key, bytes.NewReader(data), sha256Hex(data)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, key)
+	}
+	// 前缀以外的对象不应列出
+	f.objects["other/room_9/x.tar.gz"] = []byte("x")
+
+	objects, err := storage.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, obj := range objects {
+		got = append(got, obj.Key)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("列表不符\n实际: %v\n期望: %v", got, want)
+	}
+	if n := f.countRequests("GET /backups/?continuation-token="); n != 2 {
+		t.Errorf("期望翻页 2 次，实际 %d 次", n)
+	}
+}
+
+// buildTestBackupArchive 生成带清单和一个世界文件的备份归档
+func buildTestBackupArchive(t *testing.T, world []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	manifest, _ := json.Marshal(BackupManifest{
+		RoomID:    7,
+		RoomName:  "old room",
+		WorldName: "World",
+		Worlds:    []string{"World.wld"},
+		CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	})
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{{backupManifestName, manifest}, {"worlds/World.wld", world}} {
+		tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data))})
+		tw.Write(file.data)
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestImportFromS3Target(t *testing.T) {
+	setupTestEnv(t)
+	f := newFakeS3(t)
+	f.maxKeys = 1
+
+	room := &model.Room{Name: "new room", Type: model.ServerTypeVanilla, Port: 7777, WorldName: "World"}
+	if err := utils.DB.Create(room).Error; err != nil {
+		t.Fatal(err)
+	}
+	archive := buildTestBackupArchive(t, []byte("world data"))
+	f.objects["room_7/room7-20240101-120000.tar.gz"] = archive
+	f.objects["room_7/notes.txt"] = []byte("不是备份归档")
+
+	service := NewBackupService()
+	target, err := service.CreateTarget(f.target("offsite"))
+	if err != nil {
+		t.Fatalf("CreateTarget: %v", err)
+	}
+
+	listed, err := service.ListTargetBackups(target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Key != "room_7/room7-20240101-120000.tar.gz" || listed[0].RoomID != 7 || listed[0].BackupID != nil {
+		t.Fatalf("列表不符: %+v", listed)
+	}
+
+	backup, err := service.ImportFromTarget(target.ID, ImportBackupRequest{Key: listed[0].Key, RoomID: room.ID})
+	if err != nil {
+		t.Fatalf("ImportFromTarget: %v", err)
+	}
+	if backup.RoomID != room.ID || backup.Trigger != model.BackupTriggerImport || backup.SHA256 != sha256Hex(archive) {
+		t.Errorf("导入的备份不符: %+v", backup)
+	}
+	if backup.WorldName != "World" || len(backup.Worlds) != 1 {
+		t.Errorf("未读取备份清单: %+v", backup)
+	}
+	if _, err := service.ImportFromTarget(target.ID, ImportBackupRequest{Key: listed[0].Key, RoomID: room.ID}); err == nil {
+		t.Error("重复导入应返回错误")
+	}
+
+	listed, _ = service.ListTargetBackups(target.ID)
+	if len(listed) != 1 || listed[0].BackupID == nil || *listed[0].BackupID != backup.ID {
+		t.Errorf("导入后应标出已登记的备份: %+v", listed)
+	}
+
+	// 本地归档丢失时从备份存储取回
+	if err := os.Remove(service.BackupFilePath(backup)); err != nil {
+		t.Fatal(err)
+	}
+	archivePath, cleanup, err := service.OpenArchive(backup)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer cleanup()
+	restored, _ := os.ReadFile(archivePath)
+	if !bytes.Equal(restored, archive) {
+		t.Error("取回的归档与备份存储中的不一致")
+	}
+
+	// 备份存储中的归档被改动时拒绝使用
+	os.Remove(archivePath)
+	f.objects["room_7/room7-20240101-120000.tar.gz"] = buildTestBackupArchive(t, []byte("tampered"))
+	if _, _, err := service.OpenArchive(backup); err == nil {
+		t.Error("副本校验失败时应返回错误")
+	}
+}
+
+func TestLocalTargetAllowedRoots(t *testing.T) {
+	cfg := setupTestEnv(t)
+	service := NewBackupService()
+	root := t.TempDir()
+	outside := t.TempDir()
+	request := func(path string) BackupTargetRequest {
+		return BackupTargetRequest{Name: filepath.Base(path), Type: model.BackupTargetLocal, Enabled: true, Path: path}
+	}
+
+	if _, err := service.CreateTarget(request(filepath.Join(root, "disk"))); err == nil {
+		t.Error("未配置允许的目录时不应允许本地存储")
+	}
+
+	cfg.BackupLocalRoots = []string{root}
+	if _, err := service.CreateTarget(request(filepath.Join(root, "disk"))); err != nil {
+		t.Fatalf("允许的目录中应可以添加: %v", err)
+	}
+	for _, path := range []string{outside, filepath.Join(root, "..", filepath.Base(outside)), "/etc"} {
+		if _, err := service.CreateTarget(request(path)); err == nil {
+			t.Errorf("目录 %s 不在允许的目录中，应返回错误", path)
+		}
+	}
+
+	// 通过允许目录中的符号链接指向外部
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Skip("无法创建符号链接")
+	}
+	if _, err := service.CreateTarget(request(filepath.Join(link, "sub"))); err == nil {
+		t.Error("符号链接指向允许的目录之外时应返回错误")
+	}
+}
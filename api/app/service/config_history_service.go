@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"terraria-api/app/model"
+	"terraria-api/utils"
+)
+
+// 每个配置文件保留的历史版本数
+const maxConfigRevisions = 50
+
+// ConfigHistoryService 配置文件历史服务
+type ConfigHistoryService struct{}
+
+// NewConfigHistoryService 创建配置历史服务
+func NewConfigHistoryService() *ConfigHistoryService {
+	return &ConfigHistoryService{}
+}
+
+// Record 记录配置文件的一个版本，内容与最新版本相同时不重复记录
+func (s *ConfigHistoryService) Record(roomId uint, kind, path, content, note string) (*model.ConfigRevision, error) {
+	var latest model.ConfigRevision
+	utils.DB.Where("room_id = ? AND kind = ? AND path = ?", roomId, kind, path).
+		Order("id desc").Limit(1).Find(&latest)
+	if latest.ID != 0 && latest.Content == content {
+		return &latest, nil
+	}
+
+	revision := &model.ConfigRevision{
+		RoomID:  roomId,
+		Kind:    kind,
+		Path:    path,
+		Content: content,
+		Note:    note,
+	}
+	if err := utils.DB.Create(revision).Error; err != nil {
+		return nil, err
+	}
+
+	// 清理超出保留数量的旧版本
+	var stale []uint
+	utils.DB.Model(&model.ConfigRevision{}).
+		Where("room_id = ? AND kind = ? AND path = ?", roomId, kind, path).
+		Order("id desc").Offset(maxConfigRevisions).Pluck("id", &stale)
+	if len(stale) > 0 {
+		utils.DB.Delete(&model.ConfigRevision{}, stale)
+	}
+
+	return revision, nil
+}
+
+// List 获取配置文件的历史版本（新的在前）
+func (s *ConfigHistoryService) List(roomId uint, kind, path string) ([]model.ConfigRevision, error) {
+	revisions := []model.ConfigRevision{}
+	err := utils.DB.Where("room_id = ? AND kind = ? AND path = ?", roomId, kind, path).
+		Order("id desc").Find(&revisions).Error
+	return revisions, err
+}
+
+// Get 获取房间的某个历史版本
+func (s *ConfigHistoryService) Get(roomId uint, kind string, revisionId uint) (*model.ConfigRevision, error) {
+	var revision model.ConfigRevision
+	if err := utils.DB.Where("room_id = ? AND kind = ?", roomId, kind).First(&revision, revisionId).Error; err != nil {
+		return nil, errors.New("历史版本不存在")
+	}
+	return &revision, nil
+}
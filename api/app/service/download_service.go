@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"terraria-api/config"
+	"time"
+)
+
+const (
+	// 每个下载地址的最大尝试次数（中断后断点续传）
+	downloadMaxAttempts = 3
+	// 连续多久没有收到数据视为连接卡死
+	downloadStallTimeout = 60 * time.Second
+)
+
+// downloadClient 下载使用的HTTP客户端，只限制建立连接和等待响应头的时间，不限制整体下载时长
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   15 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// 同一个缓存文件同一时间只允许一个下载
+var (
+	downloadLocksMu sync.Mutex
+	downloadLocks   = make(map[string]*sync.Mutex)
+)
+
+// MirrorRule 下载地址改写规则：以 Match 开头的地址，把该前缀替换为 Replace
+// GitHub 代理前缀示例：{"match": "https://github.com/", "replace": "https://github.akams.cn/https://github.com/"}
+type MirrorRule struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// MirrorConfig 镜像配置文件（download_mirrors.json）
+type MirrorConfig struct {
+	Rules []MirrorRule `json:"rules"`
+	// OriginalFirst 为 true 时先尝试原始地址，否则先尝试镜像
+	OriginalFirst bool `json:"originalFirst"`
+}
+
+// DownloadRequest 下载请求
+type DownloadRequest struct {
+	URL     string   // 原始地址
+	Mirrors []string // 额外的备用地址
+	SHA256  string   // 期望的 SHA-256，为空时不校验，按地址缓存
+	// Progress 下载进度回调，total 未知时为 0
+	Progress func(url string, done, total int64)
+}
+
+// DownloadResult 下载结果
+type DownloadResult struct {
+	Path   string `json:"path"` // 缓存中的文件路径，调用方不应修改或删除
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	URL    string `json:"url"` // 实际下载成功的地址
+	Cached bool   `json:"cached"`
+}
+
+// downloadMeta 未完成下载的续传信息
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified"`
+}
+
+// DownloadService 带镜像、断点续传和共享缓存的下载服务
+type DownloadService struct{}
+
+// NewDownloadService 创建下载服务
+func NewDownloadService() *DownloadService {
+	return &DownloadService{}
+}
+
+// LoadMirrorConfig 读取镜像配置，文件不存在时返回空配置
+func (s *DownloadService) LoadMirrorConfig() (*MirrorConfig, error) {
+	cfg := &MirrorConfig{}
+	content, err := os.ReadFile(config.GlobalConfig.DownloadMirrors)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("镜像配置格式错误: %w", err)
+	}
+	return cfg, nil
+}
+
+// CandidateURLs 按镜像规则生成下载地址列表（去重）
+func (s *DownloadService) CandidateURLs(url string, mirrors []string) []string {
+	cfg, err := s.LoadMirrorConfig()
+	if err != nil {
+		log.Printf("⚠️ 读取镜像配置失败，仅使用原始地址: %v", err)
+		cfg = &MirrorConfig{}
+	}
+
+	var rewritten []string
+	for _, rule := range cfg.Rules {
+		if rule.Match != "" && strings.HasPrefix(url, rule.Match) {
+			rewritten = append(rewritten, rule.Replace+strings.TrimPrefix(url, rule.Match))
+		}
+	}
+
+	var ordered []string
+	if cfg.OriginalFirst {
+		ordered = append(append([]string{url}, rewritten...), mirrors...)
+	} else {
+		ordered = append(append(rewritten, url), mirrors...)
+	}
+
+	seen := make(map[string]bool)
+	urls := []string{}
+	for _, u := range ordered {
+		if u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// Fetch 下载文件到共享缓存
+// 依次尝试各个地址，每个地址失败后断点续传重试；已缓存且校验通过时直接返回
+func (s *DownloadService) Fetch(ctx context.Context, req DownloadRequest) (*DownloadResult, error) {
+	cacheDir := filepath.Join(config.GlobalConfig.DataPath, "downloads")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+
+	expected := strings.ToLower(req.SHA256)
+	key := expected
+	if key == "" {
+		hash := sha1.Sum([]byte(req.URL))
+		key = "url-" + hex.EncodeToString(hash[:])
+	}
+	dest := filepath.Join(cacheDir, key)
+
+	lock := downloadLock(dest)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 命中缓存（没有校验和的文件按地址缓存，直接复用）
+	if info, err := os.Stat(dest); err == nil {
+		sum, _, err := fileSHA256(dest)
+		if err == nil && (expected == "" || sum == expected) {
+			return &DownloadResult{Path: dest, SHA256: sum, Size: info.Size(), URL: req.URL, Cached: true}, nil
+		}
+		os.Remove(dest)
+	}
+
+	var errs []string
+	for _, url := range s.CandidateURLs(req.URL, req.Mirrors) {
+		err := s.fetchURL(ctx, url, dest+".part", req.Progress)
+		if err == nil {
+			sum, size, hashErr := fileSHA256(dest + ".part")
+			if hashErr != nil {
+				return nil, hashErr
+			}
+			if expected != "" && sum != expected {
+				// 内容不对（镜像返回了错误的文件），丢弃后换下一个地址
+				os.Remove(dest + ".part")
+				os.Remove(dest + ".part.meta")
+				err = fmt.Errorf("SHA-256校验失败: 期望 %s，实际 %s", expected, sum)
+			} else {
+				if err := os.Rename(dest+".part", dest); err != nil {
+					return nil, err
+				}
+				os.Remove(dest + ".part.meta")
+				return &DownloadResult{Path: dest, SHA256: sum, Size: size, URL: url}, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("⚠️ 下载失败 %s: %v", url, err)
+		errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("没有可用的下载地址")
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+// fetchURL 从单个地址下载，失败时按退避间隔重试并续传
+func (s *DownloadService) fetchURL(ctx context.Context, url, partPath string, progress func(string, int64, int64)) error {
+	var err error
+	for attempt := 1; attempt <= downloadMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(time.Duration(1<<(attempt-2)) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err = s.fetchOnce(ctx, url, partPath, progress); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var status httpStatusError
+		if errors.As(err, &status) && status < 500 && status != http.StatusTooManyRequests {
+			// 客户端错误重试也不会成功
+			return err
+		}
+	}
+	return err
+}
+
+// httpStatusError 非预期的HTTP状态码
+type httpStatusError int
+
+func (e httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", int(e))
+}
+
+// fetchOnce 发起一次请求；已有同一地址或带校验器的部分文件时使用 Range 续传
+func (s *DownloadService) fetchOnce(ctx context.Context, url, partPath string, progress func(string, int64, int64)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	meta := readDownloadMeta(partPath)
+	if meta != nil && meta.URL != url && meta.ETag == "" && meta.LastModified == "" {
+		// 部分文件来自其他地址且没有校验器，无法确认是同一个文件，从头下载
+		os.Remove(partPath)
+		os.Remove(partPath + ".meta")
+		meta = nil
+	}
+	if info, err := os.Stat(partPath); err == nil && info.Size() > 0 && meta != nil {
+		offset = info.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// 校验器不一致时服务器会返回完整内容
+		if meta.ETag != "" {
+			req.Header.Set("If-Range", meta.ETag)
+		} else if meta.LastModified != "" {
+			req.Header.Set("If-Range", meta.LastModified)
+		}
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var out *os.File
+	var total int64
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if start := contentRangeStart(resp.Header.Get("Content-Range")); start != offset {
+			return fmt.Errorf("服务器返回的续传位置不正确: %s", resp.Header.Get("Content-Range"))
+		}
+		out, err = os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0644)
+		if resp.ContentLength > 0 {
+			total = offset + resp.ContentLength
+		}
+	case resp.StatusCode == http.StatusOK:
+		offset = 0
+		out, err = os.Create(partPath)
+		if resp.ContentLength > 0 {
+			total = resp.ContentLength
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// 部分文件已损坏或比远端文件还大，从头下载
+		os.Remove(partPath)
+		os.Remove(partPath + ".meta")
+		return httpStatusError(http.StatusServiceUnavailable)
+	default:
+		return httpStatusError(resp.StatusCode)
+	}
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writeDownloadMeta(partPath, &downloadMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+
+	// 一段时间没有收到数据时取消请求，交给重试逻辑续传
+	stall := time.AfterFunc(downloadStallTimeout, cancel)
+	defer stall.Stop()
+
+	done := offset
+	if progress != nil {
+		progress(url, done, total)
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			stall.Reset(downloadStallTimeout)
+			if _, err := out.Write(buf[:n]); err != nil {
+				return err
+			}
+			done += int64(n)
+			if progress != nil {
+				progress(url, done, total)
+			}
+		}
+		if readErr == io.EOF {
+			if total > 0 && done != total {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// downloadLock 获取缓存文件对应的锁
+func downloadLock(path string) *sync.Mutex {
+	downloadLocksMu.Lock()
+	defer downloadLocksMu.Unlock()
+
+	lock, ok := downloadLocks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		downloadLocks[path] = lock
+	}
+	return lock
+}
+
+// readDownloadMeta 读取续传信息，不存在或损坏时返回 nil
+func readDownloadMeta(partPath string) *downloadMeta {
+	content, err := os.ReadFile(partPath + ".meta")
+	if err != nil {
+		return nil
+	}
+	var meta downloadMeta
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+// writeDownloadMeta 保存续传信息
+func writeDownloadMeta(partPath string, meta *downloadMeta) {
+	content, _ := json.Marshal(meta)
+	os.WriteFile(partPath+".meta", content, 0644)
+}
+
+// contentRangeStart 解析 Content-Range 的起始位置（bytes 100-199/200）
+func contentRangeStart(header string) int64 {
+	header = strings.TrimPrefix(header, "bytes ")
+	start, _, ok := strings.Cut(header, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dropConnection 发送完整的响应头和一半内容后断开连接
+func dropConnection(t *testing.T, w http.ResponseWriter, data []byte, header string) {
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n%s\r\n", len(data), header)
+	buf.Write(data[:len(data)/2])
+	buf.Flush()
+}
+
+func testDownloadData() []byte {
+	data := make([]byte, 256*1024)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	return data
+}
+
+func TestDownloadResumeAfterDrop(t *testing.T) {
+	setupTestEnv(t)
+	data := testDownloadData()
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range")+"|"+r.Header.Get("If-Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+		if first {
+			dropConnection(t, w, data, "ETag: \"v1\"\r\n")
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "server.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	result, err := NewDownloadService().Fetch(context.Background(), DownloadRequest{URL: server.URL + "/server.zip", SHA256: sha256Hex(data)})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	got, _ := os.ReadFile(result.Path)
+	if !bytes.Equal(got, data) {
+		t.Fatal("续传后的文件与原文件不一致")
+	}
+	want := fmt.Sprintf("bytes=%d-|\"v1\"", len(data)/2)
+	if len(ranges) != 2 || ranges[0] != "|" || ranges[1] != want {
+		t.Errorf("请求不符: %q，第二次请求应为 %q", ranges, want)
+	}
+	if _, err := os.Stat(result.Path + ".part.meta"); !os.IsNotExist(err) {
+		t.Error("下载完成后应删除续传信息")
+	}
+
+	// 再次下载直接使用缓存
+	cached, err := NewDownloadService().Fetch(context.Background(), DownloadRequest{URL: server.URL + "/server.zip", SHA256: sha256Hex(data)})
+	if err != nil || !cached.Cached || len(ranges) != 2 {
+		t.Errorf("应命中缓存: %+v, %v", cached, err)
+	}
+}
+
+func TestDownloadNoResumeAcrossMirrors(t *testing.T) {
+	setupTestEnv(t)
+	data := testDownloadData()
+
+	// 第一个地址没有 ETag 和 Last-Modified，中途断开后不再可用
+	var primaryHits int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits++
+		if primaryHits == 1 {
+			dropConnection(t, w, data, "")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer primary.Close()
+
+	var mirrorRanges []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorRanges = append(mirrorRanges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "server.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer mirror.Close()
+
+	result, err := NewDownloadService().Fetch(context.Background(), DownloadRequest{
+		URL:     primary.URL + "/server.zip",
+		Mirrors: []string{mirror.URL + "/server.zip"},
+		SHA256:  sha256Hex(data),
+	})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if !strings.HasPrefix(result.URL, mirror.URL) {
+		t.Errorf("应从镜像下载完成，实际为 %s", result.URL)
+	}
+	if len(mirrorRanges) != 1 || mirrorRanges[0] != "" {
+		t.Errorf("没有校验器时不应向其他地址续传，镜像收到的 Range: %q", mirrorRanges)
+	}
+	got, _ := os.ReadFile(result.Path)
+	if !bytes.Equal(got, data) {
+		t.Fatal("下载的文件与原文件不一致")
+	}
+}
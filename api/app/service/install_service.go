@@ -0,0 +1,498 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// 安装任务状态
+const (
+	InstallStateQueued      = "queued"
+	InstallStateDownloading = "downloading"
+	InstallStateExtracting  = "extracting"
+	InstallStateDone        = "done"
+	InstallStateFailed      = "failed"
+	InstallStateCanceled    = "canceled"
+)
+
+const (
+	// 同时执行的安装任务数，其余任务排队
+	maxConcurrentInstalls = 2
+	// 已结束的任务保留时长
+	installJobRetention = time.Hour
+	// 下载进度推送的最小间隔
+	installProgressInterval = 500 * time.Millisecond
+)
+
+// InstallJob 游戏服务端安装任务
+type InstallJob struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Version     string     `json:"version"`
+	DownloadURL string     `json:"download_url"`
+	CurrentURL  string     `json:"current_url"` // 正在使用的下载地址（可能是镜像）
+	Cached      bool       `json:"cached"`      // 安装包来自下载缓存
+	SHA256      string     `json:"sha256"`
+	Verified    bool       `json:"verified"` // 下载内容是否经过 SHA-256 校验
+	State       string     `json:"state"`
+	InstallDir  string     `json:"install_dir"`
+	BytesDone   int64      `json:"bytes_done"`
+	BytesTotal  int64      `json:"bytes_total"` // 服务器未返回长度时为 0
+	Speed       int64      `json:"speed"`       // 字节/秒
+	Error       string     `json:"error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+
+	mirrors     []string
+	cancel      context.CancelFunc
+	subscribers map[chan InstallJob]bool
+}
+
+// Finished 任务是否已结束
+func (j *InstallJob) Finished() bool {
+	return j.State == InstallStateDone || j.State == InstallStateFailed || j.State == InstallStateCanceled
+}
+
+// snapshot 复制任务的公开状态
+func (j *InstallJob) snapshot() InstallJob {
+	snapshot := *j
+	snapshot.mirrors = nil
+	snapshot.cancel = nil
+	snapshot.subscribers = nil
+	return snapshot
+}
+
+// InstallSource 安装来源
+type InstallSource struct {
+	Name        string
+	Type        string
+	Version     string
+	DownloadURL string
+	Mirrors     []string
+	SHA256      string // 为空时不校验（仅管理员可以安装未校验的来源）
+}
+
+// InstallService 游戏服务端安装任务管理
+type InstallService struct {
+	mu    sync.Mutex
+	jobs  map[string]*InstallJob
+	slots chan struct{}
+}
+
+var (
+	installServiceOnce     sync.Once
+	installServiceInstance *InstallService
+)
+
+// NewInstallService 获取安装服务（全局共享任务列表）
+func NewInstallService() *InstallService {
+	installServiceOnce.Do(func() {
+		installServiceInstance = &InstallService{
+			jobs:  make(map[string]*InstallJob),
+			slots: make(chan struct{}, maxConcurrentInstalls),
+		}
+	})
+	return installServiceInstance
+}
+
+// ValidateTarget 检查服务端类型和版本号，版本号会作为安装目录名的一部分，不能包含路径分隔符
+func (s *InstallService) ValidateTarget(serverType, version string) error {
+	switch model.ServerType(serverType) {
+	case model.ServerTypeVanilla, model.ServerTypeTShock, model.ServerTypeTModLoader:
+	default:
+		return fmt.Errorf("不支持的服务端类型: %s", serverType)
+	}
+	if version == "" || version == "." || strings.ContainsAny(version, `/\`) || strings.Contains(version, "..") {
+		return fmt.Errorf("无效的版本号: %s", version)
+	}
+	return nil
+}
+
+// InstallDir 版本对应的安装目录
+func (s *InstallService) InstallDir(serverType, version string) string {
+	return filepath.Join(config.GlobalConfig.ServerPath, fmt.Sprintf("%s-%s", serverType, version))
+}
+
+// IsInstalled 检查版本是否已安装（安装目录中有适用于当前系统的启动程序）
+func (s *InstallService) IsInstalled(serverType, version string) bool {
+	_, err := DetectServerEntry(s.InstallDir(serverType, version), model.ServerType(serverType))
+	return err == nil
+}
+
+// IsInstalling 安装目录是否有未结束的安装任务
+func (s *InstallService) IsInstalling(installDir string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if filepath.Clean(job.InstallDir) == filepath.Clean(installDir) && !job.Finished() {
+			return true
+		}
+	}
+	return false
+}
+
+// StartInstall 创建安装任务并在后台执行
+// 同一版本已有未结束的任务时直接返回该任务
+func (s *InstallService) StartInstall(source InstallSource) (*InstallJob, error) {
+	if err := s.ValidateTarget(source.Type, source.Version); err != nil {
+		return nil, err
+	}
+	installDir := s.InstallDir(source.Type, source.Version)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked()
+	for _, job := range s.jobs {
+		if job.InstallDir == installDir && !job.Finished() {
+			snapshot := job.snapshot()
+			return &snapshot, nil
+		}
+	}
+
+	id, err := newInstallJobID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	job := &InstallJob{
+		ID:          id,
+		Name:        source.Name,
+		Type:        source.Type,
+		Version:     source.Version,
+		DownloadURL: source.DownloadURL,
+		mirrors:     source.Mirrors,
+		SHA256:      strings.ToLower(source.SHA256),
+		Verified:    source.SHA256 != "",
+		State:       InstallStateQueued,
+		InstallDir:  installDir,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		cancel:      cancel,
+		subscribers: make(map[chan InstallJob]bool),
+	}
+	s.jobs[id] = job
+
+	go s.run(ctx, job)
+
+	snapshot := job.snapshot()
+	return &snapshot, nil
+}
+
+// GetJob 获取任务状态
+func (s *InstallService) GetJob(id string) (*InstallJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errors.New("安装任务不存在")
+	}
+	snapshot := job.snapshot()
+	return &snapshot, nil
+}
+
+// ListJobs 获取所有任务（新的在前）
+func (s *InstallService) ListJobs() []InstallJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked()
+	jobs := make([]InstallJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// CancelJob 取消未结束的任务
+func (s *InstallService) CancelJob(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return errors.New("安装任务不存在")
+	}
+	if job.Finished() {
+		return errors.New("安装任务已结束")
+	}
+	job.cancel()
+	return nil
+}
+
+// Subscribe 订阅任务状态变化，立即推送一次当前状态；任务结束后通道关闭
+// 订阅者处理较慢时只保留最新的状态
+func (s *InstallService) Subscribe(id string) (<-chan InstallJob, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil, errors.New("安装任务不存在")
+	}
+
+	ch := make(chan InstallJob, 1)
+	ch <- job.snapshot()
+	if job.Finished() {
+		close(ch)
+		return ch, func() {}, nil
+	}
+
+	job.subscribers[ch] = true
+	unsubscribe := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if job.subscribers[ch] {
+			delete(job.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe, nil
+}
+
+// run 执行安装任务
+func (s *InstallService) run(ctx context.Context, job *InstallJob) {
+	defer job.cancel()
+
+	// 等待空闲的安装槽位
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		s.finish(job, ctx.Err())
+		return
+	}
+
+	err := s.install(ctx, job)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	s.finish(job, err)
+}
+
+// install 下载并解压到临时目录，完成后再替换到安装目录，失败时不留下不完整的安装
+func (s *InstallService) install(ctx context.Context, job *InstallJob) error {
+	if err := os.MkdirAll(config.GlobalConfig.ServerPath, 0755); err != nil {
+		return err
+	}
+	stagingDir := filepath.Join(config.GlobalConfig.ServerPath, ".install-"+job.ID)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	s.update(job, func(j *InstallJob) { j.State = InstallStateDownloading })
+	result, err := s.download(ctx, job)
+	if err != nil {
+		return fmt.Errorf("下载失败: %w", err)
+	}
+	// Fetch 已在缓存前校验，这里再确认一次，保证校验失败时不会解压
+	if job.SHA256 != "" && result.SHA256 != job.SHA256 {
+		return fmt.Errorf("SHA-256校验失败: 期望 %s，实际 %s", job.SHA256, result.SHA256)
+	}
+
+	s.update(job, func(j *InstallJob) {
+		j.State = InstallStateExtracting
+		j.Speed = 0
+	})
+	extractDir := filepath.Join(stagingDir, "files")
+	if err := extractServerArchive(ctx, result.Path, extractDir); err != nil {
+		return fmt.Errorf("解压失败: %w", err)
+	}
+
+	entry, err := DetectServerEntry(extractDir, model.ServerType(job.Type))
+	if err != nil {
+		return err
+	}
+	// 从 Windows 打包的压缩包可能没有执行权限
+	if entry.Runtime == model.RuntimeNative && runtime.GOOS != "windows" {
+		os.Chmod(filepath.Join(extractDir, filepath.FromSlash(entry.EntryBinary)), 0755)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// 删除前再确认安装目录位于服务端目录下
+	if rel, err := filepath.Rel(config.GlobalConfig.ServerPath, job.InstallDir); err != nil || rel == "." || strings.Contains(rel, string(filepath.Separator)) || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("安装目录不在服务端目录下: %s", job.InstallDir)
+	}
+	if err := os.RemoveAll(job.InstallDir); err != nil {
+		return err
+	}
+	if err := os.Rename(extractDir, job.InstallDir); err != nil {
+		return err
+	}
+
+	return NewInstallationService().Record(&model.Installation{
+		Name:           job.Name,
+		Type:           model.ServerType(job.Type),
+		Version:        job.Version,
+		Path:           job.InstallDir,
+		EntryBinary:    entry.EntryBinary,
+		Runtime:        entry.Runtime,
+		RuntimeVersion: entry.RuntimeVersion,
+		DownloadURL:    job.DownloadURL,
+		SHA256:         job.SHA256,
+		Verified:       job.Verified,
+	})
+}
+
+// download 通过下载服务获取安装包（镜像、断点续传、共享缓存），并更新任务进度
+func (s *InstallService) download(ctx context.Context, job *InstallJob) (*DownloadResult, error) {
+	var lastDone int64
+	lastReport := time.Now()
+	progress := func(url string, done, total int64) {
+		elapsed := time.Since(lastReport)
+		if elapsed < installProgressInterval && (total == 0 || done < total) {
+			return
+		}
+		speed := int64(0)
+		if done >= lastDone {
+			speed = int64(float64(done-lastDone) / elapsed.Seconds())
+		}
+		s.update(job, func(j *InstallJob) {
+			j.CurrentURL = url
+			j.BytesDone = done
+			j.BytesTotal = total
+			j.Speed = speed
+		})
+		lastDone, lastReport = done, time.Now()
+	}
+
+	result, err := NewDownloadService().Fetch(ctx, DownloadRequest{
+		URL:      job.DownloadURL,
+		Mirrors:  job.mirrors,
+		SHA256:   job.SHA256,
+		Progress: progress,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.update(job, func(j *InstallJob) {
+		j.CurrentURL = result.URL
+		j.Cached = result.Cached
+		j.BytesDone = result.Size
+		j.BytesTotal = result.Size
+	})
+	return result, nil
+}
+
+// update 修改任务状态并通知订阅者
+func (s *InstallService) update(job *InstallJob, fn func(*InstallJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(job)
+	job.UpdatedAt = time.Now()
+	s.notifyLocked(job)
+}
+
+// finish 根据执行结果结束任务，并关闭所有订阅
+func (s *InstallService) finish(job *InstallJob, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	job.Speed = 0
+	switch {
+	case err == nil:
+		job.State = InstallStateDone
+		log.Printf("✅ 安装完成: %s %s", job.Type, job.Version)
+	case errors.Is(err, context.Canceled):
+		job.State = InstallStateCanceled
+		job.Error = "安装已取消"
+	default:
+		job.State = InstallStateFailed
+		job.Error = err.Error()
+		log.Printf("❌ 安装失败: %s %s: %v", job.Type, job.Version, err)
+	}
+
+	s.notifyLocked(job)
+	for ch := range job.subscribers {
+		close(ch)
+	}
+	job.subscribers = make(map[chan InstallJob]bool)
+}
+
+// notifyLocked 向订阅者推送最新状态，丢弃未被读取的旧状态
+func (s *InstallService) notifyLocked(job *InstallJob) {
+	for ch := range job.subscribers {
+		select {
+		case ch <- job.snapshot():
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- job.snapshot()
+		}
+	}
+}
+
+// pruneLocked 清理过期的已结束任务
+func (s *InstallService) pruneLocked() {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > installJobRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// newInstallJobID 生成随机任务ID
+func newInstallJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// extractServerArchive 解压服务端归档，去掉单一的顶层目录
+// TShock 的 Linux 版本是 zip 中再套一个 tar（保留可执行权限），这种情况继续解压内层 tar
+func extractServerArchive(ctx context.Context, archiveFile, destDir string) error {
+	opts := utils.ExtractOptions{StripTopLevel: true}
+	if err := utils.ExtractArchive(ctx, archiveFile, destDir, opts); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || entries[0].IsDir() {
+		return nil
+	}
+	name := strings.ToLower(entries[0].Name())
+	if !strings.HasSuffix(name, ".tar") && !strings.HasSuffix(name, ".tar.gz") && !strings.HasSuffix(name, ".tgz") {
+		return nil
+	}
+
+	inner := filepath.Join(destDir, entries[0].Name())
+	if err := utils.ExtractArchive(ctx, inner, destDir, opts); err != nil {
+		return err
+	}
+	return os.Remove(inner)
+}
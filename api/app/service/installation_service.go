@@ -0,0 +1,326 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+)
+
+// serverEntry 服务端启动程序的候选位置
+type serverEntry struct {
+	Path    string // 相对安装目录
+	GOOS    string // 为空表示不限系统
+	Runtime string
+}
+
+// serverEntries 各类型服务端的启动程序，按优先级排列
+var serverEntries = map[model.ServerType][]serverEntry{
+	model.ServerTypeTShock: {
+		// TShock 5（.NET）：自包含发行包带有原生启动程序，否则用 dotnet 运行 dll
+		{Path: "TShock.Server.exe", GOOS: "windows", Runtime: model.RuntimeNative},
+		{Path: "TShock.Server", GOOS: "linux", Runtime: model.RuntimeNative},
+		{Path: "TShock.Server", GOOS: "darwin", Runtime: model.RuntimeNative},
+		{Path: "TShock.Server.dll", Runtime: model.RuntimeDotnet},
+		// TShock 4（Mono）
+		{Path: "TerrariaServer.exe", Runtime: model.RuntimeMono},
+	},
+	model.ServerTypeTModLoader: {
+		// tModLoader 1.4（.NET）
+		{Path: "tModLoader.dll", Runtime: model.RuntimeDotnet},
+		// tModLoader 1.3
+		{Path: "tModLoaderServer.exe", GOOS: "windows", Runtime: model.RuntimeNative},
+		{Path: "tModLoaderServer.bin.x86_64", GOOS: "linux", Runtime: model.RuntimeNative},
+		{Path: "tModLoaderServer.bin.osx", GOOS: "darwin", Runtime: model.RuntimeNative},
+	},
+	model.ServerTypeVanilla: {
+		// 官方压缩包中按平台分目录
+		{Path: "Windows/TerrariaServer.exe", GOOS: "windows", Runtime: model.RuntimeNative},
+		{Path: "TerrariaServer.exe", GOOS: "windows", Runtime: model.RuntimeNative},
+		{Path: "Linux/TerrariaServer.bin.x86_64", GOOS: "linux", Runtime: model.RuntimeNative},
+		{Path: "TerrariaServer.bin.x86_64", GOOS: "linux", Runtime: model.RuntimeNative},
+		{Path: "Mac/Terraria Server.app/Contents/MacOS/TerrariaServer.bin.osx", GOOS: "darwin", Runtime: model.RuntimeNative},
+		{Path: "TerrariaServer.bin.osx", GOOS: "darwin", Runtime: model.RuntimeNative},
+		// 其他平台用 Mono 运行 Windows 版
+		{Path: "Windows/TerrariaServer.exe", Runtime: model.RuntimeMono},
+		{Path: "TerrariaServer.exe", Runtime: model.RuntimeMono},
+	},
+}
+
+// ServerEntryInfo 检测到的启动程序
+type ServerEntryInfo struct {
+	EntryBinary    string
+	Runtime        string
+	RuntimeVersion string
+}
+
+// DetectServerEntry 检测安装目录中适用于当前系统的启动程序和运行时要求
+func DetectServerEntry(dir string, serverType model.ServerType) (*ServerEntryInfo, error) {
+	return detectServerEntry(dir, serverType, runtime.GOOS)
+}
+
+// detectServerEntry 按类型和系统检测启动程序
+func detectServerEntry(dir string, serverType model.ServerType, goos string) (*ServerEntryInfo, error) {
+	candidates, ok := serverEntries[serverType]
+	if !ok {
+		return nil, fmt.Errorf("不支持的服务器类型: %s", serverType)
+	}
+
+	for _, candidate := range candidates {
+		if candidate.GOOS != "" && candidate.GOOS != goos {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(candidate.Path)))
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		entry := &ServerEntryInfo{EntryBinary: candidate.Path, Runtime: candidate.Runtime}
+		// Windows 上 .exe 不需要 Mono
+		if entry.Runtime == model.RuntimeMono && goos == "windows" {
+			entry.Runtime = model.RuntimeNative
+		}
+		// .NET 程序的 runtimeconfig.json 声明了需要的框架版本，自包含发行包不需要安装运行时
+		if version, selfContained, ok := readRuntimeConfig(dir, candidate.Path); ok && !selfContained {
+			if entry.Runtime == model.RuntimeNative {
+				continue // 框架依赖的原生启动程序，改用 dotnet 运行 dll
+			}
+			entry.RuntimeVersion = version
+		}
+		return entry, nil
+	}
+
+	return nil, fmt.Errorf("没有找到适用于 %s 的 %s 服务端程序", goos, serverType)
+}
+
+// readRuntimeConfig 读取 .NET 程序的 runtimeconfig.json
+// 返回需要的 Microsoft.NETCore.App 版本，以及是否为自包含发行包
+func readRuntimeConfig(dir, entry string) (version string, selfContained bool, ok bool) {
+	base := strings.TrimSuffix(strings.TrimSuffix(filepath.FromSlash(entry), ".dll"), ".exe")
+	content, err := os.ReadFile(filepath.Join(dir, base+".runtimeconfig.json"))
+	if err != nil {
+		return "", false, false
+	}
+
+	type framework struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	var rc struct {
+		RuntimeOptions struct {
+			Framework          *framework  `json:"framework"`
+			Frameworks         []framework `json:"frameworks"`
+			IncludedFrameworks []framework `json:"includedFrameworks"`
+		} `json:"runtimeOptions"`
+	}
+	if err := json.Unmarshal(content, &rc); err != nil {
+		return "", false, false
+	}
+
+	opts := rc.RuntimeOptions
+	if len(opts.IncludedFrameworks) > 0 {
+		return "", true, true
+	}
+	frameworks := opts.Frameworks
+	if opts.Framework != nil {
+		frameworks = append(frameworks, *opts.Framework)
+	}
+	for _, f := range frameworks {
+		if f.Name == "Microsoft.NETCore.App" {
+			return f.Version, false, true
+		}
+	}
+	if len(frameworks) > 0 {
+		return frameworks[0].Version, false, true
+	}
+	return "", false, true
+}
+
+// InstallationService 已安装服务端管理
+type InstallationService struct{}
+
+// NewInstallationService 创建已安装服务端服务
+func NewInstallationService() *InstallationService {
+	return &InstallationService{}
+}
+
+// List 获取所有已安装的服务端，统计引用的房间数并检查运行时是否可用
+// 安装目录中存在但没有记录的版本（旧版本安装的）会被自动登记
+func (s *InstallationService) List() ([]model.Installation, error) {
+	s.scan()
+
+	var installations []model.Installation
+	if err := utils.DB.Order("type, version").Find(&installations).Error; err != nil {
+		return nil, err
+	}
+	runtimes := NewRuntimeService()
+	for i := range installations {
+		utils.DB.Model(&model.Room{}).Where("installation_id = ?", installations[i].ID).Count(&installations[i].RoomCount)
+		if _, err := runtimes.Resolve(&installations[i]); err != nil {
+			installations[i].RuntimeError = err.Error()
+		}
+	}
+	return installations, nil
+}
+
+// Get 根据ID获取已安装的服务端
+func (s *InstallationService) Get(id uint) (*model.Installation, error) {
+	var installation model.Installation
+	if err := utils.DB.First(&installation, id).Error; err != nil {
+		return nil, errors.New("安装不存在")
+	}
+	return &installation, nil
+}
+
+// Find 按类型和版本号查找已安装的服务端
+func (s *InstallationService) Find(serverType model.ServerType, version string) *model.Installation {
+	var installations []model.Installation
+	utils.DB.Where("type = ? AND version = ?", serverType, version).Limit(1).Find(&installations)
+	if len(installations) == 0 {
+		return nil
+	}
+	return &installations[0]
+}
+
+// Latest 获取某类型最新的已安装版本
+func (s *InstallationService) Latest(serverType model.ServerType) *model.Installation {
+	var installations []model.Installation
+	utils.DB.Where("type = ?", serverType).Find(&installations)
+	var latest *model.Installation
+	for i := range installations {
+		if latest == nil || utils.CompareVersions(installations[i].Version, latest.Version) > 0 {
+			latest = &installations[i]
+		}
+	}
+	return latest
+}
+
+// Record 登记（或更新）一个安装
+func (s *InstallationService) Record(installation *model.Installation) error {
+	if existing := s.Find(installation.Type, installation.Version); existing != nil {
+		installation.ID = existing.ID
+		installation.CreatedAt = existing.CreatedAt
+	}
+	return utils.DB.Save(installation).Error
+}
+
+// Uninstall 删除安装目录和记录，仍被房间使用时拒绝
+func (s *InstallationService) Uninstall(id uint) error {
+	installation, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	var rooms []model.Room
+	utils.DB.Where("installation_id = ?", id).Find(&rooms)
+	if len(rooms) > 0 {
+		names := make([]string, 0, len(rooms))
+		for _, room := range rooms {
+			names = append(names, room.Name)
+		}
+		return fmt.Errorf("该版本正在被房间使用: %s", strings.Join(names, ", "))
+	}
+
+	if NewInstallService().IsInstalling(installation.Path) {
+		return errors.New("该版本正在安装中")
+	}
+	if !isWithinServerPath(installation.Path) {
+		return errors.New("非法路径")
+	}
+	if err := os.RemoveAll(installation.Path); err != nil {
+		return err
+	}
+	if err := utils.DB.Delete(&model.Installation{}, id).Error; err != nil {
+		return err
+	}
+
+	log.Printf("✅ 已卸载 %s %s", installation.Type, installation.Version)
+	return nil
+}
+
+// FindByPath 根据安装目录查找
+func (s *InstallationService) FindByPath(dir string) *model.Installation {
+	s.scan()
+
+	var installations []model.Installation
+	utils.DB.Find(&installations)
+	for i := range installations {
+		if filepath.Clean(installations[i].Path) == filepath.Clean(dir) {
+			return &installations[i]
+		}
+	}
+	return nil
+}
+
+// scan 登记安装目录中尚未记录的版本，并清理目录已不存在的记录
+func (s *InstallationService) scan() {
+	var installations []model.Installation
+	utils.DB.Find(&installations)
+	known := make(map[string]bool)
+	for _, installation := range installations {
+		if _, err := os.Stat(installation.Path); os.IsNotExist(err) {
+			var count int64
+			utils.DB.Model(&model.Room{}).Where("installation_id = ?", installation.ID).Count(&count)
+			if count == 0 {
+				utils.DB.Delete(&model.Installation{}, installation.ID)
+				continue
+			}
+		}
+		known[filepath.Clean(installation.Path)] = true
+	}
+
+	entries, err := os.ReadDir(config.GlobalConfig.ServerPath)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(config.GlobalConfig.ServerPath, entry.Name())
+		if known[filepath.Clean(dir)] {
+			continue
+		}
+		serverType, version, ok := strings.Cut(entry.Name(), "-")
+		if !ok || version == "" {
+			continue
+		}
+		detected, err := DetectServerEntry(dir, model.ServerType(serverType))
+		if err != nil {
+			continue
+		}
+		installation := &model.Installation{
+			Name:           entry.Name(),
+			Type:           model.ServerType(serverType),
+			Version:        version,
+			Path:           dir,
+			EntryBinary:    detected.EntryBinary,
+			Runtime:        detected.Runtime,
+			RuntimeVersion: detected.RuntimeVersion,
+		}
+		if err := s.Record(installation); err != nil {
+			log.Printf("⚠️ 登记安装 %s 失败: %v", dir, err)
+		}
+	}
+}
+
+// isWithinServerPath 判断路径是否在服务端安装目录内
+func isWithinServerPath(dir string) bool {
+	root, err := filepath.Abs(config.GlobalConfig.ServerPath)
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, abs)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/utils"
+	"time"
+)
+
+// Mod配置的作用域
+const (
+	ModConfigScopeServer  = "server"
+	ModConfigScopeClient  = "client"
+	ModConfigScopeUnknown = "unknown"
+)
+
+// ModConfigService tModLoader Mod配置（ModConfigs）服务
+type ModConfigService struct {
+	history *ConfigHistoryService
+}
+
+// NewModConfigService 创建Mod配置服务
+func NewModConfigService() *ModConfigService {
+	return &ModConfigService{
+		history: NewConfigHistoryService(),
+	}
+}
+
+// ModConfigFile Mod配置文件信息
+// tModLoader 以 <Mod名称>_<配置类名>.json 的形式保存配置
+type ModConfigFile struct {
+	Mod             string    `json:"mod"`
+	ConfigName      string    `json:"configName"`
+	Path            string    `json:"path"` // 相对 ModConfigs 目录的文件名
+	Scope           string    `json:"scope"`
+	ScopeOverridden bool      `json:"scopeOverridden"` // 作用域由用户手动设置，而不是按配置类名推断
+	Size            int64     `json:"size"`
+	Modified        time.Time `json:"modified"`
+}
+
+// ModConfigContent Mod配置文件内容
+type ModConfigContent struct {
+	ModConfigFile
+	Content map[string]interface{} `json:"content"`
+}
+
+// ModConfigSaveResult 保存结果
+type ModConfigSaveResult struct {
+	Path            string `json:"path"`
+	RevisionID      uint   `json:"revisionId"`
+	RestartRequired bool   `json:"restartRequired"` // 服务器运行中，需要重启（或在游戏内重载）才会生效
+}
+
+// ListConfigFiles 列出房间已启用Mod的配置文件
+func (s *ModConfigService) ListConfigFiles(roomId uint) ([]ModConfigFile, error) {
+	if _, err := NewRoomModService().getTModLoaderRoom(roomId); err != nil {
+		return nil, err
+	}
+
+	enabled, err := readEnabledMods(getRoomModsDir(roomId))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(getRoomModConfigsDir(roomId))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	overrides := s.scopeOverrides(roomId)
+	files := []ModConfigFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			continue
+		}
+		file, ok := newModConfigFile(entry, enabled)
+		if !ok {
+			continue
+		}
+		if scope := overrides[file.Path]; scope != "" {
+			file.Scope = scope
+			file.ScopeOverridden = true
+		}
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Mod != files[j].Mod {
+			return files[i].Mod < files[j].Mod
+		}
+		return files[i].ConfigName < files[j].ConfigName
+	})
+	return files, nil
+}
+
+// GetConfigFile 读取Mod配置文件
+func (s *ModConfigService) GetConfigFile(roomId uint, path string) (*ModConfigContent, error) {
+	file, err := s.findConfigFile(roomId, path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := readJSONObject(filepath.Join(getRoomModConfigsDir(roomId), file.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ModConfigContent{ModConfigFile: *file, Content: content}, nil
+}
+
+// SaveConfigFile 校验并保存Mod配置，修改前后的内容都会记录到配置历史
+// 提交的内容会合并到现有配置中；已有键的值类型必须保持不变，避免tModLoader加载时重置配置
+func (s *ModConfigService) SaveConfigFile(roomId uint, path string, updates map[string]interface{}) (*ModConfigSaveResult, error) {
+	file, err := s.findConfigFile(roomId, path)
+	if err != nil {
+		return nil, err
+	}
+
+	fullPath := filepath.Join(getRoomModConfigsDir(roomId), file.Path)
+	current, err := readJSONObject(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if errs := validateConfigShape(current, updates, "$"); len(errs) > 0 {
+		return nil, fmt.Errorf("配置校验失败: %s", strings.Join(errs, "; "))
+	}
+
+	mergeJSONObject(current, updates)
+
+	return s.writeConfig(roomId, file, current, "修改配置")
+}
+
+// GetHistory 获取Mod配置文件的历史版本
+func (s *ModConfigService) GetHistory(roomId uint, path string) ([]model.ConfigRevision, error) {
+	file, err := s.findConfigFile(roomId, path)
+	if err != nil {
+		return nil, err
+	}
+	return s.history.List(roomId, model.ConfigKindModConfig, file.Path)
+}
+
+// RevertConfigFile 将Mod配置恢复到某个历史版本（恢复操作本身也会记录为新版本）
+func (s *ModConfigService) RevertConfigFile(roomId uint, revisionId uint) (*ModConfigSaveResult, error) {
+	revision, err := s.history.Get(roomId, model.ConfigKindModConfig, revisionId)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.findConfigFile(roomId, revision.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var content map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(revision.Content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&content); err != nil {
+		return nil, errors.New("历史版本内容损坏")
+	}
+
+	return s.writeConfig(roomId, file, content, fmt.Sprintf("恢复到版本 #%d", revision.ID))
+}
+
+// SetConfigScope 手动设置Mod配置的作用域，记录到配置历史中，scope 为空时恢复按配置类名推断
+func (s *ModConfigService) SetConfigScope(roomId uint, path, scope string) (*ModConfigFile, error) {
+	switch scope {
+	case "", ModConfigScopeServer, ModConfigScopeClient:
+	default:
+		return nil, fmt.Errorf("无效的作用域: %s", scope)
+	}
+	file, err := s.findConfigFile(roomId, path)
+	if err != nil {
+		return nil, err
+	}
+
+	note := "设置作用域为 " + scope
+	if scope == "" {
+		note = "清除手动设置的作用域"
+	}
+	if _, err := s.history.Record(roomId, model.ConfigKindModConfigScope, file.Path, scope, note); err != nil {
+		return nil, err
+	}
+	return s.findConfigFile(roomId, file.Path)
+}
+
+// scopeOverrides 房间中手动设置的作用域，按配置文件路径索引（每个文件取最新的记录）
+func (s *ModConfigService) scopeOverrides(roomId uint) map[string]string {
+	var revisions []model.ConfigRevision
+	utils.DB.Where("room_id = ? AND kind = ?", roomId, model.ConfigKindModConfigScope).
+		Order("id asc").Find(&revisions)
+	overrides := make(map[string]string, len(revisions))
+	for _, revision := range revisions {
+		overrides[revision.Path] = revision.Content
+	}
+	return overrides
+}
+
+// writeConfig 写入配置并记录历史
+func (s *ModConfigService) writeConfig(roomId uint, file *ModConfigFile, content map[string]interface{}, note string) (*ModConfigSaveResult, error) {
+	fullPath := filepath.Join(getRoomModConfigsDir(roomId), file.Path)
+
+	// 首次修改前先保存原始内容，保证可以回到修改前的状态
+	if original, err := os.ReadFile(fullPath); err == nil {
+		if _, err := s.history.Record(roomId, model.ConfigKindModConfig, file.Path, string(original), "修改前的原始配置"); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(fullPath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	revision, err := s.history.Record(roomId, model.ConfigKindModConfig, file.Path, string(data), note)
+	if err != nil {
+		return nil, err
+	}
+
+	room, err := NewRoomModService().getTModLoaderRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+	return &ModConfigSaveResult{
+		Path:            file.Path,
+		RevisionID:      revision.ID,
+		RestartRequired: room.Status == model.StatusRunning,
+	}, nil
+}
+
+// findConfigFile 在已启用Mod的配置文件中查找指定文件
+func (s *ModConfigService) findConfigFile(roomId uint, path string) (*ModConfigFile, error) {
+	files, err := s.ListConfigFiles(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	path = strings.TrimPrefix(filepath.ToSlash(path), "ModConfigs/")
+	for i := range files {
+		if strings.EqualFold(files[i].Path, path) {
+			return &files[i], nil
+		}
+	}
+	return nil, errors.New("该文件不是已启用Mod的配置文件")
+}
+
+// getRoomModConfigsDir 获取房间的ModConfigs目录
+func getRoomModConfigsDir(roomId uint) string {
+	return filepath.Join(getRoomDir(roomId), "ModConfigs")
+}
+
+// newModConfigFile 根据文件名匹配所属的已启用Mod
+// Mod名称本身可能包含下划线，因此取匹配到的最长Mod名称
+func newModConfigFile(entry os.DirEntry, enabled []string) (ModConfigFile, bool) {
+	base := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+
+	mod := ""
+	for _, name := range enabled {
+		if strings.HasPrefix(base, name+"_") && len(name) > len(mod) {
+			mod = name
+		}
+	}
+	if mod == "" {
+		return ModConfigFile{}, false
+	}
+
+	file := ModConfigFile{
+		Mod:        mod,
+		ConfigName: strings.TrimPrefix(base, mod+"_"),
+		Path:       entry.Name(),
+	}
+	file.Scope = guessModConfigScope(file.ConfigName)
+	if info, err := entry.Info(); err == nil {
+		file.Size = info.Size()
+		file.Modified = info.ModTime()
+	}
+	return file, true
+}
+
+// guessModConfigScope 根据配置类名推断作用域
+// 作用域由Mod代码中的 ConfigScope 决定，不会写入JSON，也无法在不加载Mod程序集的情况下读取，
+// 这里只按类名中包含 Server / Client 的常见约定识别，其余（多数Mod）为 unknown，可由用户手动设置
+
+func guessModConfigScope(configName string) string {
+	name := strings.ToLower(configName)
+	switch {
+	case strings.Contains(name, "server"):
+		return ModConfigScopeServer
+	case strings.Contains(name, "client"):
+		return ModConfigScopeClient
+	}
+	return ModConfigScopeUnknown
+}
+
+// validateConfigShape 校验提交的值与现有配置的类型一致
+// 现有配置中不存在的键不做限制，值为 null 的键可以改为任意类型
+func validateConfigShape(current, updates map[string]interface{}, at string) []string {
+	var errs []string
+	for key, value := range updates {
+		existing, ok := current[key]
+		if !ok || existing == nil {
+			continue
+		}
+		path := at + "." + key
+
+		existingObj, existingIsObj := existing.(map[string]interface{})
+		if valueObj, ok := value.(map[string]interface{}); ok && existingIsObj {
+			errs = append(errs, validateConfigShape(existingObj, valueObj, path)...)
+			continue
+		}
+
+		expected := jsonValueType(existing)
+		if actual := jsonValueType(value); actual != expected {
+			errs = append(errs, fmt.Sprintf("%s 应为 %s 类型", path, expected))
+		}
+	}
+	return errs
+}
+
+// jsonValueType 返回JSON值的类型名称
+func jsonValueType(value interface{}) string {
+	for _, typ := range []string{"object", "array", "string", "boolean", "number", "null"} {
+		if jsonTypeMatches(value, typ) {
+			return typ
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"terraria-api/app/model"
+	"terraria-api/utils"
+	"testing"
+)
+
+func TestModConfigScopeOverride(t *testing.T) {
+	setupTestEnv(t)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	room := &model.Room{Name: "mods", Type: model.ServerTypeTModLoader, Port: 7777, WorldName: "World"}
+	if err := utils.DB.Create(room).Error; err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(getRoomModsDir(room.ID), "enabled.json"):                   `["CalamityMod"]`,
+		filepath.Join(getRoomModConfigsDir(room.ID), "CalamityMod_Balance.json"): `{"Value": 1}`,
+	}
+	for path, content := range files {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := NewModConfigService()
+	listed, err := service.ListConfigFiles(room.ID)
+	if err != nil || len(listed) != 1 || listed[0].Scope != ModConfigScopeUnknown || listed[0].ScopeOverridden {
+		t.Fatalf("类名无法推断时应为 unknown: %+v, %v", listed, err)
+	}
+
+	file, err := service.SetConfigScope(room.ID, "CalamityMod_Balance.json", ModConfigScopeServer)
+	if err != nil || file.Scope != ModConfigScopeServer || !file.ScopeOverridden {
+		t.Fatalf("手动设置作用域: %+v, %v", file, err)
+	}
+	if history, _ := service.GetHistory(room.ID, file.Path); len(history) != 0 {
+		t.Errorf("设置作用域不应出现在配置内容的历史中: %+v", history)
+	}
+
+	file, err = service.SetConfigScope(room.ID, file.Path, "")
+	if err != nil || file.Scope != ModConfigScopeUnknown || file.ScopeOverridden {
+		t.Errorf("清除后应恢复推断的作用域: %+v, %v", file, err)
+	}
+	if _, err := service.SetConfigScope(room.ID, file.Path, "world"); err == nil {
+		t.Error("无效的作用域应返回错误")
+	}
+}
@@ -1,5 +1,10 @@
 package service
 
+import (
+	"strconv"
+	"terraria-api/app/model"
+)
+
 // ModService Mod市场服务
 type ModService struct{}
 
@@ -8,30 +13,31 @@ func NewModService() *ModService {
 	return &ModService{}
 }
 
-// SearchWorkshopMods 搜索Workshop模组
-func (s *ModService) SearchWorkshopMods(query string, page string) ([]map[string]interface{}, error) {
-	// TODO: 实现Steam Workshop API调用
-	// 这里返回模拟数据
-	return []map[string]interface{}{
-		{
-			"id":          "2563784257",
-			"name":        "Calamity Mod",
-			"author":      "Fabsol",
-			"description": "灾厄模组，添加大量新内容",
-			"downloads":   5000000,
-			"rating":      4.9,
-			"thumbnail":   "https://example.com/calamity.jpg",
-		},
-		{
-			"id":          "2563784258",
-			"name":        "Thorium Mod",
-			"author":      "DivermanSam",
-			"description": "钍模组，添加新职业和BOSS",
-			"downloads":   3000000,
-			"rating":      4.8,
-			"thumbnail":   "https://example.com/thorium.jpg",
-		},
-	}, nil
+// WorkshopSearchResult 创意工坊搜索结果
+type WorkshopSearchResult struct {
+	Items []model.WorkshopItem `json:"items"`
+	Total int64                `json:"total"`
+	Page  int                  `json:"page"`
+}
+
+// SearchWorkshopMods 搜索已下载到本地的Workshop模组
+func (s *ModService) SearchWorkshopMods(query string, page string) (*WorkshopSearchResult, error) {
+	pageNum, err := strconv.Atoi(page)
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	items, total, err := NewWorkshopService().SearchItems(query, pageNum, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WorkshopSearchResult{Items: items, Total: total, Page: pageNum}, nil
+}
+
+// DownloadWorkshopMod 通过steamcmd下载Workshop模组到本地缓存
+func (s *ModService) DownloadWorkshopMod(workshopId string) (*model.WorkshopItem, error) {
+	return NewWorkshopService().Download(workshopId)
 }
 
 // GetPopularMods 获取热门模组
@@ -81,75 +87,64 @@ func (s *ModService) GetPopularMods(limit string) []map[string]interface{} {
 	}
 }
 
+// TShockPluginItem 插件库列表项
+type TShockPluginItem struct {
+	ID           string                     `json:"id"`
+	Name         string                     `json:"name"`
+	Description  string                     `json:"description"`
+	Author       string                     `json:"author"`
+	Category     string                     `json:"category"`
+	Homepage     string                     `json:"homepage"`
+	Version      string                     `json:"version"`  // 最新的兼容版本
+	Versions     []string                   `json:"versions"` // 所有兼容版本（从新到旧）
+	DownloadURL  string                     `json:"downloadUrl"`
+	SHA256       string                     `json:"sha256"`
+	Dependencies []RegistryPluginDependency `json:"dependencies"`
+}
+
 // GetTShockPlugins 获取TShock插件库
-func (s *ModService) GetTShockPlugins(category string) []map[string]interface{} {
-	plugins := []map[string]interface{}{
-		{
-			"id":          "ssc",
-			"name":        "ServerSideCharacter (SSC)",
-			"description": "服务器端人物存档，防止物品作弊",
-			"version":     "1.2.0",
-			"author":      "TShock Team",
-			"category":    "essential",
-			"downloads":   100000,
-		},
-		{
-			"id":          "economics",
-			"name":        "Economics",
-			"description": "经济系统插件，支持货币、商店等功能",
-			"version":     "1.5.2",
-			"author":      "MistZZT",
-			"category":    "gameplay",
-			"downloads":   50000,
-		},
-		{
-			"id":          "regions",
-			"name":        "Regions",
-			"description": "区域保护插件，可设置保护区域和权限",
-			"version":     "2.0.1",
-			"author":      "TShock Team",
-			"category":    "protection",
-			"downloads":   80000,
-		},
-		{
-			"id":          "time-rate",
-			"name":        "TimeRate",
-			"description": "时间倍率插件，可加快或减慢游戏时间",
-			"version":     "1.1.0",
-			"author":      "Simon311",
-			"category":    "utility",
-			"downloads":   30000,
-		},
-		{
-			"id":          "warps",
-			"name":        "Warps",
-			"description": "传送点插件，可设置多个传送点",
-			"version":     "1.3.0",
-			"author":      "Enerdy",
-			"category":    "utility",
-			"downloads":   40000,
-		},
-		{
-			"id":          "chestcontrol",
-			"name":        "ChestControl",
-			"description": "箱子控制插件，可设置箱子权限和重生时间",
-			"version":     "1.2.1",
-			"author":      "Olink",
-			"category":    "protection",
-			"downloads":   25000,
-		},
+// tshockVersion 不为空时只返回兼容该TShock版本的插件
+func (s *ModService) GetTShockPlugins(category string, tshockVersion string) ([]TShockPluginItem, error) {
+	registry, err := NewPluginRegistryService().GetRegistry()
+	if err != nil {
+		return nil, err
 	}
 
-	// 如果指定了分类，进行过滤
-	if category != "" {
-		filtered := []map[string]interface{}{}
-		for _, plugin := range plugins {
-			if plugin["category"] == category {
-				filtered = append(filtered, plugin)
-			}
+	plugins := []TShockPluginItem{}
+	for _, plugin := range registry.Plugins {
+		// 如果指定了分类，进行过滤
+		if category != "" && plugin.Category != category {
+			continue
+		}
+
+		compatible := plugin.CompatibleVersions(tshockVersion)
+		if len(compatible) == 0 {
+			continue
 		}
-		return filtered
+
+		latest := compatible[0]
+		item := TShockPluginItem{
+			ID:           plugin.ID,
+			Name:         plugin.Name,
+			Description:  plugin.Description,
+			Author:       plugin.Author,
+			Category:     plugin.Category,
+			Homepage:     plugin.Homepage,
+			Version:      latest.Version,
+			DownloadURL:  latest.DownloadURL,
+			SHA256:       latest.SHA256,
+			Dependencies: latest.Dependencies,
+		}
+		for _, v := range compatible {
+			item.Versions = append(item.Versions, v.Version)
+		}
+		plugins = append(plugins, item)
 	}
 
-	return plugins
+	return plugins, nil
+}
+
+// RefreshTShockPlugins 立即刷新插件注册表
+func (s *ModService) RefreshTShockPlugins() error {
+	return NewPluginRegistryService().Refresh()
 }
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// ModUpdateService Mod更新检测与更新服务
+type ModUpdateService struct{}
+
+var modUpdateStartOnce sync.Once
+
+// NewModUpdateService 创建Mod更新服务
+func NewModUpdateService() *ModUpdateService {
+	return &ModUpdateService{}
+}
+
+// StartAutoCheck 启动定时检查Mod更新
+func (s *ModUpdateService) StartAutoCheck() {
+	modUpdateStartOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(config.GlobalConfig.ModUpdateInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				s.CheckAll()
+			}
+		}()
+	})
+}
+
+// CheckAll 检查所有房间的Mod更新
+func (s *ModUpdateService) CheckAll() {
+	var roomIds []uint
+	utils.DB.Model(&model.InstalledMod{}).
+		Where("source IN ?", []string{model.ModSourceWorkshop, model.ModSourceURL}).
+		Distinct().Pluck("room_id", &roomIds)
+
+	// 同一个来源在一次检查中只拉取一次
+	fetched := make(map[string]string)
+	for _, roomId := range roomIds {
+		if _, err := s.checkRoom(roomId, fetched); err != nil {
+			log.Printf("⚠️ 检查房间 %d 的Mod更新失败: %v", roomId, err)
+		}
+	}
+	log.Printf("✅ Mod更新检查完成，共 %d 个房间", len(roomIds))
+}
+
+// CheckRoom 立即检查房间的Mod更新
+func (s *ModUpdateService) CheckRoom(roomId uint) ([]model.InstalledMod, error) {
+	return s.checkRoom(roomId, make(map[string]string))
+}
+
+// GetRoomUpdates 获取房间已安装Mod的来源与更新状态
+func (s *ModUpdateService) GetRoomUpdates(roomId uint) ([]model.InstalledMod, error) {
+	if _, err := NewRoomModService().getTModLoaderRoom(roomId); err != nil {
+		return nil, err
+	}
+
+	records := []model.InstalledMod{}
+	err := utils.DB.Where("room_id = ?", roomId).Order("name").Find(&records).Error
+	return records, err
+}
+
+// UpdateMod 将Mod更新到来源中的最新版本
+// 旧 .tmod 会备份到 ModBackups 目录以便回滚；房间运行中时需要 restart 才会执行（停止→更新→启动）
+func (s *ModUpdateService) UpdateMod(roomId uint, name string, restart bool) (*model.InstalledMod, error) {
+	room, record, err := s.prepareChange(roomId, name, restart)
+	if err != nil {
+		return nil, err
+	}
+	if !record.UpdateAvailable {
+		return nil, errors.New("没有可用的更新")
+	}
+
+	source, err := s.fetchLatest(room, record, make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+
+	// 暂存并校验新文件
+	modsDir := getRoomModsDir(roomId)
+	staged, err := os.CreateTemp(modsDir, ".update-*.tmod")
+	if err != nil {
+		return nil, err
+	}
+	staged.Close()
+	defer os.Remove(staged.Name())
+	if err := copyFile(source, staged.Name()); err != nil {
+		return nil, err
+	}
+	tmod, _, err := NewRoomModService().validateModFile(staged.Name(), room)
+	if err != nil {
+		return nil, err
+	}
+	if tmod.Name != record.Name {
+		return nil, fmt.Errorf("来源中的Mod名称 %s 与已安装的 %s 不一致", tmod.Name, record.Name)
+	}
+	sum, _, err := fileSHA256(staged.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	wasRunning, err := s.stopIfRunning(room)
+	if err != nil {
+		return nil, err
+	}
+
+	backupPath, err := s.swapModFile(roomId, record.Name, record.Version, staged.Name())
+	if err != nil {
+		s.startIfWasRunning(roomId, wasRunning)
+		return nil, err
+	}
+
+	record.PreviousVersion = record.Version
+	record.BackupPath = backupPath
+	record.Version = tmod.Version
+	record.SHA256 = sum
+	record.UpdateAvailable = utils.CompareVersions(record.LatestVersion, record.Version) > 0
+	if err := utils.DB.Save(record).Error; err != nil {
+		return nil, err
+	}
+
+	s.startIfWasRunning(roomId, wasRunning)
+	return record, nil
+}
+
+// RollbackMod 回滚到更新前备份的版本（可再次回滚以撤销）
+func (s *ModUpdateService) RollbackMod(roomId uint, name string, restart bool) (*model.InstalledMod, error) {
+	room, record, err := s.prepareChange(roomId, name, restart)
+	if err != nil {
+		return nil, err
+	}
+	if record.BackupPath == "" {
+		return nil, errors.New("没有可回滚的备份")
+	}
+	if _, err := os.Stat(record.BackupPath); err != nil {
+		return nil, errors.New("备份文件已丢失")
+	}
+
+	sum, _, err := fileSHA256(record.BackupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	wasRunning, err := s.stopIfRunning(room)
+	if err != nil {
+		return nil, err
+	}
+
+	oldBackup := record.BackupPath
+	backupPath, err := s.swapModFile(roomId, record.Name, record.Version, oldBackup)
+	if err != nil {
+		s.startIfWasRunning(roomId, wasRunning)
+		return nil, err
+	}
+
+	record.Version, record.PreviousVersion = record.PreviousVersion, record.Version
+	record.BackupPath = backupPath
+	record.SHA256 = sum
+	record.UpdateAvailable = utils.CompareVersions(record.LatestVersion, record.Version) > 0
+	if err := utils.DB.Save(record).Error; err != nil {
+		return nil, err
+	}
+
+	s.startIfWasRunning(roomId, wasRunning)
+	return record, nil
+}
+
+// checkRoom 检查房间中来源可追踪的Mod
+func (s *ModUpdateService) checkRoom(roomId uint, fetched map[string]string) ([]model.InstalledMod, error) {
+	room, err := NewRoomModService().getTModLoaderRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []model.InstalledMod
+	if err := utils.DB.Where("room_id = ?", roomId).Order("name").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		record := &records[i]
+		if record.Source != model.ModSourceWorkshop && record.Source != model.ModSourceURL {
+			continue
+		}
+
+		now := time.Now()
+		record.CheckedAt = &now
+		record.CheckError = ""
+		path, err := s.fetchLatest(room, record, fetched)
+		if err == nil {
+			var tmod *utils.TmodFile
+			if tmod, err = utils.ReadTmodFile(path, false); err == nil {
+				record.LatestVersion = tmod.Version
+				record.UpdateAvailable = utils.CompareVersions(tmod.Version, record.Version) > 0
+			}
+		}
+		if err != nil {
+			record.CheckError = err.Error()
+		}
+		utils.DB.Save(record)
+	}
+
+	return records, nil
+}
+
+// fetchLatest 从来源获取最新的 .tmod，返回本地路径
+// fetched 记录本轮已拉取过的来源，避免重复下载
+func (s *ModUpdateService) fetchLatest(room *model.Room, record *model.InstalledMod, fetched map[string]string) (string, error) {
+	key := record.Source + ":" + record.SourceRef
+	switch record.Source {
+	case model.ModSourceWorkshop:
+		workshop := NewWorkshopService()
+		var item *model.WorkshopItem
+		var err error
+		if _, ok := fetched[key]; ok {
+			item, err = workshop.GetItem(record.SourceRef)
+		} else {
+			item, err = workshop.Download(record.SourceRef)
+			fetched[key] = record.SourceRef
+		}
+		if err != nil {
+			return "", err
+		}
+		path, _, err := workshop.SelectBuild(item, room.Version)
+		return path, err
+
+	case model.ModSourceURL:
+		if path, ok := fetched[key]; ok {
+			return path, nil
+		}
+		dir := filepath.Join(config.GlobalConfig.DataPath, "mod-updates")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		hash := sha1.Sum([]byte(record.SourceRef))
+		path := filepath.Join(dir, hex.EncodeToString(hash[:])+".tmod")
+		if err := downloadPluginFile(record.SourceRef, path+".download", ""); err != nil {
+			os.Remove(path + ".download")
+			return "", err
+		}
+		if err := os.Rename(path+".download", path); err != nil {
+			return "", err
+		}
+		fetched[key] = path
+		return path, nil
+	}
+
+	return "", errors.New("该Mod的来源不支持检查更新")
+}
+
+// prepareChange 获取房间与Mod记录，并检查运行状态
+func (s *ModUpdateService) prepareChange(roomId uint, name string, restart bool) (*model.Room, *model.InstalledMod, error) {
+	room, err := NewRoomModService().getTModLoaderRoom(roomId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if room.Status == model.StatusStarting || room.Status == model.StatusStopping {
+		return nil, nil, errors.New("服务器正在启动或停止，请稍后再试")
+	}
+	if room.Status == model.StatusRunning && !restart {
+		return nil, nil, errors.New("服务器正在运行，请先停止服务器或设置 restart=true 在更新时重启")
+	}
+
+	var record model.InstalledMod
+	if err := utils.DB.Where("room_id = ? AND name = ?", roomId, name).First(&record).Error; err != nil {
+		return nil, nil, errors.New("未找到该Mod的安装记录")
+	}
+	return room, &record, nil
+}
+
+// swapModFile 备份当前 .tmod 并替换为新文件，返回备份路径
+func (s *ModUpdateService) swapModFile(roomId uint, name, currentVersion, newFile string) (string, error) {
+	backupDir := filepath.Join(getRoomDir(roomId), "ModBackups")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(getRoomModsDir(roomId), name+".tmod")
+	backupPath := filepath.Join(backupDir, fmt.Sprintf("%s-%s-%s.tmod", name, currentVersion, time.Now().Format("20060102150405")))
+	if err := os.Rename(dest, backupPath); err != nil {
+		return "", fmt.Errorf("备份旧版本失败: %w", err)
+	}
+	if err := os.Rename(newFile, dest); err != nil {
+		os.Rename(backupPath, dest)
+		return "", fmt.Errorf("替换Mod文件失败: %w", err)
+	}
+	return backupPath, nil
+}
+
+// stopIfRunning 房间运行中时先保存世界再停止，等进程退出后返回原先是否在运行
+func (s *ModUpdateService) stopIfRunning(room *model.Room) (bool, error) {
+	if room.Status != model.StatusRunning {
+		return false, nil
+	}
+	if _, err := saveRunningWorld(room, backupSaveTimeout); err != nil {
+		log.Printf("⚠️ 房间 %d 停止前保存世界失败，将丢失上次自动保存后的进度: %v", room.ID, err)
+	}
+	if err := NewRoomService().StopServer(room.ID); err != nil {
+		return false, fmt.Errorf("停止服务器失败: %w", err)
+	}
+	waitProcessExit(room.ID, restoreStopTimeout)
+	return true, nil
+}
+
+// startIfWasRunning 恢复房间的运行状态
+func (s *ModUpdateService) startIfWasRunning(roomId uint, wasRunning bool) {
+	if !wasRunning {
+		return
+	}
+	if err := NewRoomService().StartServer(roomId); err != nil {
+		log.Printf("❌ 房间 %d 更新Mod后重启失败: %v", roomId, err)
+	}
+}
@@ -0,0 +1,705 @@
+package service
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// ModPackService 模组包服务
+type ModPackService struct{}
+
+// NewModPackService 创建模组包服务
+func NewModPackService() *ModPackService {
+	return &ModPackService{}
+}
+
+// ModPackManifest 模组包清单（归档中的 modpack.json）
+type ModPackManifest struct {
+	Name              string       `json:"name"`
+	Version           string       `json:"version"`
+	Description       string       `json:"description"`
+	TModLoaderVersion string       `json:"tModLoaderVersion"`
+	Mods              []ModPackMod `json:"mods"`
+	ConfigFiles       []string     `json:"configFiles"` // 相对 ModConfigs 目录的路径
+	CreatedAt         time.Time    `json:"createdAt"`
+}
+
+// ModPackMod 模组包中的Mod
+type ModPackMod struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+	Size    int64  `json:"size"`
+}
+
+// BuildModPackRequest 从房间构建模组包
+type BuildModPackRequest struct {
+	RoomID         uint   `json:"roomId" binding:"required"`
+	Name           string `json:"name" binding:"required"`
+	Version        string `json:"version" binding:"required"`
+	Description    string `json:"description"`
+	IncludeConfigs bool   `json:"includeConfigs"`
+}
+
+// ModPackApplyResult 应用模组包的结果
+type ModPackApplyResult struct {
+	RoomID   uint     `json:"roomId"`
+	Warnings []string `json:"warnings"`
+}
+
+// 归档内的固定路径
+const (
+	modPackManifestName = "modpack.json"
+	modPackModsDir      = "mods/"
+	modPackConfigsDir   = "configs/"
+)
+
+// GetModPacks 获取所有模组包
+func (s *ModPackService) GetModPacks() ([]model.ModPack, error) {
+	var packs []model.ModPack
+	err := utils.DB.Order("name, created_at desc").Find(&packs).Error
+	return packs, err
+}
+
+// GetModPack 根据ID获取模组包
+func (s *ModPackService) GetModPack(id uint) (*model.ModPack, error) {
+	var pack model.ModPack
+	if err := utils.DB.First(&pack, id).Error; err != nil {
+		return nil, errors.New("模组包不存在")
+	}
+	return &pack, nil
+}
+
+// BuildFromRoom 将房间当前启用的Mod（及可选的ModConfigs）打包为模组包
+func (s *ModPackService) BuildFromRoom(req BuildModPackRequest) (*model.ModPack, error) {
+	room, err := NewRoomModService().getTModLoaderRoom(req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(req.Name, req.Version); err != nil {
+		return nil, err
+	}
+
+	modsDir := getRoomModsDir(room.ID)
+	enabled, err := readEnabledMods(modsDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(enabled) == 0 {
+		return nil, errors.New("房间没有启用的Mod")
+	}
+
+	manifest := ModPackManifest{
+		Name:              req.Name,
+		Version:           req.Version,
+		Description:       req.Description,
+		TModLoaderVersion: room.Version,
+		Mods:              []ModPackMod{},
+		ConfigFiles:       []string{},
+		CreatedAt:         time.Now(),
+	}
+
+	archivePath, err := s.reserveArchivePath(req.Name, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			os.Remove(archivePath)
+		}
+	}()
+	tmp := archivePath + ".building"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	zw := zip.NewWriter(out)
+	for _, name := range enabled {
+		modPath := filepath.Join(modsDir, name+".tmod")
+		tmod, err := utils.ReadTmodFile(modPath, false)
+		if err != nil {
+			zw.Close()
+			out.Close()
+			return nil, fmt.Errorf("读取Mod %s 失败: %w", name, err)
+		}
+		sum, size, err := addFileToZip(zw, modPath, modPackModsDir+name+".tmod")
+		if err != nil {
+			zw.Close()
+			out.Close()
+			return nil, err
+		}
+		manifest.Mods = append(manifest.Mods, ModPackMod{Name: name, Version: tmod.Version, SHA256: sum, Size: size})
+	}
+
+	if req.IncludeConfigs {
+		configDir := filepath.Join(getRoomDir(room.ID), "ModConfigs")
+		err := filepath.WalkDir(configDir, func(p string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(configDir, p)
+			rel = filepath.ToSlash(rel)
+			if _, _, err := addFileToZip(zw, p, modPackConfigsDir+rel); err != nil {
+				return err
+			}
+			manifest.ConfigFiles = append(manifest.ConfigFiles, rel)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			zw.Close()
+			out.Close()
+			return nil, err
+		}
+	}
+
+	manifestContent, _ := json.MarshalIndent(manifest, "", "  ")
+	w, err := zw.Create(modPackManifestName)
+	if err == nil {
+		_, err = w.Write(manifestContent)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	out.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, archivePath); err != nil {
+		return nil, err
+	}
+	pack, err := s.saveModPack(&manifest, manifestContent, archivePath, "")
+	saved = err == nil
+	return pack, err
+}
+
+// ImportFromUpload 从上传的归档导入模组包
+func (s *ModPackService) ImportFromUpload(fileHeader *multipart.FileHeader) (*model.ModPack, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return s.importArchive(src, "")
+}
+
+// ImportFromURL 从URL下载并导入模组包
+func (s *ModPackService) ImportFromURL(url string) (*model.ModPack, error) {
+	client := &http.Client{Timeout: 30 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+	}
+
+	return s.importArchive(resp.Body, url)
+}
+
+// ApplyToRooms 将模组包应用到多个房间
+// 所有房间先完成暂存和校验，再统一替换 Mods/ModConfigs 目录；任一房间失败时全部回滚
+func (s *ModPackService) ApplyToRooms(id uint, roomIds []uint) ([]ModPackApplyResult, error) {
+	pack, err := s.GetModPack(id)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ModPackManifest
+	if err := json.Unmarshal([]byte(pack.Manifest), &manifest); err != nil {
+		return nil, errors.New("模组包清单格式错误")
+	}
+
+	zr, err := zip.OpenReader(pack.ArchivePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开模组包失败: %w", err)
+	}
+	defer zr.Close()
+
+	stamp := time.Now().Format("20060102150405")
+	type roomSwap struct {
+		roomId  uint
+		dirs    []string // 要替换的目录
+		swapped []string // 已替换的目录
+	}
+	var swaps []*roomSwap
+	results := []ModPackApplyResult{}
+
+	cleanup := func() {
+		for _, swap := range swaps {
+			for _, dir := range swap.dirs {
+				os.RemoveAll(dir + ".staging-" + stamp)
+			}
+		}
+	}
+
+	// 第一阶段：为每个房间暂存新的目录并校验
+	for _, roomId := range roomIds {
+		room, err := NewRoomModService().getTModLoaderRoom(roomId)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("房间 %d: %w", roomId, err)
+		}
+		if room.Status == model.StatusRunning || room.Status == model.StatusStarting {
+			cleanup()
+			return nil, fmt.Errorf("房间 %d 正在运行，请先停止服务器", roomId)
+		}
+
+		modsDir := getRoomModsDir(roomId)
+		configDir := filepath.Join(getRoomDir(roomId), "ModConfigs")
+		swap := &roomSwap{roomId: roomId, dirs: []string{modsDir}}
+		if len(manifest.ConfigFiles) > 0 {
+			swap.dirs = append(swap.dirs, configDir)
+		}
+		swaps = append(swaps, swap)
+
+		warnings, err := s.stageRoom(&zr.Reader, &manifest, room, modsDir+".staging-"+stamp, configDir+".staging-"+stamp)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("房间 %d: %w", roomId, err)
+		}
+		results = append(results, ModPackApplyResult{RoomID: roomId, Warnings: warnings})
+	}
+
+	// 第二阶段：替换目录，失败时回滚已替换的房间
+	rollback := func() {
+		for _, swap := range swaps {
+			for _, dir := range swap.swapped {
+				os.RemoveAll(dir)
+				os.Rename(dir+".old-"+stamp, dir)
+			}
+		}
+	}
+	for _, swap := range swaps {
+		for _, dir := range swap.dirs {
+			if err := os.Rename(dir, dir+".old-"+stamp); err != nil && !os.IsNotExist(err) {
+				rollback()
+				cleanup()
+				return nil, fmt.Errorf("房间 %d: 替换目录失败: %w", swap.roomId, err)
+			}
+			if err := os.Rename(dir+".staging-"+stamp, dir); err != nil {
+				os.Rename(dir+".old-"+stamp, dir)
+				rollback()
+				cleanup()
+				return nil, fmt.Errorf("房间 %d: 替换目录失败: %w", swap.roomId, err)
+			}
+			swap.swapped = append(swap.swapped, dir)
+		}
+	}
+
+	// 全部成功后清理旧目录并更新数据库
+	downloadURL := fmt.Sprintf("/api/terraria/modpacks/%d/download", pack.ID)
+	enabled := make([]string, 0, len(manifest.Mods))
+	for _, mod := range manifest.Mods {
+		enabled = append(enabled, mod.Name)
+	}
+	enabledContent, _ := json.Marshal(enabled)
+	for _, swap := range swaps {
+		for _, dir := range swap.swapped {
+			os.RemoveAll(dir + ".old-" + stamp)
+		}
+
+		var cfg model.TModLoaderConfig
+		if err := utils.DB.Where("room_id = ?", swap.roomId).First(&cfg).Error; err != nil {
+			cfg = model.TModLoaderConfig{RoomID: swap.roomId}
+		}
+		cfg.EnabledMods = string(enabledContent)
+		cfg.ModPackURL = downloadURL
+		cfg.ModPackID = pack.ID
+		if err := utils.DB.Save(&cfg).Error; err != nil {
+			log.Printf("⚠️ 更新房间 %d 的模组包记录失败: %v", swap.roomId, err)
+		}
+
+		// 房间的Mod全部来自模组包
+		utils.DB.Where("room_id = ?", swap.roomId).Delete(&model.InstalledMod{})
+		for _, mod := range manifest.Mods {
+			if err := recordInstalledMod(swap.roomId, mod.Name, mod.Version, mod.SHA256, model.ModSourceModPack, fmt.Sprint(pack.ID)); err != nil {
+				log.Printf("⚠️ 记录房间 %d 的Mod %s 失败: %v", swap.roomId, mod.Name, err)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// DeleteModPack 删除模组包
+func (s *ModPackService) DeleteModPack(id uint) error {
+	pack, err := s.GetModPack(id)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	utils.DB.Model(&model.TModLoaderConfig{}).Where("mod_pack_id = ?", id).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("有 %d 个房间正在使用该模组包", count)
+	}
+
+	if err := os.Remove(pack.ArchivePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return utils.DB.Delete(pack).Error
+}
+
+// stageRoom 在暂存目录中生成房间应用模组包后的 Mods 和 ModConfigs
+// 房间中已有的非 .tmod 文件会保留
+func (s *ModPackService) stageRoom(zr *zip.Reader, manifest *ModPackManifest, room *model.Room, modsStaging, configStaging string) ([]string, error) {
+	modsDir := getRoomModsDir(room.ID)
+	if err := copyDirFiltered(modsDir, modsStaging, func(rel string) bool {
+		return !strings.EqualFold(filepath.Ext(rel), ".tmod") && rel != "enabled.json"
+	}); err != nil {
+		return nil, err
+	}
+
+	warnings := []string{}
+	enabled := []string{}
+	for _, mod := range manifest.Mods {
+		dest := filepath.Join(modsStaging, mod.Name+".tmod")
+		if err := extractZipEntry(zr, modPackModsDir+mod.Name+".tmod", dest, mod.SHA256); err != nil {
+			return nil, fmt.Errorf("Mod %s: %w", mod.Name, err)
+		}
+		tmod, err := utils.ReadTmodFile(dest, false)
+		if err != nil {
+			return nil, fmt.Errorf("Mod %s: %w", mod.Name, err)
+		}
+		modWarnings, err := checkTModLoaderCompatibility(tmod, room.Version)
+		if err != nil {
+			return nil, fmt.Errorf("Mod %s: %w", mod.Name, err)
+		}
+		for _, w := range modWarnings {
+			warnings = append(warnings, mod.Name+": "+w)
+		}
+		enabled = append(enabled, mod.Name)
+	}
+	if err := writeEnabledMods(modsStaging, enabled); err != nil {
+		return nil, err
+	}
+
+	if len(manifest.ConfigFiles) > 0 {
+		configDir := filepath.Join(getRoomDir(room.ID), "ModConfigs")
+		if err := copyDirFiltered(configDir, configStaging, nil); err != nil {
+			return nil, err
+		}
+		for _, rel := range manifest.ConfigFiles {
+			if err := extractZipEntry(zr, modPackConfigsDir+rel, filepath.Join(configStaging, filepath.FromSlash(rel)), ""); err != nil {
+				return nil, fmt.Errorf("配置文件 %s: %w", rel, err)
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// importArchive 校验归档内容并保存为模组包
+func (s *ModPackService) importArchive(src io.Reader, sourceURL string) (*model.ModPack, error) {
+	dir := filepath.Join(config.GlobalConfig.DataPath, "modpacks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, ".import-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+
+	manifest, manifestContent, err := s.verifyArchive(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(manifest.Name, manifest.Version); err != nil {
+		return nil, err
+	}
+
+	archivePath, err := s.reserveArchivePath(manifest.Name, manifest.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), archivePath); err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+	return s.saveModPack(manifest, manifestContent, archivePath, sourceURL)
+}
+
+// verifyArchive 读取清单并校验归档中的每个Mod
+func (s *ModPackService) verifyArchive(archivePath string) (*ModPackManifest, []byte, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, nil, errors.New("不是有效的模组包归档")
+	}
+	defer zr.Close()
+
+	var manifestContent []byte
+	for _, f := range zr.File {
+		if !utils.IsSafeArchivePath(f.Name) {
+			return nil, nil, fmt.Errorf("模组包包含非法路径: %s", f.Name)
+		}
+		if f.Name == modPackManifestName {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, nil, err
+			}
+			manifestContent, err = io.ReadAll(io.LimitReader(rc, 1<<20))
+			rc.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if manifestContent == nil {
+		return nil, nil, errors.New("模组包缺少 modpack.json")
+	}
+
+	var manifest ModPackManifest
+	if err := json.Unmarshal(manifestContent, &manifest); err != nil {
+		return nil, nil, errors.New("modpack.json 格式错误")
+	}
+	if manifest.Name == "" || manifest.Version == "" || len(manifest.Mods) == 0 {
+		return nil, nil, errors.New("modpack.json 缺少名称、版本或Mod列表")
+	}
+
+	for _, mod := range manifest.Mods {
+		if mod.Name == "" || mod.SHA256 == "" || !utils.IsSafeArchivePath(mod.Name) || strings.Contains(mod.Name, "/") {
+			return nil, nil, fmt.Errorf("modpack.json 中的Mod %q 缺少名称或哈希", mod.Name)
+		}
+		if err := extractZipEntry(&zr.Reader, modPackModsDir+mod.Name+".tmod", "", mod.SHA256); err != nil {
+			return nil, nil, fmt.Errorf("Mod %s: %w", mod.Name, err)
+		}
+	}
+	for _, rel := range manifest.ConfigFiles {
+		if !utils.IsSafeArchivePath(rel) {
+			return nil, nil, fmt.Errorf("配置文件路径非法: %s", rel)
+		}
+	}
+
+	return &manifest, manifestContent, nil
+}
+
+// saveModPack 写入模组包记录
+func (s *ModPackService) saveModPack(manifest *ModPackManifest, manifestContent []byte, archivePath, sourceURL string) (*model.ModPack, error) {
+	sum, size, err := fileSHA256(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	pack := &model.ModPack{
+		Name:              manifest.Name,
+		Version:           manifest.Version,
+		Description:       manifest.Description,
+		TModLoaderVersion: manifest.TModLoaderVersion,
+		Manifest:          string(manifestContent),
+		ArchivePath:       archivePath,
+		SHA256:            sum,
+		Size:              size,
+		SourceURL:         sourceURL,
+	}
+	if err := utils.DB.Create(pack).Error; err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+	return pack, nil
+}
+
+// checkUnique 检查名称+版本是否已存在
+func (s *ModPackService) checkUnique(name, version string) error {
+	var count int64
+	utils.DB.Model(&model.ModPack{}).Where("name = ? AND version = ?", name, version).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("模组包 %s %s 已存在", name, version)
+	}
+	return nil
+}
+
+// reserveArchivePath 为模组包分配归档路径并创建占位文件
+// 不同的名称和版本替换字符后可能得到相同的文件名（如 a-b + c 与 a + b-c），
+// 已被其他模组包使用或已存在的路径加序号，不会覆盖其他模组包的归档
+func (s *ModPackService) reserveArchivePath(name, version string) (string, error) {
+	dir := filepath.Join(config.GlobalConfig.DataPath, "modpacks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	safe := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, name+"-"+version)
+
+	for i := 1; ; i++ {
+		archivePath := filepath.Join(dir, safe+".zip")
+		if i > 1 {
+			archivePath = filepath.Join(dir, fmt.Sprintf("%s.%d.zip", safe, i))
+		}
+		var used int64
+		utils.DB.Model(&model.ModPack{}).Where("archive_path = ?", archivePath).Count(&used)
+		if used > 0 {
+			continue
+		}
+		f, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return archivePath, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
+// extractZipEntry 解压归档中的单个文件并校验 SHA-256；dest 为空时只校验
+func extractZipEntry(zr *zip.Reader, name, dest, expectedSHA256 string) error {
+	var entry *zip.File
+	for _, f := range zr.File {
+		if f.Name == name {
+			entry = f
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("归档中缺少 %s", name)
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var w io.Writer = io.Discard
+	if dest != "" {
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		w = out
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), rc); err != nil {
+		return err
+	}
+	if expectedSHA256 != "" {
+		if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, expectedSHA256) {
+			return fmt.Errorf("SHA-256校验失败: 期望 %s，实际 %s", expectedSHA256, actual)
+		}
+	}
+	return nil
+}
+
+// addFileToZip 将文件写入归档，返回其 SHA-256 和大小
+func addFileToZip(zw *zip.Writer, src, name string) (string, int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", 0, err
+	}
+	defer in.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return "", 0, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), in)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// fileSHA256 计算文件的 SHA-256 和大小
+func fileSHA256(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// copyDirFiltered 复制目录中满足条件的文件，源目录不存在时只创建目标目录
+func copyDirFiltered(src, dst string, keep func(rel string) bool) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	err := filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		if keep != nil && !keep(filepath.ToSlash(rel)) {
+			return nil
+		}
+		return copyFile(p, filepath.Join(dst, rel))
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// copyFile 复制单个文件并保留权限
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
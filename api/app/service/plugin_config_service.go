@@ -0,0 +1,464 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/utils"
+	"time"
+)
+
+// PluginConfigService 插件配置文件服务
+type PluginConfigService struct {
+	registry *PluginRegistryService
+}
+
+// NewPluginConfigService 创建插件配置服务
+func NewPluginConfigService() *PluginConfigService {
+	return &PluginConfigService{
+		registry: NewPluginRegistryService(),
+	}
+}
+
+// PluginConfigFile 插件配置文件信息
+type PluginConfigFile struct {
+	PluginID  string    `json:"pluginId"`
+	Path      string    `json:"path"` // 相对 tshock 目录的路径
+	Exists    bool      `json:"exists"`
+	Size      int64     `json:"size"`
+	Modified  time.Time `json:"modified"`
+	HasSchema bool      `json:"hasSchema"`
+
+	schema        json.RawMessage
+	reloadCommand string
+}
+
+// PluginConfigContent 插件配置文件内容
+type PluginConfigContent struct {
+	PluginConfigFile
+	Content map[string]interface{} `json:"content"`
+	Schema  json.RawMessage        `json:"schema"`
+}
+
+// PluginConfigSaveResult 保存结果
+type PluginConfigSaveResult struct {
+	Path         string   `json:"path"`
+	Reloaded     bool     `json:"reloaded"`
+	ReloadOutput []string `json:"reloadOutput"`
+	ReloadError  string   `json:"reloadError"`
+}
+
+// TShock自身的配置文件，不归属于任何插件
+var tshockOwnConfigFiles = map[string]bool{
+	"config.json":           true,
+	"sscconfig.json":        true,
+	"serversidechar.json":   true,
+	"tshock.sqlite.json":    true,
+	"motd.txt":              true,
+	"whitelist.txt":         true,
+	"setup-code.txt":        true,
+	"setup.lock":            true,
+	"rest-endpoints.json":   true,
+	"playerdata.json":       true,
+	"characterconfig.json":  true,
+	"servercharacter.json":  true,
+	"bans.json":             true,
+	"breaks.json":           true,
+	"tshock.pid":            true,
+	"configdescriptions.md": true,
+}
+
+// ListConfigFiles 列出房间已安装插件的配置文件
+// 优先使用注册表中声明的配置文件，未声明时按文件名匹配插件ID或名称
+func (s *PluginConfigService) ListConfigFiles(roomId uint) ([]PluginConfigFile, error) {
+	if _, err := NewPluginService().getTShockRoom(roomId); err != nil {
+		return nil, err
+	}
+
+	var installed []model.RoomPlugin
+	if err := utils.DB.Where("room_id = ?", roomId).Order("plugin_id").Find(&installed).Error; err != nil {
+		return nil, err
+	}
+
+	registry, err := s.registry.GetRegistry()
+	if err != nil {
+		log.Printf("⚠️ 获取插件注册表失败，仅按文件名识别插件配置: %v", err)
+		registry = &PluginRegistry{}
+	}
+	plugins := make(map[string]*RegistryPlugin)
+	for i := range registry.Plugins {
+		plugins[strings.ToLower(registry.Plugins[i].ID)] = &registry.Plugins[i]
+	}
+
+	tshockDir := filepath.Join(getRoomDir(roomId), "tshock")
+	candidates, _ := filepath.Glob(filepath.Join(tshockDir, "*.json"))
+
+	files := []PluginConfigFile{}
+	seen := make(map[string]bool)
+	add := func(file PluginConfigFile) {
+		if seen[strings.ToLower(file.Path)] {
+			return
+		}
+		seen[strings.ToLower(file.Path)] = true
+		files = append(files, file)
+	}
+
+	for _, p := range installed {
+		plugin := plugins[strings.ToLower(p.PluginID)]
+		reloadCommand := "/reload"
+		if plugin != nil && plugin.ReloadCommand != "" {
+			reloadCommand = plugin.ReloadCommand
+		}
+
+		// 注册表声明的配置文件
+		if plugin != nil && len(plugin.ConfigFiles) > 0 {
+			for _, decl := range plugin.ConfigFiles {
+				rel := filepath.Clean(filepath.FromSlash(decl.Path))
+				if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+					continue
+				}
+				matches, _ := filepath.Glob(filepath.Join(tshockDir, rel))
+				if len(matches) == 0 && !strings.ContainsAny(rel, "*?[") {
+					add(PluginConfigFile{
+						PluginID:      p.PluginID,
+						Path:          filepath.ToSlash(rel),
+						HasSchema:     len(decl.Schema) > 0,
+						schema:        decl.Schema,
+						reloadCommand: reloadCommand,
+					})
+					continue
+				}
+				for _, match := range matches {
+					add(newPluginConfigFile(p.PluginID, tshockDir, match, decl.Schema, reloadCommand))
+				}
+			}
+			continue
+		}
+
+		// 按文件名识别
+		keys := []string{normalizeConfigName(p.PluginID), normalizeConfigName(p.Name)}
+		for _, candidate := range candidates {
+			base := filepath.Base(candidate)
+			if tshockOwnConfigFiles[strings.ToLower(base)] {
+				continue
+			}
+			name := normalizeConfigName(strings.TrimSuffix(base, filepath.Ext(base)))
+			for _, key := range keys {
+				if key != "" && strings.Contains(name, key) {
+					add(newPluginConfigFile(p.PluginID, tshockDir, candidate, nil, reloadCommand))
+					break
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].PluginID != files[j].PluginID {
+			return files[i].PluginID < files[j].PluginID
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// GetConfigFile 读取插件配置文件及其Schema
+func (s *PluginConfigService) GetConfigFile(roomId uint, path string) (*PluginConfigContent, error) {
+	file, err := s.findConfigFile(roomId, path)
+	if err != nil {
+		return nil, err
+	}
+
+	content := map[string]interface{}{}
+	if file.Exists {
+		content, err = readJSONObject(filepath.Join(getRoomDir(roomId), "tshock", filepath.FromSlash(file.Path)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &PluginConfigContent{
+		PluginConfigFile: *file,
+		Content:          content,
+		Schema:           file.schema,
+	}, nil
+}
+
+// SaveConfigFile 校验并保存插件配置，随后在运行中的服务器上执行重载命令
+// 提交的内容会合并到现有配置中，未提交的键（包括Schema中未声明的键）保持不变
+func (s *PluginConfigService) SaveConfigFile(roomId uint, path string, updates map[string]interface{}) (*PluginConfigSaveResult, error) {
+	file, err := s.findConfigFile(roomId, path)
+	if err != nil {
+		return nil, err
+	}
+
+	fullPath := filepath.Join(getRoomDir(roomId), "tshock", filepath.FromSlash(file.Path))
+	merged := map[string]interface{}{}
+	if file.Exists {
+		merged, err = readJSONObject(fullPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	mergeJSONObject(merged, updates)
+
+	if len(file.schema) > 0 {
+		if errs := validateAgainstSchema(merged, file.schema); len(errs) > 0 {
+			return nil, fmt.Errorf("配置校验失败: %s", strings.Join(errs, "; "))
+		}
+	}
+
+	content, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(fullPath, content, 0644); err != nil {
+		return nil, err
+	}
+
+	result := &PluginConfigSaveResult{Path: file.Path}
+	output, err := NewTShockService().ExecuteRestCommand(roomId, file.reloadCommand)
+	if err != nil {
+		result.ReloadError = err.Error()
+	} else {
+		result.Reloaded = true
+		result.ReloadOutput = output
+	}
+
+	return result, nil
+}
+
+// findConfigFile 在已识别的插件配置文件中查找指定路径
+func (s *PluginConfigService) findConfigFile(roomId uint, path string) (*PluginConfigFile, error) {
+	files, err := s.ListConfigFiles(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	path = filepath.ToSlash(filepath.Clean(filepath.FromSlash(strings.TrimPrefix(path, "/"))))
+	path = strings.TrimPrefix(path, "tshock/")
+	for i := range files {
+		if strings.EqualFold(files[i].Path, path) {
+			return &files[i], nil
+		}
+	}
+	return nil, errors.New("该文件不是已安装插件的配置文件")
+}
+
+// newPluginConfigFile 根据磁盘文件构造配置文件信息
+func newPluginConfigFile(pluginId, tshockDir, fullPath string, schema json.RawMessage, reloadCommand string) PluginConfigFile {
+	rel, _ := filepath.Rel(tshockDir, fullPath)
+	file := PluginConfigFile{
+		PluginID:      pluginId,
+		Path:          filepath.ToSlash(rel),
+		HasSchema:     len(schema) > 0,
+		schema:        schema,
+		reloadCommand: reloadCommand,
+	}
+	if info, err := os.Stat(fullPath); err == nil {
+		file.Exists = true
+		file.Size = info.Size()
+		file.Modified = info.ModTime()
+	}
+	return file
+}
+
+// normalizeConfigName 去掉大小写和分隔符，便于匹配插件名与文件名
+func normalizeConfigName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '_' || r == '.' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// readJSONObject 读取JSON对象文件，数字保持原样避免精度丢失
+func readJSONObject(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, errors.New("配置文件格式错误")
+	}
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	return obj, nil
+}
+
+// mergeJSONObject 将 src 深度合并到 dst，嵌套对象逐键合并，其他值直接覆盖
+func mergeJSONObject(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcObj, srcIsObj := value.(map[string]interface{})
+		dstObj, dstIsObj := dst[key].(map[string]interface{})
+		if srcIsObj && dstIsObj {
+			mergeJSONObject(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免写入中断导致文件损坏
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// validateAgainstSchema 使用JSON Schema的常用子集校验数据
+// 支持 type、enum、minimum、maximum、minLength、maxLength、properties、required、items
+func validateAgainstSchema(value interface{}, rawSchema json.RawMessage) []string {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(rawSchema, &schema); err != nil {
+		return []string{"Schema格式错误: " + err.Error()}
+	}
+	var errs []string
+	validateSchemaNode(value, schema, "$", &errs)
+	return errs
+}
+
+func validateSchemaNode(value interface{}, schema map[string]interface{}, at string, errs *[]string) {
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch tv := t.(type) {
+		case string:
+			types = []string{tv}
+		case []interface{}:
+			for _, item := range tv {
+				if str, ok := item.(string); ok {
+					types = append(types, str)
+				}
+			}
+		}
+		matched := false
+		for _, typ := range types {
+			if jsonTypeMatches(value, typ) {
+				matched = true
+				break
+			}
+		}
+		if len(types) > 0 && !matched {
+			*errs = append(*errs, fmt.Sprintf("%s 应为 %s 类型", at, strings.Join(types, "/")))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if fmt.Sprint(candidate) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*errs = append(*errs, fmt.Sprintf("%s 的值不在允许范围内", at))
+		}
+	}
+
+	if num, ok := jsonNumber(value); ok {
+		if min, ok := schema["minimum"].(float64); ok && num < min {
+			*errs = append(*errs, fmt.Sprintf("%s 不能小于 %v", at, min))
+		}
+		if max, ok := schema["maximum"].(float64); ok && num > max {
+			*errs = append(*errs, fmt.Sprintf("%s 不能大于 %v", at, max))
+		}
+	}
+
+	if str, ok := value.(string); ok {
+		length := float64(len([]rune(str)))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			*errs = append(*errs, fmt.Sprintf("%s 长度不能小于 %v", at, min))
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			*errs = append(*errs, fmt.Sprintf("%s 长度不能大于 %v", at, max))
+		}
+	}
+
+	if obj, ok := value.(map[string]interface{}); ok {
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, key := range required {
+				if name, ok := key.(string); ok {
+					if _, exists := obj[name]; !exists {
+						*errs = append(*errs, fmt.Sprintf("%s.%s 为必填项", at, name))
+					}
+				}
+			}
+		}
+		if props, ok := schema["properties"].(map[string]interface{}); ok {
+			for name, propSchema := range props {
+				child, exists := obj[name]
+				sub, isObj := propSchema.(map[string]interface{})
+				if exists && isObj {
+					validateSchemaNode(child, sub, at+"."+name, errs)
+				}
+			}
+		}
+	}
+
+	if arr, ok := value.([]interface{}); ok {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range arr {
+				validateSchemaNode(item, items, fmt.Sprintf("%s[%d]", at, i), errs)
+			}
+		}
+	}
+}
+
+// jsonTypeMatches 判断值是否符合JSON Schema类型
+func jsonTypeMatches(value interface{}, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := jsonNumber(value)
+		return ok
+	case "integer":
+		num, ok := jsonNumber(value)
+		return ok && num == float64(int64(num))
+	}
+	return true
+}
+
+// jsonNumber 将解码后的数字（float64 或 json.Number）转换为 float64
+func jsonNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
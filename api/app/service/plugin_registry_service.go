@@ -0,0 +1,257 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// PluginRegistry 插件注册表索引
+type PluginRegistry struct {
+	UpdatedAt string           `json:"updatedAt"`
+	Plugins   []RegistryPlugin `json:"plugins"`
+}
+
+// RegistryPlugin 注册表中的插件
+type RegistryPlugin struct {
+	ID          string                  `json:"id"`
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Author      string                  `json:"author"`
+	Category    string                  `json:"category"`
+	Homepage    string                  `json:"homepage"`
+	Versions    []RegistryPluginVersion `json:"versions"`
+
+	ConfigFiles   []RegistryPluginConfigFile `json:"configFiles"`
+	ReloadCommand string                     `json:"reloadCommand"` // 保存配置后执行的重载命令，默认 /reload
+}
+
+// RegistryPluginConfigFile 插件的配置文件声明
+type RegistryPluginConfigFile struct {
+	Path   string          `json:"path"`   // 相对 tshock 目录的路径，支持通配符（如 "Economics/*.json"）
+	Schema json.RawMessage `json:"schema"` // 可选的 JSON Schema，用于类型化编辑和校验
+}
+
+// RegistryPluginVersion 插件的一个发布版本
+type RegistryPluginVersion struct {
+	Version      string                     `json:"version"`
+	TShockAPI    []string                   `json:"tshockApi"` // 兼容的TShock版本（前缀匹配，如 "5" 匹配 5.x.x），留空表示不限
+	DownloadURL  string                     `json:"downloadUrl"`
+	SHA256       string                     `json:"sha256"`
+	Dependencies []RegistryPluginDependency `json:"dependencies"`
+	Conflicts    []string                   `json:"conflicts"` // 不能与之同时安装的插件ID
+}
+
+// RegistryPluginDependency 插件依赖
+type RegistryPluginDependency struct {
+	ID      string `json:"id"`
+	Version string `json:"version"` // 版本要求，留空表示任意版本
+}
+
+// SupportsTShock 判断该版本是否兼容指定的TShock版本
+func (v *RegistryPluginVersion) SupportsTShock(tshockVersion string) bool {
+	if tshockVersion == "" || len(v.TShockAPI) == 0 {
+		return true
+	}
+	for _, pattern := range v.TShockAPI {
+		if utils.MatchVersionPrefix(pattern, tshockVersion) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompatibleVersions 获取兼容指定TShock版本的所有版本（从新到旧）
+func (p *RegistryPlugin) CompatibleVersions(tshockVersion string) []RegistryPluginVersion {
+	var versions []RegistryPluginVersion
+	for _, v := range p.Versions {
+		if v.SupportsTShock(tshockVersion) {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// PluginRegistryService 插件注册表服务（全局共享缓存）
+type PluginRegistryService struct {
+	mu        sync.RWMutex
+	registry  *PluginRegistry
+	fetchedAt time.Time
+	startOnce sync.Once
+}
+
+var pluginRegistryService = &PluginRegistryService{}
+
+// NewPluginRegistryService 获取插件注册表服务
+func NewPluginRegistryService() *PluginRegistryService {
+	return pluginRegistryService
+}
+
+// GetRegistry 获取插件注册表，缓存过期时自动刷新
+func (s *PluginRegistryService) GetRegistry() (*PluginRegistry, error) {
+	s.mu.RLock()
+	registry, fetchedAt := s.registry, s.fetchedAt
+	s.mu.RUnlock()
+
+	if registry != nil && time.Since(fetchedAt) < config.GlobalConfig.PluginRegistryRefresh {
+		return registry, nil
+	}
+
+	if err := s.Refresh(); err != nil {
+		// 刷新失败时继续使用旧缓存
+		if registry != nil {
+			log.Printf("⚠️ 刷新插件注册表失败，使用缓存: %v", err)
+			return registry, nil
+		}
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.registry, nil
+}
+
+// FindPlugin 根据ID查找插件
+func (s *PluginRegistryService) FindPlugin(id string) (*RegistryPlugin, error) {
+	registry, err := s.GetRegistry()
+	if err != nil {
+		return nil, err
+	}
+	for i := range registry.Plugins {
+		if strings.EqualFold(registry.Plugins[i].ID, id) {
+			return &registry.Plugins[i], nil
+		}
+	}
+	return nil, fmt.Errorf("插件 %s 不存在于注册表中", id)
+}
+
+// Refresh 重新加载插件注册表
+func (s *PluginRegistryService) Refresh() error {
+	source := config.GlobalConfig.PluginRegistry
+	content, err := s.fetch(source)
+	if err != nil && !isRemoteSource(source) && os.IsNotExist(err) {
+		// 新安装时还没有注册表文件，按空注册表处理
+		log.Printf("⚠️ 插件注册表文件 %s 不存在，插件列表为空（可通过 TERRARIA_PLUGIN_REGISTRY 指定注册表）", source)
+		content, err = []byte(`{"plugins": []}`), nil
+	}
+	if err != nil {
+		// 远程注册表不可用时回退到本地缓存文件
+		cached, cacheErr := os.ReadFile(s.cachePath())
+		if cacheErr != nil || !isRemoteSource(source) {
+			return fmt.Errorf("加载插件注册表失败: %w", err)
+		}
+		log.Printf("⚠️ 拉取插件注册表失败，使用本地缓存: %v", err)
+		content = cached
+	}
+
+	registry, err := parsePluginRegistry(content)
+	if err != nil {
+		return err
+	}
+
+	if isRemoteSource(source) {
+		if err := os.WriteFile(s.cachePath(), content, 0644); err != nil {
+			log.Printf("⚠️ 写入插件注册表缓存失败: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.registry = registry
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+
+	log.Printf("✅ 插件注册表已刷新，共 %d 个插件", len(registry.Plugins))
+	return nil
+}
+
+// StartAutoRefresh 启动定时刷新
+func (s *PluginRegistryService) StartAutoRefresh() {
+	s.startOnce.Do(func() {
+		go func() {
+			if err := s.Refresh(); err != nil {
+				log.Printf("⚠️ %v", err)
+			}
+			ticker := time.NewTicker(config.GlobalConfig.PluginRegistryRefresh)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := s.Refresh(); err != nil {
+					log.Printf("⚠️ %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// fetch 从本地文件或HTTP地址读取注册表内容
+func (s *PluginRegistryService) fetch(source string) ([]byte, error) {
+	if !isRemoteSource(source) {
+		return os.ReadFile(source)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+}
+
+// cachePath 远程注册表的本地缓存路径
+func (s *PluginRegistryService) cachePath() string {
+	return filepath.Join(config.GlobalConfig.DBPath, "plugin_registry.cache.json")
+}
+
+// isRemoteSource 判断注册表地址是否为HTTP URL
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// parsePluginRegistry 解析并校验注册表内容
+func parsePluginRegistry(content []byte) (*PluginRegistry, error) {
+	var registry PluginRegistry
+	if err := json.Unmarshal(content, &registry); err != nil {
+		return nil, errors.New("插件注册表格式错误: " + err.Error())
+	}
+
+	seen := make(map[string]bool)
+	for i := range registry.Plugins {
+		plugin := &registry.Plugins[i]
+		if plugin.ID == "" {
+			return nil, errors.New("插件注册表格式错误: 存在缺少id的插件")
+		}
+		key := strings.ToLower(plugin.ID)
+		if seen[key] {
+			return nil, fmt.Errorf("插件注册表格式错误: 插件id重复 %s", plugin.ID)
+		}
+		seen[key] = true
+
+		for _, v := range plugin.Versions {
+			if v.Version == "" || v.DownloadURL == "" {
+				return nil, fmt.Errorf("插件注册表格式错误: 插件 %s 的版本缺少version或downloadUrl", plugin.ID)
+			}
+		}
+
+		// 版本从新到旧排序
+		sort.SliceStable(plugin.Versions, func(a, b int) bool {
+			return utils.CompareVersions(plugin.Versions[a].Version, plugin.Versions[b].Version) > 0
+		})
+	}
+
+	return &registry, nil
+}
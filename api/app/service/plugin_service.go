@@ -0,0 +1,509 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/utils"
+	"time"
+)
+
+// PluginService 房间插件管理服务
+type PluginService struct {
+	registry *PluginRegistryService
+}
+
+// NewPluginService 创建插件服务
+func NewPluginService() *PluginService {
+	return &PluginService{
+		registry: NewPluginRegistryService(),
+	}
+}
+
+// PluginRequest 要安装的插件
+type PluginRequest struct {
+	ID      string `json:"id" binding:"required"`
+	Version string `json:"version"` // 留空表示最新的兼容版本
+}
+
+// 安装计划中的动作
+const (
+	PluginActionInstall   = "install"
+	PluginActionUpgrade   = "upgrade"
+	PluginActionDowngrade = "downgrade"
+	PluginActionKeep      = "keep"
+)
+
+// PluginPlanStep 安装计划中的一个插件
+type PluginPlanStep struct {
+	PluginID     string                     `json:"pluginId"`
+	Name         string                     `json:"name"`
+	Action       string                     `json:"action"`
+	Version      string                     `json:"version"`
+	FromVersion  string                     `json:"fromVersion"`
+	Reason       string                     `json:"reason"`
+	DownloadURL  string                     `json:"downloadUrl"`
+	SHA256       string                     `json:"sha256"`
+	Dependencies []RegistryPluginDependency `json:"dependencies"`
+	conflicts    []string
+}
+
+// PluginInstallPlan 插件安装计划（依赖在前，按执行顺序排列）
+type PluginInstallPlan struct {
+	RoomID        uint             `json:"roomId"`
+	TShockVersion string           `json:"tshockVersion"`
+	Steps         []PluginPlanStep `json:"steps"`
+	Conflicts     []string         `json:"conflicts"`
+	Errors        []string         `json:"errors"`
+	Warnings      []string         `json:"warnings"`
+	CanApply      bool             `json:"canApply"`
+}
+
+// GetRoomPlugins 获取房间已安装的插件
+func (s *PluginService) GetRoomPlugins(roomId uint) ([]model.RoomPlugin, error) {
+	if _, err := s.getTShockRoom(roomId); err != nil {
+		return nil, err
+	}
+
+	var plugins []model.RoomPlugin
+	err := utils.DB.Where("room_id = ?", roomId).Order("plugin_id").Find(&plugins).Error
+	return plugins, err
+}
+
+// PlanInstall 生成安装计划，不修改任何文件
+func (s *PluginService) PlanInstall(roomId uint, requests []PluginRequest) (*PluginInstallPlan, error) {
+	room, err := s.getTShockRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := s.registry.GetRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []model.RoomPlugin
+	if err := utils.DB.Where("room_id = ?", roomId).Find(&installed).Error; err != nil {
+		return nil, err
+	}
+
+	r := newPluginResolver(registry, room.Version, installed)
+	r.plan.RoomID = roomId
+	if room.Version == "" {
+		r.plan.Warnings = append(r.plan.Warnings, "房间未记录TShock版本，已跳过TShock兼容性检查")
+	}
+
+	for _, req := range requests {
+		r.resolve(req.ID, "", req.Version, "用户选择", true)
+	}
+	r.checkConflicts()
+
+	plan := r.plan
+	for _, key := range r.order {
+		plan.Steps = append(plan.Steps, *r.selected[key])
+	}
+
+	changes := 0
+	for _, step := range plan.Steps {
+		if step.Action != PluginActionKeep {
+			changes++
+		}
+	}
+	if changes == 0 && len(plan.Errors) == 0 {
+		plan.Warnings = append(plan.Warnings, "所选插件均已安装，无需变更")
+	}
+	if room.Status == model.StatusRunning && changes > 0 {
+		plan.Warnings = append(plan.Warnings, "服务器正在运行，插件将在重启后生效")
+	}
+	plan.CanApply = changes > 0 && len(plan.Errors) == 0 && len(plan.Conflicts) == 0
+
+	return plan, nil
+}
+
+// InstallPlugins 按安装计划安装插件及其依赖
+// 所有文件下载并校验通过后才会替换到 ServerPlugins 目录
+func (s *PluginService) InstallPlugins(roomId uint, requests []PluginRequest) (*PluginInstallPlan, error) {
+	plan, err := s.PlanInstall(roomId, requests)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.CanApply {
+		return plan, errors.New("安装计划存在问题，无法执行")
+	}
+
+	pluginDir := filepath.Join(getRoomDir(roomId), "ServerPlugins")
+	if err := os.MkdirAll(pluginDir, 0755); err != nil {
+		return plan, err
+	}
+
+	// 先全部下载到临时文件
+	staged := make(map[string]string)
+	defer func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}()
+	for _, step := range plan.Steps {
+		if step.Action == PluginActionKeep {
+			continue
+		}
+		tmp := filepath.Join(pluginDir, "."+strings.ToLower(step.PluginID)+".download")
+		if err := downloadPluginFile(step.DownloadURL, tmp, step.SHA256); err != nil {
+			os.Remove(tmp)
+			return plan, fmt.Errorf("下载插件 %s 失败: %w", step.PluginID, err)
+		}
+		staged[step.PluginID] = tmp
+	}
+
+	// 再依次替换文件并记录
+	for _, step := range plan.Steps {
+		if step.Action == PluginActionKeep {
+			continue
+		}
+
+		var record model.RoomPlugin
+		found := utils.DB.Where("room_id = ? AND plugin_id = ?", roomId, step.PluginID).First(&record).Error == nil
+
+		fileName := pluginFileName(step.PluginID, step.DownloadURL)
+		if found && record.FileName != "" && record.FileName != fileName {
+			os.Remove(filepath.Join(pluginDir, record.FileName))
+		}
+		if err := os.Rename(staged[step.PluginID], filepath.Join(pluginDir, fileName)); err != nil {
+			return plan, fmt.Errorf("安装插件 %s 失败: %w", step.PluginID, err)
+		}
+		delete(staged, step.PluginID)
+
+		deps, _ := json.Marshal(step.Dependencies)
+		record.RoomID = roomId
+		record.PluginID = step.PluginID
+		record.Name = step.Name
+		record.Version = step.Version
+		record.FileName = fileName
+		record.SHA256 = step.SHA256
+		record.Dependencies = string(deps)
+		if err := utils.DB.Save(&record).Error; err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, nil
+}
+
+// UninstallPlugin 卸载插件
+// 有其他已安装插件依赖目标插件时，必须 force 才会卸载，并返回依赖方列表
+func (s *PluginService) UninstallPlugin(roomId uint, pluginId string, force bool) ([]string, error) {
+	if _, err := s.getTShockRoom(roomId); err != nil {
+		return nil, err
+	}
+
+	var installed []model.RoomPlugin
+	if err := utils.DB.Where("room_id = ?", roomId).Find(&installed).Error; err != nil {
+		return nil, err
+	}
+
+	var target *model.RoomPlugin
+	dependents := []string{}
+	for i := range installed {
+		p := &installed[i]
+		if strings.EqualFold(p.PluginID, pluginId) {
+			target = p
+			continue
+		}
+		for _, dep := range parsePluginDependencies(p.Dependencies) {
+			if strings.EqualFold(dep.ID, pluginId) {
+				dependents = append(dependents, p.PluginID)
+				break
+			}
+		}
+	}
+	if target == nil {
+		return nil, errors.New("插件未安装")
+	}
+
+	if len(dependents) > 0 && !force {
+		return dependents, fmt.Errorf("以下插件依赖 %s: %s，确认卸载请使用 force=true", target.PluginID, strings.Join(dependents, ", "))
+	}
+
+	if target.FileName != "" {
+		filePath := filepath.Join(getRoomDir(roomId), "ServerPlugins", target.FileName)
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return dependents, err
+		}
+	}
+
+	return dependents, utils.DB.Delete(target).Error
+}
+
+// getTShockRoom 获取房间并确认是TShock服务器
+func (s *PluginService) getTShockRoom(roomId uint) (*model.Room, error) {
+	var room model.Room
+	if err := utils.DB.First(&room, roomId).Error; err != nil {
+		return nil, errors.New("房间不存在")
+	}
+	if room.Type != model.ServerTypeTShock {
+		return nil, errors.New("此房间不是TShock服务器")
+	}
+	return &room, nil
+}
+
+// pluginResolver 依赖解析器
+type pluginResolver struct {
+	plugins       map[string]*RegistryPlugin
+	tshockVersion string
+	installed     map[string]model.RoomPlugin
+	selected      map[string]*PluginPlanStep
+	order         []string
+	plan          *PluginInstallPlan
+}
+
+func newPluginResolver(registry *PluginRegistry, tshockVersion string, installed []model.RoomPlugin) *pluginResolver {
+	r := &pluginResolver{
+		plugins:       make(map[string]*RegistryPlugin),
+		tshockVersion: tshockVersion,
+		installed:     make(map[string]model.RoomPlugin),
+		selected:      make(map[string]*PluginPlanStep),
+		plan: &PluginInstallPlan{
+			TShockVersion: tshockVersion,
+			Steps:         []PluginPlanStep{},
+			Conflicts:     []string{},
+			Errors:        []string{},
+			Warnings:      []string{},
+		},
+	}
+	for i := range registry.Plugins {
+		r.plugins[strings.ToLower(registry.Plugins[i].ID)] = &registry.Plugins[i]
+	}
+	for _, p := range installed {
+		r.installed[strings.ToLower(p.PluginID)] = p
+	}
+	return r
+}
+
+// resolve 选择插件版本并递归解析其依赖
+func (r *pluginResolver) resolve(id, constraint, exactVersion, reason string, requested bool) {
+	key := strings.ToLower(id)
+
+	// 已在计划中：检查版本要求是否一致
+	if step, ok := r.selected[key]; ok {
+		if !utils.SatisfiesVersion(step.Version, constraint) ||
+			(exactVersion != "" && utils.CompareVersions(step.Version, exactVersion) != 0) {
+			want := constraint
+			if exactVersion != "" {
+				want = exactVersion
+			}
+			r.plan.Conflicts = append(r.plan.Conflicts,
+				fmt.Sprintf("%s 需要 %s %s，但计划安装的版本是 %s", reason, step.PluginID, want, step.Version))
+		}
+		return
+	}
+
+	installed, isInstalled := r.installed[key]
+
+	// 作为依赖时，已安装且满足要求的版本直接保留
+	if !requested && isInstalled && utils.SatisfiesVersion(installed.Version, constraint) {
+		r.selected[key] = &PluginPlanStep{
+			PluginID:     installed.PluginID,
+			Name:         installed.Name,
+			Action:       PluginActionKeep,
+			Version:      installed.Version,
+			FromVersion:  installed.Version,
+			Reason:       reason,
+			Dependencies: parsePluginDependencies(installed.Dependencies),
+		}
+		r.order = append(r.order, key)
+		return
+	}
+
+	plugin, ok := r.plugins[key]
+	if !ok {
+		r.plan.Errors = append(r.plan.Errors, fmt.Sprintf("插件 %s 不存在于注册表中（%s）", id, reason))
+		return
+	}
+
+	version := r.pickVersion(plugin, constraint, exactVersion, reason)
+	if version == nil {
+		return
+	}
+
+	step := &PluginPlanStep{
+		PluginID:     plugin.ID,
+		Name:         plugin.Name,
+		Action:       PluginActionInstall,
+		Version:      version.Version,
+		Reason:       reason,
+		DownloadURL:  version.DownloadURL,
+		SHA256:       version.SHA256,
+		Dependencies: version.Dependencies,
+		conflicts:    version.Conflicts,
+	}
+	if step.Dependencies == nil {
+		step.Dependencies = []RegistryPluginDependency{}
+	}
+	if isInstalled {
+		step.FromVersion = installed.Version
+		switch c := utils.CompareVersions(version.Version, installed.Version); {
+		case c > 0:
+			step.Action = PluginActionUpgrade
+		case c < 0:
+			step.Action = PluginActionDowngrade
+		default:
+			step.Action = PluginActionKeep
+		}
+	}
+	r.selected[key] = step
+
+	for _, dep := range version.Dependencies {
+		r.resolve(dep.ID, dep.Version, "", fmt.Sprintf("被 %s 依赖", plugin.ID), false)
+	}
+
+	// 依赖解析完成后再加入顺序，保证依赖先安装
+	r.order = append(r.order, key)
+}
+
+// pickVersion 选择满足要求且兼容房间TShock版本的最新版本
+func (r *pluginResolver) pickVersion(plugin *RegistryPlugin, constraint, exactVersion, reason string) *RegistryPluginVersion {
+	var incompatible []string
+	for i := range plugin.Versions {
+		v := &plugin.Versions[i]
+		if exactVersion != "" && utils.CompareVersions(v.Version, exactVersion) != 0 {
+			continue
+		}
+		if !utils.SatisfiesVersion(v.Version, constraint) {
+			continue
+		}
+		if !v.SupportsTShock(r.tshockVersion) {
+			incompatible = append(incompatible, fmt.Sprintf("%s(支持TShock %s)", v.Version, strings.Join(v.TShockAPI, "/")))
+			continue
+		}
+		return v
+	}
+
+	want := constraint
+	if exactVersion != "" {
+		want = exactVersion
+	}
+	if want == "" {
+		want = "任意版本"
+	}
+	if len(incompatible) > 0 {
+		r.plan.Errors = append(r.plan.Errors, fmt.Sprintf("插件 %s %s 与房间的TShock %s 不兼容: %s（%s）",
+			plugin.ID, want, r.tshockVersion, strings.Join(incompatible, ", "), reason))
+	} else {
+		r.plan.Errors = append(r.plan.Errors, fmt.Sprintf("插件 %s 没有满足要求 %s 的版本（%s）", plugin.ID, want, reason))
+	}
+	return nil
+}
+
+// checkConflicts 检查冲突声明以及已安装插件的依赖是否被破坏
+func (r *pluginResolver) checkConflicts() {
+	// 最终状态：计划中的版本覆盖已安装的版本
+	final := make(map[string]string)
+	for key, p := range r.installed {
+		final[key] = p.Version
+	}
+	for key, step := range r.selected {
+		final[key] = step.Version
+	}
+
+	// 计划安装的插件声明的冲突
+	for _, key := range r.order {
+		step := r.selected[key]
+		for _, c := range step.conflicts {
+			if _, ok := final[strings.ToLower(c)]; ok {
+				r.plan.Conflicts = append(r.plan.Conflicts, fmt.Sprintf("%s %s 与插件 %s 冲突", step.PluginID, step.Version, c))
+			}
+		}
+	}
+
+	for key, p := range r.installed {
+		if _, ok := r.selected[key]; ok {
+			continue
+		}
+
+		// 已安装插件声明的冲突
+		if plugin, ok := r.plugins[key]; ok {
+			for _, v := range plugin.Versions {
+				if utils.CompareVersions(v.Version, p.Version) != 0 {
+					continue
+				}
+				for _, c := range v.Conflicts {
+					if step, ok := r.selected[strings.ToLower(c)]; ok && step.Action != PluginActionKeep {
+						r.plan.Conflicts = append(r.plan.Conflicts, fmt.Sprintf("已安装的 %s 与插件 %s 冲突", p.PluginID, step.PluginID))
+					}
+				}
+			}
+		}
+
+		// 升级或降级后，已安装插件的依赖要求是否仍然满足
+		for _, dep := range parsePluginDependencies(p.Dependencies) {
+			step, ok := r.selected[strings.ToLower(dep.ID)]
+			if !ok || step.Action == PluginActionKeep {
+				continue
+			}
+			if !utils.SatisfiesVersion(step.Version, dep.Version) {
+				r.plan.Conflicts = append(r.plan.Conflicts,
+					fmt.Sprintf("已安装的 %s 需要 %s %s，与计划安装的 %s 不兼容", p.PluginID, dep.ID, dep.Version, step.Version))
+			}
+		}
+	}
+}
+
+// parsePluginDependencies 解析已安装插件记录中的依赖
+func parsePluginDependencies(raw string) []RegistryPluginDependency {
+	var deps []RegistryPluginDependency
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &deps)
+	}
+	return deps
+}
+
+// pluginFileName 根据下载地址确定插件文件名
+func pluginFileName(pluginId, downloadURL string) string {
+	name := path.Base(strings.SplitN(downloadURL, "?", 2)[0])
+	if !strings.EqualFold(filepath.Ext(name), ".dll") {
+		name = pluginId + ".dll"
+	}
+	return filepath.Base(name)
+}
+
+// downloadPluginFile 下载插件文件并校验SHA-256
+func downloadPluginFile(url, dest, expectedSHA256 string) error {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), resp.Body); err != nil {
+		return err
+	}
+
+	if expectedSHA256 != "" {
+		actual := hex.EncodeToString(hash.Sum(nil))
+		if !strings.EqualFold(actual, expectedSHA256) {
+			return fmt.Errorf("SHA-256校验失败: 期望 %s，实际 %s", expectedSHA256, actual)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,483 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// ProgressionService 房间世界进度跟踪服务
+// 进度来自两处：服务端日志中的广播（时间准确），以及定时读取世界文件头部的快照（补充日志中没有的进度）
+type ProgressionService struct{}
+
+var progressionStartOnce sync.Once
+
+// NewProgressionService 创建进度服务
+func NewProgressionService() *ProgressionService {
+	return &ProgressionService{}
+}
+
+// RoomProgression 房间当前世界的进度
+type RoomProgression struct {
+	RoomID         uint              `json:"roomId"`
+	RoomName       string            `json:"roomName"`
+	WorldName      string            `json:"worldName"`
+	World          *model.WorldInfo  `json:"world"`
+	WorldError     string            `json:"worldError"`
+	Hardmode       bool              `json:"hardmode"`
+	HardmodeAt     *time.Time        `json:"hardmodeAt"`
+	DefeatedBosses int               `json:"defeatedBosses"`
+	Bosses         []ProgressionItem `json:"bosses"`
+	Invasions      []ProgressionItem `json:"invasions"`
+	TotalDeaths    int64             `json:"totalDeaths"`
+	DeathsByCause  []DeathCount      `json:"deathsByCause"`
+	DeathsByPlayer []DeathCount      `json:"deathsByPlayer"`
+	LastSnapshotAt *time.Time        `json:"lastSnapshotAt"`
+}
+
+// ProgressionItem Boss或入侵的完成情况
+type ProgressionItem struct {
+	Key        string     `json:"key"`
+	Defeated   bool       `json:"defeated"`
+	DefeatedAt *time.Time `json:"defeatedAt"` // 最早一次记录的时间
+	Source     string     `json:"source"`     // log / snapshot
+	Count      int        `json:"count"`      // 日志中记录到的击败次数
+}
+
+// DeathCount 死亡次数统计
+type DeathCount struct {
+	Name  string `json:"name"` // 死因或玩家名
+	Count int64  `json:"count"`
+}
+
+// ProgressionTimeline 房间的进度快照和事件
+type ProgressionTimeline struct {
+	Snapshots []model.ProgressionSnapshot `json:"snapshots"`
+	Events    []model.ProgressionEvent    `json:"events"`
+}
+
+// 日志中的广播（英文和简体中文服务端）
+var (
+	defeatedPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^(.+?) (?:has|have) been defeated!$`),
+		regexp.MustCompile(`^(.+?)已被打败！$`),
+	}
+	hardmodePattern = regexp.MustCompile(`^The ancient spirits of light and dark have been released\.$`)
+	deathPatterns   = []struct {
+		pattern *regexp.Regexp
+		cause   string // 为空时死因取自匹配的第二组
+	}{
+		{regexp.MustCompile(`^(.+?) (?:was|were|got|has been) [a-zA-Z' ]+? by (.+?)\.?$`), ""},
+		{regexp.MustCompile(`^(.+?)被(.+?)(?:杀死|杀害|击杀|消灭)了?。?$`), ""},
+		{regexp.MustCompile(`^(.+?) fell to (?:their|his|her) death\.?$`), "fall"},
+		{regexp.MustCompile(`^(.+?) (?:drowned|forgot to breathe)\.?$`), "drowning"},
+		{regexp.MustCompile(`^(.+?) (?:tried to swim in lava|got melted|was incinerated)\.?$`), "lava"},
+	}
+)
+
+// 广播中的名称（小写）到Boss、入侵标识的对应关系
+var progressionNames = map[string]struct{ kind, key string }{
+	"king slime":       {model.ProgressionEventBoss, "kingSlime"},
+	"eye of cthulhu":   {model.ProgressionEventBoss, "eyeOfCthulhu"},
+	"eater of worlds":  {model.ProgressionEventBoss, "eaterOfWorlds"},
+	"brain of cthulhu": {model.ProgressionEventBoss, "brainOfCthulhu"},
+	"queen bee":        {model.ProgressionEventBoss, "queenBee"},
+	"skeletron":        {model.ProgressionEventBoss, "skeletron"},
+	"deerclops":        {model.ProgressionEventBoss, "deerclops"},
+	"wall of flesh":    {model.ProgressionEventBoss, "wallOfFlesh"},
+	"queen slime":      {model.ProgressionEventBoss, "queenSlime"},
+	"the destroyer":    {model.ProgressionEventBoss, "destroyer"},
+	"the twins":        {model.ProgressionEventBoss, "twins"},
+	"skeletron prime":  {model.ProgressionEventBoss, "skeletronPrime"},
+	"plantera":         {model.ProgressionEventBoss, "plantera"},
+	"golem":            {model.ProgressionEventBoss, "golem"},
+	"duke fishron":     {model.ProgressionEventBoss, "dukeFishron"},
+	"empress of light": {model.ProgressionEventBoss, "empressOfLight"},
+	"lunatic cultist":  {model.ProgressionEventBoss, "lunaticCultist"},
+	"moon lord":        {model.ProgressionEventBoss, "moonLord"},
+	"solar pillar":     {model.ProgressionEventBoss, "solarPillar"},
+	"vortex pillar":    {model.ProgressionEventBoss, "vortexPillar"},
+	"nebula pillar":    {model.ProgressionEventBoss, "nebulaPillar"},
+	"stardust pillar":  {model.ProgressionEventBoss, "stardustPillar"},
+	"mourning wood":    {model.ProgressionEventBoss, "mourningWood"},
+	"pumpking":         {model.ProgressionEventBoss, "pumpking"},
+	"everscream":       {model.ProgressionEventBoss, "everscream"},
+	"santa-nk1":        {model.ProgressionEventBoss, "santaNK1"},
+	"ice queen":        {model.ProgressionEventBoss, "iceQueen"},
+	"the goblin army":  {model.ProgressionEventInvasion, "goblinArmy"},
+	"the frost legion": {model.ProgressionEventInvasion, "frostLegion"},
+	"the pirates":      {model.ProgressionEventInvasion, "pirateInvasion"},
+	"the martians":     {model.ProgressionEventInvasion, "martianMadness"},
+	"史莱姆王":             {model.ProgressionEventBoss, "kingSlime"},
+	"克苏鲁之眼":            {model.ProgressionEventBoss, "eyeOfCthulhu"},
+	"世界吞噬怪":            {model.ProgressionEventBoss, "eaterOfWorlds"},
+	"克苏鲁之脑":            {model.ProgressionEventBoss, "brainOfCthulhu"},
+	"蜂王":               {model.ProgressionEventBoss, "queenBee"},
+	"骷髅王":              {model.ProgressionEventBoss, "skeletron"},
+	"鹿角怪":              {model.ProgressionEventBoss, "deerclops"},
+	"血肉墙":              {model.ProgressionEventBoss, "wallOfFlesh"},
+	"史莱姆皇后":            {model.ProgressionEventBoss, "queenSlime"},
+	"毁灭者":              {model.ProgressionEventBoss, "destroyer"},
+	"双子魔眼":             {model.ProgressionEventBoss, "twins"},
+	"机械骷髅王":            {model.ProgressionEventBoss, "skeletronPrime"},
+	"世纪之花":             {model.ProgressionEventBoss, "plantera"},
+	"石巨人":              {model.ProgressionEventBoss, "golem"},
+	"猪龙鱼公爵":            {model.ProgressionEventBoss, "dukeFishron"},
+	"光之女皇":             {model.ProgressionEventBoss, "empressOfLight"},
+	"拜月教邪教徒":           {model.ProgressionEventBoss, "lunaticCultist"},
+	"月亮领主":             {model.ProgressionEventBoss, "moonLord"},
+	"日耀柱":              {model.ProgressionEventBoss, "solarPillar"},
+	"星旋柱":              {model.ProgressionEventBoss, "vortexPillar"},
+	"星云柱":              {model.ProgressionEventBoss, "nebulaPillar"},
+	"星尘柱":              {model.ProgressionEventBoss, "stardustPillar"},
+	"哀木":               {model.ProgressionEventBoss, "mourningWood"},
+	"南瓜王":              {model.ProgressionEventBoss, "pumpking"},
+	"常绿尖叫怪":            {model.ProgressionEventBoss, "everscream"},
+	"圣诞坦克":             {model.ProgressionEventBoss, "santaNK1"},
+	"冰雪女王":             {model.ProgressionEventBoss, "iceQueen"},
+	"哥布林军队":            {model.ProgressionEventInvasion, "goblinArmy"},
+	"雪人军团":             {model.ProgressionEventInvasion, "frostLegion"},
+	"海盗":               {model.ProgressionEventInvasion, "pirateInvasion"},
+	"火星人":              {model.ProgressionEventInvasion, "martianMadness"},
+}
+
+// StartAutoSnapshot 启动运行中房间的定时进度快照
+func (s *ProgressionService) StartAutoSnapshot() {
+	progressionStartOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(config.GlobalConfig.ProgressionInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				var roomIds []uint
+				utils.DB.Model(&model.Room{}).Where("status = ?", model.StatusRunning).Pluck("id", &roomIds)
+				for _, roomId := range roomIds {
+					if _, err := s.Capture(roomId, model.ProgressionTriggerSchedule); err != nil {
+						log.Printf("⚠️ 记录房间 %d 的进度快照失败: %v", roomId, err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// HandleLogLine 解析服务端日志中的一行，记录Boss、入侵、困难模式和玩家死亡事件
+func (s *ProgressionService) HandleLogLine(roomId uint, at time.Time, line string) {
+	event := parseProgressionLine(strings.TrimSpace(line))
+	if event == nil {
+		return
+	}
+
+	var room model.Room
+	if err := utils.DB.Select("id", "world_name").First(&room, roomId).Error; err != nil {
+		return
+	}
+	event.RoomID = roomId
+	event.WorldName = room.WorldName
+	event.WorldUID = s.latestWorldUID(roomId, room.WorldName)
+	event.Source = model.ProgressionSourceLog
+	event.OccurredAt = at
+	if err := utils.DB.Create(event).Error; err != nil {
+		log.Printf("⚠️ 记录房间 %d 的进度事件失败: %v", roomId, err)
+	}
+}
+
+// parseProgressionLine 识别日志行中的进度事件，玩家聊天（<玩家> 内容）不会被识别
+func parseProgressionLine(line string) *model.ProgressionEvent {
+	if line == "" || strings.HasPrefix(line, "<") {
+		return nil
+	}
+
+	if hardmodePattern.MatchString(line) {
+		return &model.ProgressionEvent{Kind: model.ProgressionEventHardmode, Key: "hardmode", Message: line}
+	}
+	for _, pattern := range defeatedPatterns {
+		if m := pattern.FindStringSubmatch(line); m != nil {
+			if name, ok := progressionNames[strings.ToLower(strings.TrimSpace(m[1]))]; ok {
+				return &model.ProgressionEvent{Kind: name.kind, Key: name.key, Message: line}
+			}
+			return &model.ProgressionEvent{Kind: model.ProgressionEventBoss, Key: strings.TrimSpace(m[1]), Message: line}
+		}
+	}
+	// 踢出、封禁等管理提示的句式和死亡消息相同
+	if strings.Contains(line, " kicked ") || strings.Contains(line, " banned ") || strings.Contains(line, "被踢出") {
+		return nil
+	}
+	for _, death := range deathPatterns {
+		m := death.pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		cause := death.cause
+		if cause == "" {
+			// "被史莱姆的xxx杀死" / "by Zombie's Claw" 只保留攻击者
+			cause, _, _ = strings.Cut(m[2], "'s ")
+			cause, _, _ = strings.Cut(cause, "的")
+			cause = strings.TrimSpace(cause)
+		}
+		return &model.ProgressionEvent{Kind: model.ProgressionEventDeath, Key: cause, Player: strings.TrimSpace(m[1]), Message: line}
+	}
+	return nil
+}
+
+// Capture 读取房间当前世界的头部记录进度快照，日志中没有记录的新进度按快照时间补充事件
+// 定时快照与上一次完全相同时不重复记录
+func (s *ProgressionService) Capture(roomId uint, trigger string) (*model.ProgressionSnapshot, error) {
+	var room model.Room
+	if err := utils.DB.First(&room, roomId).Error; err != nil {
+		return nil, errors.New("房间不存在")
+	}
+
+	path := filepath.Join(getRoomWorldsDir(roomId), worldFileName(room.WorldName))
+	if _, err := os.Stat(path); err != nil {
+		return nil, errors.New("世界尚未生成")
+	}
+	info, err := utils.ReadWorldFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取世界文件失败: %w", err)
+	}
+
+	// 之前记录的日志事件属于当前世界
+	utils.DB.Model(&model.ProgressionEvent{}).
+		Where("room_id = ? AND world_name = ? AND world_uid = ''", roomId, room.WorldName).
+		Update("world_uid", info.UniqueID)
+
+	now := time.Now()
+	events := s.worldEvents(roomId, room.WorldName, info.UniqueID)
+	recorded := make(map[string]bool)
+	for _, event := range events {
+		recorded[event.Kind+"|"+event.Key] = true
+	}
+	var added []model.ProgressionEvent
+	addEvent := func(kind, key string) {
+		if !recorded[kind+"|"+key] {
+			added = append(added, model.ProgressionEvent{
+				RoomID: roomId, WorldName: room.WorldName, WorldUID: info.UniqueID,
+				Kind: kind, Key: key, Source: model.ProgressionSourceSnapshot, OccurredAt: now,
+			})
+		}
+	}
+	if info.Hardmode {
+		addEvent(model.ProgressionEventHardmode, "hardmode")
+	}
+	for _, boss := range info.DownedBosses {
+		addEvent(model.ProgressionEventBoss, boss)
+	}
+	for _, invasion := range info.Invasions {
+		addEvent(model.ProgressionEventInvasion, invasion)
+	}
+	if len(added) > 0 {
+		if err := utils.DB.Create(&added).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var deaths int64
+	for _, event := range events {
+		if event.Kind == model.ProgressionEventDeath {
+			deaths++
+		}
+	}
+	snapshot := &model.ProgressionSnapshot{
+		RoomID:       roomId,
+		WorldName:    room.WorldName,
+		WorldUID:     info.UniqueID,
+		Trigger:      trigger,
+		Hardmode:     info.Hardmode,
+		DownedBosses: info.DownedBosses,
+		Invasions:    info.Invasions,
+		Deaths:       deaths,
+	}
+
+	var last model.ProgressionSnapshot
+	if trigger == model.ProgressionTriggerSchedule &&
+		utils.DB.Where("room_id = ?", roomId).Order("id DESC").Limit(1).Find(&last).RowsAffected > 0 &&
+		last.WorldUID == snapshot.WorldUID && last.WorldName == snapshot.WorldName &&
+		last.Hardmode == snapshot.Hardmode && last.Deaths == snapshot.Deaths &&
+		slices.Equal(last.DownedBosses, snapshot.DownedBosses) && slices.Equal(last.Invasions, snapshot.Invasions) {
+		return &last, nil
+	}
+
+	if err := utils.DB.Create(snapshot).Error; err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetProgression 获取房间当前世界的进度
+func (s *ProgressionService) GetProgression(roomId uint) (*RoomProgression, error) {
+	var room model.Room
+	if err := utils.DB.First(&room, roomId).Error; err != nil {
+		return nil, errors.New("房间不存在")
+	}
+
+	progression := &RoomProgression{
+		RoomID:         room.ID,
+		RoomName:       room.Name,
+		WorldName:      room.WorldName,
+		Bosses:         []ProgressionItem{},
+		Invasions:      []ProgressionItem{},
+		DeathsByCause:  []DeathCount{},
+		DeathsByPlayer: []DeathCount{},
+	}
+
+	// 世界文件是当前状态的依据，读取失败时使用最近的快照
+	var latest *model.ProgressionSnapshot
+	var last model.ProgressionSnapshot
+	if utils.DB.Where("room_id = ? AND world_name = ?", roomId, room.WorldName).Order("id DESC").Limit(1).Find(&last).RowsAffected > 0 {
+		latest = &last
+		progression.LastSnapshotAt = &last.CreatedAt
+	}
+
+	worldUID := ""
+	hardmode, bosses, invasions := false, []string{}, []string{}
+	path := filepath.Join(getRoomWorldsDir(roomId), worldFileName(room.WorldName))
+	if _, err := os.Stat(path); err == nil {
+		info, err := utils.ReadWorldFile(path)
+		progression.World, progression.WorldError = info, errorText(err)
+		if err == nil {
+			worldUID = info.UniqueID
+			hardmode, bosses, invasions = info.Hardmode, info.DownedBosses, info.Invasions
+		}
+	}
+	if progression.World == nil && latest != nil {
+		worldUID = latest.WorldUID
+		hardmode, bosses, invasions = latest.Hardmode, latest.DownedBosses, latest.Invasions
+	}
+	progression.Hardmode = hardmode
+
+	// 每个进度最早的事件即完成时间
+	first := make(map[string]*model.ProgressionEvent)
+	counts := make(map[string]int)
+	causes := make(map[string]int64)
+	players := make(map[string]int64)
+	for _, event := range s.worldEvents(roomId, room.WorldName, worldUID) {
+		if event.Kind == model.ProgressionEventDeath {
+			progression.TotalDeaths++
+			causes[event.Key]++
+			players[event.Player]++
+			continue
+		}
+		id := event.Kind + "|" + event.Key
+		if event.Source == model.ProgressionSourceLog {
+			counts[id]++
+		}
+		if first[id] == nil || event.OccurredAt.Before(first[id].OccurredAt) {
+			event := event
+			first[id] = &event
+		}
+	}
+
+	if event := first[model.ProgressionEventHardmode+"|hardmode"]; event != nil && hardmode {
+		progression.HardmodeAt = &event.OccurredAt
+	}
+	item := func(kind, key string, defeated bool) ProgressionItem {
+		id := kind + "|" + key
+		item := ProgressionItem{Key: key, Defeated: defeated, Count: counts[id]}
+		if event := first[id]; event != nil {
+			item.Defeated = true
+			item.DefeatedAt = &event.OccurredAt
+			item.Source = event.Source
+		}
+		return item
+	}
+	for _, boss := range utils.WorldBosses {
+		progression.Bosses = append(progression.Bosses, item(model.ProgressionEventBoss, boss, slices.Contains(bosses, boss)))
+		if progression.Bosses[len(progression.Bosses)-1].Defeated {
+			progression.DefeatedBosses++
+		}
+	}
+	for _, invasion := range utils.WorldInvasions {
+		progression.Invasions = append(progression.Invasions, item(model.ProgressionEventInvasion, invasion, slices.Contains(invasions, invasion)))
+	}
+
+	progression.DeathsByCause = sortDeathCounts(causes)
+	progression.DeathsByPlayer = sortDeathCounts(players)
+	return progression, nil
+}
+
+// GetTimeline 获取房间的进度快照和事件（从新到旧），world 为空时返回所有世界
+func (s *ProgressionService) GetTimeline(roomId uint, world string, limit int) (*ProgressionTimeline, error) {
+	if err := utils.DB.First(&model.Room{}, roomId).Error; err != nil {
+		return nil, errors.New("房间不存在")
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+
+	timeline := &ProgressionTimeline{Snapshots: []model.ProgressionSnapshot{}, Events: []model.ProgressionEvent{}}
+	snapshots := utils.DB.Where("room_id = ?", roomId)
+	events := utils.DB.Where("room_id = ?", roomId)
+	if world != "" {
+		snapshots = snapshots.Where("world_name = ?", world)
+		events = events.Where("world_name = ?", world)
+	}
+	if err := snapshots.Order("id DESC").Limit(limit).Find(&timeline.Snapshots).Error; err != nil {
+		return nil, err
+	}
+	if err := events.Order("occurred_at DESC, id DESC").Limit(limit).Find(&timeline.Events).Error; err != nil {
+		return nil, err
+	}
+	return timeline, nil
+}
+
+// Compare 对比多个房间当前世界的进度
+func (s *ProgressionService) Compare(roomIds []uint) ([]RoomProgression, error) {
+	if len(roomIds) == 0 {
+		return nil, errors.New("请指定要对比的房间")
+	}
+
+	result := []RoomProgression{}
+	for _, roomId := range roomIds {
+		progression, err := s.GetProgression(roomId)
+		if err != nil {
+			return nil, fmt.Errorf("房间 %d: %w", roomId, err)
+		}
+		result = append(result, *progression)
+	}
+	return result, nil
+}
+
+// worldEvents 房间某个世界的全部事件（包括世界ID未知的日志事件）
+func (s *ProgressionService) worldEvents(roomId uint, worldName, worldUID string) []model.ProgressionEvent {
+	var events []model.ProgressionEvent
+	utils.DB.Where("room_id = ? AND world_name = ? AND (world_uid = ? OR world_uid = '')", roomId, worldName, worldUID).
+		Order("occurred_at").Find(&events)
+	return events
+}
+
+// latestWorldUID 房间该世界最近一次快照中的世界ID
+func (s *ProgressionService) latestWorldUID(roomId uint, worldName string) string {
+	var uids []string
+	utils.DB.Model(&model.ProgressionSnapshot{}).Where("room_id = ? AND world_name = ?", roomId, worldName).
+		Order("id DESC").Limit(1).Pluck("world_uid", &uids)
+	if len(uids) == 0 {
+		return ""
+	}
+	return uids[0]
+}
+
+// sortDeathCounts 按次数从多到少排列
+func sortDeathCounts(counts map[string]int64) []DeathCount {
+	result := []DeathCount{}
+	for name, count := range counts {
+		result = append(result, DeathCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
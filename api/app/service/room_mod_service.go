@@ -0,0 +1,510 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/utils"
+	"time"
+)
+
+// RoomModService 房间Mod管理服务（tModLoader）
+type RoomModService struct{}
+
+// NewRoomModService 创建房间Mod服务
+func NewRoomModService() *RoomModService {
+	return &RoomModService{}
+}
+
+// RoomMod 房间Mods目录中的Mod
+type RoomMod struct {
+	Name              string    `json:"name"` // Mod内部名称（即文件名去掉 .tmod）
+	FileName          string    `json:"fileName"`
+	Size              int64     `json:"size"`
+	Modified          time.Time `json:"modified"`
+	Enabled           bool      `json:"enabled"`
+	DisplayName       string    `json:"displayName"`
+	Version           string    `json:"version"`
+	Author            string    `json:"author"`
+	TModLoaderVersion string    `json:"tModLoaderVersion"`
+	Side              string    `json:"side"`
+	Dependencies      []string  `json:"dependencies"`
+	Warnings          []string  `json:"warnings"`
+	ParseError        string    `json:"parseError"`
+	Source            string    `json:"source"`
+	SourceRef         string    `json:"sourceRef"`
+	LatestVersion     string    `json:"latestVersion"`
+	UpdateAvailable   bool      `json:"updateAvailable"`
+}
+
+// GetRoomMods 获取房间的Mod列表
+func (s *RoomModService) GetRoomMods(roomId uint) ([]RoomMod, error) {
+	room, err := s.getTModLoaderRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	modsDir := getRoomModsDir(roomId)
+	enabled, err := readEnabledMods(modsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// 以磁盘上的 enabled.json 为准同步数据库
+	if err := s.syncEnabledMods(room, enabled); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(modsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	enabledSet := make(map[string]bool)
+	for _, name := range enabled {
+		enabledSet[name] = true
+	}
+
+	var records []model.InstalledMod
+	utils.DB.Where("room_id = ?", roomId).Find(&records)
+	recordMap := make(map[string]model.InstalledMod)
+	for _, record := range records {
+		recordMap[record.Name] = record
+	}
+
+	mods := []RoomMod{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".tmod") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		mod := RoomMod{
+			Name:     name,
+			FileName: entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			Enabled:  enabledSet[name],
+		}
+		if record, ok := recordMap[name]; ok {
+			mod.Source = record.Source
+			mod.SourceRef = record.SourceRef
+			mod.LatestVersion = record.LatestVersion
+			mod.UpdateAvailable = record.UpdateAvailable
+		}
+		tmod, err := utils.ReadTmodFile(filepath.Join(modsDir, entry.Name()), false)
+		if err != nil {
+			mod.ParseError = err.Error()
+		} else {
+			fillRoomModInfo(&mod, tmod)
+			mod.Warnings, err = checkTModLoaderCompatibility(tmod, room.Version)
+			if err != nil {
+				mod.Warnings = append(mod.Warnings, err.Error())
+			}
+		}
+		mods = append(mods, mod)
+	}
+
+	// 检查已启用Mod的依赖是否存在
+	present := make(map[string]bool)
+	for _, mod := range mods {
+		present[mod.Name] = true
+	}
+	for i := range mods {
+		if !mods[i].Enabled {
+			continue
+		}
+		for _, dep := range mods[i].Dependencies {
+			if !present[dep] {
+				mods[i].Warnings = append(mods[i].Warnings, "缺少依赖Mod: "+dep)
+			} else if !enabledSet[dep] {
+				mods[i].Warnings = append(mods[i].Warnings, "依赖Mod未启用: "+dep)
+			}
+		}
+	}
+
+	sort.Slice(mods, func(i, j int) bool {
+		return strings.ToLower(mods[i].Name) < strings.ToLower(mods[j].Name)
+	})
+	return mods, nil
+}
+
+// UploadMod 上传Mod到房间
+// 会解析 .tmod 头部校验文件完整性，并以头部中的Mod名称保存
+func (s *RoomModService) UploadMod(roomId uint, fileHeader *multipart.FileHeader, enable bool) (*RoomMod, error) {
+	room, err := s.getTModLoaderRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(fileHeader.Filename), ".tmod") {
+		return nil, errors.New("只能上传 .tmod 文件")
+	}
+
+	modsDir := getRoomModsDir(roomId)
+	if err := os.MkdirAll(modsDir, 0755); err != nil {
+		return nil, err
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// 先写临时文件，校验通过后再替换
+	tmp, err := os.CreateTemp(modsDir, ".upload-*.tmod")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+
+	return s.installStagedMod(room, tmp.Name(), enable, model.ModSourceUpload, "")
+}
+
+// InstallModFromURL 从下载地址安装Mod到房间
+func (s *RoomModService) InstallModFromURL(roomId uint, url string, enable bool) (*RoomMod, error) {
+	room, err := s.getTModLoaderRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	modsDir := getRoomModsDir(roomId)
+	if err := os.MkdirAll(modsDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(modsDir, ".download-*.tmod")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := downloadPluginFile(url, tmp.Name(), ""); err != nil {
+		return nil, fmt.Errorf("下载Mod失败: %w", err)
+	}
+
+	return s.installStagedMod(room, tmp.Name(), enable, model.ModSourceURL, url)
+}
+
+// installStagedMod 校验Mods目录中的临时文件，并以头部中的Mod名称替换到位，同时记录来源
+func (s *RoomModService) installStagedMod(room *model.Room, stagedPath string, enable bool, source, sourceRef string) (*RoomMod, error) {
+	tmod, warnings, err := s.validateModFile(stagedPath, room)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, _, err := fileSHA256(stagedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(getRoomModsDir(room.ID), tmod.Name+".tmod")
+	if err := os.Rename(stagedPath, dest); err != nil {
+		return nil, err
+	}
+
+	if err := recordInstalledMod(room.ID, tmod.Name, tmod.Version, sum, source, sourceRef); err != nil {
+		return nil, err
+	}
+
+	if enable {
+		if err := s.setModEnabled(room, tmod.Name, true); err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		return nil, err
+	}
+	mod := &RoomMod{
+		Name:      tmod.Name,
+		FileName:  tmod.Name + ".tmod",
+		Size:      info.Size(),
+		Modified:  info.ModTime(),
+		Enabled:   enable,
+		Warnings:  warnings,
+		Source:    source,
+		SourceRef: sourceRef,
+	}
+	fillRoomModInfo(mod, tmod)
+	return mod, nil
+}
+
+// InstallWorkshopMod 从创意工坊缓存安装Mod到房间（未缓存时先下载）
+// 根据房间的tModLoader版本选择对应的构建
+func (s *RoomModService) InstallWorkshopMod(roomId uint, workshopId string, enable bool) (*RoomMod, error) {
+	room, err := s.getTModLoaderRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	workshop := NewWorkshopService()
+	item, err := workshop.EnsureDownloaded(workshopId)
+	if err != nil {
+		return nil, err
+	}
+	buildPath, _, err := workshop.SelectBuild(item, room.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	modsDir := getRoomModsDir(roomId)
+	if err := os.MkdirAll(modsDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(modsDir, ".workshop-*.tmod")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := copyFile(buildPath, tmp.Name()); err != nil {
+		return nil, err
+	}
+
+	return s.installStagedMod(room, tmp.Name(), enable, model.ModSourceWorkshop, workshopId)
+}
+
+// validateModFile 解析并校验Mod文件，返回兼容性警告
+func (s *RoomModService) validateModFile(path string, room *model.Room) (*utils.TmodFile, []string, error) {
+	tmod, err := utils.ReadTmodFile(path, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tmod.HashValid != nil && !*tmod.HashValid {
+		return nil, nil, errors.New("Mod文件哈希校验失败，文件可能已损坏")
+	}
+	if _, err := modBaseName(tmod.Name); err != nil {
+		return nil, nil, err
+	}
+
+	warnings, err := checkTModLoaderCompatibility(tmod, room.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tmod, warnings, nil
+}
+
+// ToggleMod 启用或禁用Mod
+func (s *RoomModService) ToggleMod(roomId uint, name string, enabled bool) error {
+	name, err := modBaseName(name)
+	if err != nil {
+		return err
+	}
+	room, err := s.getTModLoaderRoom(roomId)
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		if _, err := os.Stat(filepath.Join(getRoomModsDir(roomId), name+".tmod")); err != nil {
+			return errors.New("Mod文件不存在")
+		}
+	}
+
+	return s.setModEnabled(room, name, enabled)
+}
+
+// DeleteMod 删除Mod文件并从启用列表中移除
+func (s *RoomModService) DeleteMod(roomId uint, name string) error {
+	name, err := modBaseName(name)
+	if err != nil {
+		return err
+	}
+	room, err := s.getTModLoaderRoom(roomId)
+	if err != nil {
+		return err
+	}
+
+	modPath := filepath.Join(getRoomModsDir(roomId), name+".tmod")
+	if err := os.Remove(modPath); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("Mod文件不存在")
+		}
+		return err
+	}
+
+	utils.DB.Where("room_id = ? AND name = ?", roomId, name).Delete(&model.InstalledMod{})
+	return s.setModEnabled(room, name, false)
+}
+
+// modBaseName 校验Mod名称（不含 .tmod），名称同时用作文件名和 enabled.json 中的条目
+func modBaseName(name string) (string, error) {
+	if name == "" || name == "enabled" || strings.ContainsAny(name, `/\:*?"<>|`) || strings.Contains(name, "..") {
+		return "", errors.New("无效的Mod名称: " + name)
+	}
+	return name, nil
+}
+
+// setModEnabled 修改 enabled.json 并同步到数据库
+func (s *RoomModService) setModEnabled(room *model.Room, name string, enabled bool) error {
+	modsDir := getRoomModsDir(room.ID)
+	current, err := readEnabledMods(modsDir)
+	if err != nil {
+		return err
+	}
+
+	next := []string{}
+	for _, mod := range current {
+		if mod != name {
+			next = append(next, mod)
+		}
+	}
+	if enabled {
+		next = append(next, name)
+	}
+
+	if err := writeEnabledMods(modsDir, next); err != nil {
+		return err
+	}
+	return s.syncEnabledMods(room, next)
+}
+
+// syncEnabledMods 将启用列表写入 TModLoaderConfig.EnabledMods
+func (s *RoomModService) syncEnabledMods(room *model.Room, enabled []string) error {
+	content, err := json.Marshal(enabled)
+	if err != nil {
+		return err
+	}
+
+	var config model.TModLoaderConfig
+	if err := utils.DB.Where("room_id = ?", room.ID).First(&config).Error; err != nil {
+		config = model.TModLoaderConfig{RoomID: room.ID}
+	}
+	if config.ID != 0 && config.EnabledMods == string(content) {
+		return nil
+	}
+	config.EnabledMods = string(content)
+	return utils.DB.Save(&config).Error
+}
+
+// getTModLoaderRoom 获取房间并确认是tModLoader服务器
+func (s *RoomModService) getTModLoaderRoom(roomId uint) (*model.Room, error) {
+	var room model.Room
+	if err := utils.DB.First(&room, roomId).Error; err != nil {
+		return nil, errors.New("房间不存在")
+	}
+	if room.Type != model.ServerTypeTModLoader {
+		return nil, errors.New("此房间不是tModLoader服务器")
+	}
+	return &room, nil
+}
+
+// getRoomModsDir 获取房间的Mods目录
+func getRoomModsDir(roomId uint) string {
+	return filepath.Join(getRoomDir(roomId), "Mods")
+}
+
+// readEnabledMods 读取 tModLoader 的 enabled.json，文件不存在时返回空列表
+func readEnabledMods(modsDir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(modsDir, "enabled.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	var enabled []string
+	if err := json.Unmarshal(content, &enabled); err != nil {
+		return nil, errors.New("enabled.json 格式错误")
+	}
+	if enabled == nil {
+		enabled = []string{}
+	}
+	return enabled, nil
+}
+
+// writeEnabledMods 重新生成 enabled.json
+func writeEnabledMods(modsDir string, enabled []string) error {
+	content, err := json.MarshalIndent(enabled, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(modsDir, "enabled.json"), content, 0644)
+}
+
+// fillRoomModInfo 用 .tmod 头部信息填充列表项
+func fillRoomModInfo(mod *RoomMod, tmod *utils.TmodFile) {
+	mod.Version = tmod.Version
+	mod.TModLoaderVersion = tmod.TModLoaderVersion
+	mod.DisplayName = tmod.Name
+	mod.Side = "Both"
+	mod.Dependencies = []string{}
+	if tmod.Info != nil {
+		if tmod.Info.DisplayName != "" {
+			mod.DisplayName = tmod.Info.DisplayName
+		}
+		mod.Author = tmod.Info.Author
+		mod.Side = tmod.Info.Side
+		for _, ref := range tmod.Info.ModReferences {
+			mod.Dependencies = append(mod.Dependencies, ref.Name)
+		}
+	}
+}
+
+// checkTModLoaderCompatibility 检查Mod构建所用的tModLoader版本与房间是否兼容
+// 1.3/1.4 跨代或Mod构建版本高于房间时返回错误，月份版本不同时返回警告
+func checkTModLoaderCompatibility(tmod *utils.TmodFile, roomVersion string) ([]string, error) {
+	warnings := []string{}
+	if roomVersion == "" {
+		return append(warnings, "房间未记录tModLoader版本，已跳过版本兼容性检查"), nil
+	}
+
+	roomLegacy := utils.CompareVersions(roomVersion, "1.0") < 0
+	if tmod.IsLegacy() != roomLegacy {
+		return nil, fmt.Errorf("该Mod为 tModLoader %s 构建，与房间的 tModLoader %s 不兼容", tmod.TModLoaderVersion, roomVersion)
+	}
+
+	modRelease := majorMinorVersion(tmod.TModLoaderVersion)
+	roomRelease := majorMinorVersion(roomVersion)
+	switch c := utils.CompareVersions(modRelease, roomRelease); {
+	case c > 0:
+		return nil, fmt.Errorf("该Mod需要 tModLoader %s 或更高版本，房间当前为 %s", tmod.TModLoaderVersion, roomVersion)
+	case c < 0:
+		warnings = append(warnings, fmt.Sprintf("该Mod为 tModLoader %s 构建，房间当前为 %s，可能存在兼容问题", tmod.TModLoaderVersion, roomVersion))
+	}
+	return warnings, nil
+}
+
+// majorMinorVersion 取版本号的前两段（tModLoader 为 年.月）
+func majorMinorVersion(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, ".")
+}
+
+// recordInstalledMod 记录（或更新）已安装Mod的来源与版本
+func recordInstalledMod(roomId uint, name, version, sum, source, sourceRef string) error {
+	var record model.InstalledMod
+	utils.DB.Where("room_id = ? AND name = ?", roomId, name).First(&record)
+	record.RoomID = roomId
+	record.Name = name
+	record.Version = version
+	record.SHA256 = sum
+	record.Source = source
+	record.SourceRef = sourceRef
+	if record.LatestVersion == "" || utils.CompareVersions(version, record.LatestVersion) >= 0 {
+		record.LatestVersion = version
+	}
+	record.UpdateAvailable = utils.CompareVersions(record.LatestVersion, version) > 0
+	return utils.DB.Save(&record).Error
+}
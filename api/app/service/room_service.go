@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"terraria-api/app/model"
 	"terraria-api/utils"
 )
@@ -21,14 +23,14 @@ func NewRoomService() *RoomService {
 // GetAllRooms 获取所有房间
 func (rs *RoomService) GetAllRooms() ([]model.Room, error) {
 	var rooms []model.Room
-	result := utils.DB.Preload("WorldConfig").Preload("TShockConfig").Preload("TModLoaderConfig").Find(&rooms)
+	result := utils.DB.Preload("WorldConfig").Preload("TShockConfig").Preload("TModLoaderConfig").Preload("Installation").Find(&rooms)
 	return rooms, result.Error
 }
 
 // GetRoomByID 根据ID获取房间
 func (rs *RoomService) GetRoomByID(id uint) (*model.Room, error) {
 	var room model.Room
-	result := utils.DB.Preload("WorldConfig").Preload("TShockConfig").Preload("TModLoaderConfig").First(&room, id)
+	result := utils.DB.Preload("WorldConfig").Preload("TShockConfig").Preload("TModLoaderConfig").Preload("Installation").First(&room, id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -41,6 +43,11 @@ func (rs *RoomService) CreateRoom(room *model.Room) (*model.Room, error) {
 	room.Status = model.StatusStopped
 	room.CurrentPlayers = 0
 
+	// 绑定服务端安装，未指定时使用该类型最新的已安装版本
+	if err := rs.bindInstallation(room); err != nil {
+		return nil, err
+	}
+
 	// 创建房间
 	if err := utils.DB.Create(room).Error; err != nil {
 		return nil, err
@@ -75,7 +82,25 @@ func (rs *RoomService) CreateRoom(room *model.Room) (*model.Room, error) {
 
 // UpdateRoom 更新房间
 func (rs *RoomService) UpdateRoom(room *model.Room) (*model.Room, error) {
-	if err := utils.DB.Save(room).Error; err != nil {
+	existing, err := rs.GetRoomByID(room.ID)
+	if err != nil {
+		return nil, err
+	}
+	// 未指定安装时保留原来的绑定；更换安装或类型需要先停止服务器
+	if room.InstallationID == nil && room.Type == existing.Type {
+		room.InstallationID = existing.InstallationID
+	}
+	changed := !sameInstallation(room.InstallationID, existing.InstallationID) || room.Type != existing.Type
+	if changed && existing.Status == model.StatusRunning {
+		return nil, errors.New("请先停止服务器再更换服务端")
+	}
+	if changed || room.InstallationID != nil {
+		if err := rs.bindInstallation(room); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := utils.DB.Omit("Installation").Save(room).Error; err != nil {
 		return nil, err
 	}
 	return room, nil
@@ -100,11 +125,56 @@ func (rs *RoomService) DeleteRoom(id uint) error {
 	utils.DB.Where("room_id = ?", id).Delete(&model.TShockConfig{})
 	utils.DB.Where("room_id = ?", id).Delete(&model.TModLoaderConfig{})
 	utils.DB.Where("room_id = ?", id).Delete(&model.Player{})
+	utils.DB.Where("room_id = ?", id).Delete(&model.RoomPlugin{})
+	utils.DB.Where("room_id = ?", id).Delete(&model.InstalledMod{})
+	utils.DB.Where("room_id = ?", id).Delete(&model.ConfigRevision{})
+	utils.DB.Where("room_id = ?", id).Delete(&model.RoomUpgrade{})
+	utils.DB.Where("room_id = ?", id).Delete(&model.ProgressionSnapshot{})
+	utils.DB.Where("room_id = ?", id).Delete(&model.ProgressionEvent{})
+	utils.DB.Where("room_id = ?", id).Delete(&model.BackupSchedule{})
+	if err := NewBackupService().DeleteRoomBackups(id); err != nil {
+		log.Printf("⚠️ 删除房间 %d 的备份失败: %v", id, err)
+	}
 
 	// 删除房间
 	return utils.DB.Delete(&model.Room{}, id).Error
 }
 
+// bindInstallation 校验房间引用的安装并同步版本号
+func (rs *RoomService) bindInstallation(room *model.Room) error {
+	installations := NewInstallationService()
+
+	var installation *model.Installation
+	if room.InstallationID != nil {
+		var err error
+		if installation, err = installations.Get(*room.InstallationID); err != nil {
+			return err
+		}
+		if installation.Type != room.Type {
+			return fmt.Errorf("服务端类型不匹配: 房间为 %s，安装为 %s", room.Type, installation.Type)
+		}
+	} else {
+		installation = installations.Latest(room.Type)
+	}
+
+	if installation == nil {
+		room.InstallationID = nil
+		return nil
+	}
+	room.InstallationID = &installation.ID
+	room.Installation = installation
+	room.Version = installation.Version
+	return nil
+}
+
+// sameInstallation 判断两个安装引用是否相同
+func sameInstallation(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 // IsPortInUse 检查端口是否被占用
 func (rs *RoomService) IsPortInUse(port int) bool {
 	var count int64
@@ -123,47 +193,87 @@ func (rs *RoomService) StartServer(id uint) error {
 		return errors.New("服务器已在运行中")
 	}
 
+	// 旧房间可能还没有绑定安装，使用该类型最新的已安装版本
+	if room.InstallationID == nil {
+		if err := rs.bindInstallation(room); err != nil {
+			return err
+		}
+		utils.DB.Model(&model.Room{}).Where("id = ?", room.ID).Updates(map[string]interface{}{
+			"installation_id": room.InstallationID,
+			"version":         room.Version,
+		})
+	}
+
+	// 根据服务器类型生成启动命令，缺少安装或运行时时直接返回错误
+	var cmd *exec.Cmd
+	switch room.Type {
+	case model.ServerTypeVanilla:
+		cmd, err = rs.startVanillaServer(room)
+	case model.ServerTypeTShock:
+		cmd, err = rs.startTShockServer(room)
+	case model.ServerTypeTModLoader:
+		cmd, err = rs.startTModLoaderServer(room)
+	default:
+		err = fmt.Errorf("不支持的服务器类型: %s", room.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 保持标准输入打开，服务端在控制台读到 EOF 时会异常
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	logFile, err := openServerLog(room.ID)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
 	// 更新状态为启动中
 	room.Status = model.StatusStarting
 	utils.DB.Save(room)
 
-	// 根据服务器类型启动
 	go func() {
-		var cmd *exec.Cmd
-		switch room.Type {
-		case model.ServerTypeVanilla:
-			cmd = rs.startVanillaServer(room)
-		case model.ServerTypeTShock:
-			cmd = rs.startTShockServer(room)
-		case model.ServerTypeTModLoader:
-			cmd = rs.startTModLoaderServer(room)
-		}
-
-		if cmd != nil {
-			// 启动进程
-			if err := cmd.Start(); err != nil {
-				log.Printf("❌ 启动服务器失败: %v", err)
-				room.Status = model.StatusError
-				utils.DB.Save(room)
-				return
-			}
-
-			// 保存进程PID
-			room.ProcessPID = cmd.Process.Pid
-			room.Status = model.StatusRunning
-			utils.DB.Save(room)
-
-			log.Printf("✅ 房间 %s (ID:%d) 启动成功, PID: %d", room.Name, room.ID, cmd.Process.Pid)
+		defer logFile.Close()
 
-			// 等待进程结束
-			cmd.Wait()
+		// 启动进程
+		if err := cmd.Start(); err != nil {
+			log.Printf("❌ 启动服务器失败: %v", err)
+			utils.DB.Model(&model.Room{}).Where("id = ?", room.ID).Update("status", model.StatusError)
+			return
+		}
+		roomProcesses.Store(room.ID, &roomProcess{cmd: cmd, stdin: stdin})
+
+		// 保存进程PID
+		room.ProcessPID = cmd.Process.Pid
+		room.Status = model.StatusRunning
+		utils.DB.Model(&model.Room{}).Where("id = ?", room.ID).Updates(map[string]interface{}{
+			"status":       room.Status,
+			"process_p_id": room.ProcessPID,
+		})
+
+		log.Printf("✅ 房间 %s (ID:%d) 启动成功, PID: %d", room.Name, room.ID, cmd.Process.Pid)
+
+		// 等待进程结束
+		cmd.Wait()
+		if p, ok := roomProcesses.Load(room.ID); ok && p.(*roomProcess).cmd == cmd {
+			roomProcesses.Delete(room.ID)
+		}
 
-			// 进程结束后更新状态
-			room.Status = model.StatusStopped
-			room.ProcessPID = 0
-			room.CurrentPlayers = 0
-			utils.DB.Save(room)
-			log.Printf("⚠️ 房间 %s (ID:%d) 已停止", room.Name, room.ID)
+		// 进程结束后更新状态（只更新运行状态，避免覆盖期间对房间的其他修改）
+		utils.DB.Model(&model.Room{}).Where("id = ? AND process_p_id = ?", room.ID, cmd.Process.Pid).Updates(map[string]interface{}{
+			"status":          model.StatusStopped,
+			"process_p_id":    0,
+			"current_players": 0,
+		})
+		log.Printf("⚠️ 房间 %s (ID:%d) 已停止", room.Name, room.ID)
+
+		// 服务端退出时会保存世界，记录一次进度快照
+		if _, err := NewProgressionService().Capture(room.ID, model.ProgressionTriggerStop); err != nil {
+			log.Printf("⚠️ 记录房间 %d 的进度快照失败: %v", room.ID, err)
 		}
 	}()
 
@@ -238,25 +348,49 @@ func (rs *RoomService) GetServerStatus(id uint) (map[string]interface{}, error)
 }
 
 // startVanillaServer 启动原版服务器
-func (rs *RoomService) startVanillaServer(room *model.Room) *exec.Cmd {
-	// TODO: 实现原版服务器启动逻辑
-	// 示例: ./TerrariaServer.exe -port 7777 -world World.wld -players 8
+func (rs *RoomService) startVanillaServer(room *model.Room) (*exec.Cmd, error) {
 	log.Printf("🚀 准备启动原版服务器: %s", room.Name)
-	return nil
+	configPath, err := writeServerConfig(room)
+	if err != nil {
+		return nil, err
+	}
+	return serverCommand(room, "-config", configPath)
 }
 
 // startTShockServer 启动TShock服务器
-func (rs *RoomService) startTShockServer(room *model.Room) *exec.Cmd {
-	// TODO: 实现TShock服务器启动逻辑
-	// 示例: ./TShock.Server.exe -port 7777 -world World.wld -players 8
+// TShock 的 tshock 配置目录和 ServerPlugins 都相对工作目录（房间目录）
+func (rs *RoomService) startTShockServer(room *model.Room) (*exec.Cmd, error) {
 	log.Printf("🚀 准备启动TShock服务器: %s", room.Name)
-	return nil
+	configPath, err := writeServerConfig(room)
+	if err != nil {
+		return nil, err
+	}
+	// TShock 会用 config.json 中的端口和人数覆盖 serverconfig，命令行参数优先
+	return serverCommand(room, "-config", configPath,
+		"-port", strconv.Itoa(room.Port), "-maxplayers", strconv.Itoa(max(room.MaxPlayers, 1)))
 }
 
 // startTModLoaderServer 启动TModLoader服务器
-func (rs *RoomService) startTModLoaderServer(room *model.Room) *exec.Cmd {
-	// TODO: 实现TModLoader服务器启动逻辑
-	// 示例: ./tModLoaderServer.exe -port 7777 -world World.wld -players 8
+// Mods、ModConfigs 和世界都保存在房间目录中
+func (rs *RoomService) startTModLoaderServer(room *model.Room) (*exec.Cmd, error) {
 	log.Printf("🚀 准备启动TModLoader服务器: %s", room.Name)
-	return nil
+	configPath, err := writeServerConfig(room)
+	if err != nil {
+		return nil, err
+	}
+	roomDir, err := filepath.Abs(getRoomDir(room.ID))
+	if err != nil {
+		return nil, err
+	}
+	if room.Installation != nil && room.Installation.Runtime == model.RuntimeDotnet {
+		// tModLoader 1.4
+		return serverCommand(room, "-server", "-config", configPath, "-tmlsavedirectory", roomDir)
+	}
+	// tModLoader 1.3
+	return serverCommand(room, "-config", configPath, "-modpath", filepath.Join(roomDir, "Mods"))
+}
+
+// getRoomDir 获取房间的服务器目录
+func getRoomDir(roomId uint) string {
+	return filepath.Join("./servers", fmt.Sprintf("room_%d", roomId))
 }
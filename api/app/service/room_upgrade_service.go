@@ -0,0 +1,503 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// 升级后健康检查的时长，声明为变量便于调整
+var (
+	// 等待服务器启动并开始监听端口的最长时间
+	upgradeBootTimeout = 3 * time.Minute
+	// 启动成功后需要持续运行的时间
+	upgradeStableDuration = 30 * time.Second
+	// 状态轮询间隔
+	upgradePollInterval = 2 * time.Second
+	// 升级失败时附带的服务端日志行数
+	upgradeLogTailLines = 10
+)
+
+// 每个房间保留的升级快照数
+const maxUpgradeSnapshots = 3
+
+// 升级步骤
+const (
+	upgradeStepStopping    = "stopping"
+	upgradeStepSnapshot    = "snapshot"
+	upgradeStepSwitching   = "switching"
+	upgradeStepMigrating   = "migrating"
+	upgradeStepStarting    = "starting"
+	upgradeStepChecking    = "health_check"
+	upgradeStepRollingBack = "rolling_back"
+	upgradeStepDone        = "done"
+)
+
+// RoomUpgradeService 房间服务端版本升级
+// 升级在后台进行：停止房间、快照房间目录、切换安装、迁移配置、启动并检查，失败时自动回滚
+type RoomUpgradeService struct{}
+
+var (
+	// 正在升级的房间
+	upgradingRooms   = make(map[uint]bool)
+	upgradingRoomsMu sync.Mutex
+)
+
+// NewRoomUpgradeService 创建房间升级服务
+func NewRoomUpgradeService() *RoomUpgradeService {
+	return &RoomUpgradeService{}
+}
+
+// StartUpgrade 校验并开始升级，立即返回升级记录
+func (s *RoomUpgradeService) StartUpgrade(roomId, installationId uint) (*model.RoomUpgrade, error) {
+	room, err := NewRoomService().GetRoomByID(roomId)
+	if err != nil {
+		return nil, errors.New("房间不存在")
+	}
+	target, err := NewInstallationService().Get(installationId)
+	if err != nil {
+		return nil, err
+	}
+	if target.Type != room.Type {
+		return nil, fmt.Errorf("服务端类型不匹配: 房间为 %s，安装为 %s", room.Type, target.Type)
+	}
+	if room.InstallationID != nil && *room.InstallationID == target.ID {
+		return nil, errors.New("房间已经在使用该版本")
+	}
+	if room.Version != "" && utils.CompareVersions(target.Version, room.Version) <= 0 {
+		return nil, fmt.Errorf("只能升级到更新的版本（当前 %s，目标 %s）", room.Version, target.Version)
+	}
+	if room.Status == model.StatusStarting || room.Status == model.StatusStopping {
+		return nil, errors.New("服务器正在启动或停止，请稍后再试")
+	}
+
+	upgradingRoomsMu.Lock()
+	if upgradingRooms[roomId] {
+		upgradingRoomsMu.Unlock()
+		return nil, errors.New("该房间正在升级中")
+	}
+	upgradingRooms[roomId] = true
+	upgradingRoomsMu.Unlock()
+
+	upgrade := &model.RoomUpgrade{
+		RoomID:             roomId,
+		FromInstallationID: room.InstallationID,
+		ToInstallationID:   target.ID,
+		FromVersion:        room.Version,
+		ToVersion:          target.Version,
+		State:              model.UpgradeStateRunning,
+		Step:               upgradeStepStopping,
+		Warnings:           []string{},
+	}
+	if err := utils.DB.Create(upgrade).Error; err != nil {
+		s.release(roomId)
+		return nil, err
+	}
+
+	go s.run(upgrade, room, target)
+	return upgrade, nil
+}
+
+// GetUpgrades 获取房间的升级记录（从新到旧）
+func (s *RoomUpgradeService) GetUpgrades(roomId uint) ([]model.RoomUpgrade, error) {
+	var upgrades []model.RoomUpgrade
+	err := utils.DB.Where("room_id = ?", roomId).Order("id desc").Find(&upgrades).Error
+	return upgrades, err
+}
+
+// GetUpgrade 获取一条升级记录
+func (s *RoomUpgradeService) GetUpgrade(roomId, upgradeId uint) (*model.RoomUpgrade, error) {
+	var upgrade model.RoomUpgrade
+	if err := utils.DB.Where("room_id = ?", roomId).First(&upgrade, upgradeId).Error; err != nil {
+		return nil, errors.New("升级记录不存在")
+	}
+	return &upgrade, nil
+}
+
+// run 执行升级，失败时回滚
+func (s *RoomUpgradeService) run(upgrade *model.RoomUpgrade, room *model.Room, target *model.Installation) {
+	defer s.release(room.ID)
+
+	wasRunning := room.Status == model.StatusRunning
+	snapshotDir := filepath.Join(config.GlobalConfig.DataPath, "upgrades", fmt.Sprintf("room_%d", room.ID), fmt.Sprintf("%d", upgrade.ID))
+	switched := false
+	logOffset := int64(-1) // 启动新版本前服务端日志的大小，用于取出本次启动的日志
+
+	err := func() error {
+		if wasRunning {
+			// 先保存世界，再等进程退出后创建快照，避免丢失进度或快照不完整
+			if _, err := saveRunningWorld(room, backupSaveTimeout); err != nil {
+				upgrade.Warnings = append(upgrade.Warnings, "停止前保存世界失败，快照为最近一次保存的世界: "+err.Error())
+			}
+			if err := NewRoomService().StopServer(room.ID); err != nil {
+				return fmt.Errorf("停止服务器失败: %w", err)
+			}
+			waitProcessExit(room.ID, restoreStopTimeout)
+		}
+
+		s.step(upgrade, upgradeStepSnapshot)
+		if err := os.RemoveAll(snapshotDir); err != nil {
+			return err
+		}
+		if err := copyDirFiltered(getRoomDir(room.ID), snapshotDir, isUpgradeSnapshotFile); err != nil {
+			return fmt.Errorf("创建快照失败: %w", err)
+		}
+		upgrade.SnapshotPath = snapshotDir
+		utils.DB.Save(upgrade)
+
+		s.step(upgrade, upgradeStepSwitching)
+		if err := s.switchInstallation(room.ID, &target.ID, target.Version); err != nil {
+			return fmt.Errorf("切换版本失败: %w", err)
+		}
+		switched = true
+
+		s.step(upgrade, upgradeStepMigrating)
+		warnings, err := migrateRoomConfig(room, upgrade.FromVersion, target.Version)
+		upgrade.Warnings = append(upgrade.Warnings, warnings...)
+		if err != nil {
+			return fmt.Errorf("迁移配置失败: %w", err)
+		}
+
+		s.step(upgrade, upgradeStepStarting)
+		logOffset = roomLogSize(room.ID)
+		if err := NewRoomService().StartServer(room.ID); err != nil {
+			return fmt.Errorf("启动服务器失败: %w", err)
+		}
+
+		s.step(upgrade, upgradeStepChecking)
+		if err := s.waitHealthy(room.ID, room.Port); err != nil {
+			return err
+		}
+
+		// 升级前没有运行的房间，检查通过后恢复为停止状态
+		if !wasRunning {
+			if err := NewRoomService().StopServer(room.ID); err != nil {
+				upgrade.Warnings = append(upgrade.Warnings, "升级后停止服务器失败: "+err.Error())
+			}
+			waitProcessExit(room.ID, restoreStopTimeout)
+		}
+		return nil
+	}()
+
+	now := time.Now()
+	upgrade.FinishedAt = &now
+	if err == nil {
+		upgrade.State = model.UpgradeStateSucceeded
+		upgrade.Step = upgradeStepDone
+		utils.DB.Save(upgrade)
+		s.pruneSnapshots(room.ID)
+		log.Printf("✅ 房间 %s (ID:%d) 已升级到 %s %s", room.Name, room.ID, target.Type, target.Version)
+		return
+	}
+
+	upgrade.Error = err.Error()
+	if logOffset >= 0 {
+		if tail := roomLogTail(room.ID, logOffset, upgradeLogTailLines); tail != "" {
+			upgrade.Error += "；服务器日志: " + tail
+		}
+	}
+	log.Printf("❌ 房间 %s (ID:%d) 升级失败，开始回滚: %v", room.Name, room.ID, err)
+	s.step(upgrade, upgradeStepRollingBack)
+	if rollbackErr := s.rollback(upgrade, room, wasRunning, switched); rollbackErr != nil {
+		upgrade.State = model.UpgradeStateFailed
+		upgrade.Error += "；回滚失败: " + rollbackErr.Error()
+		log.Printf("❌ 房间 %d 回滚失败: %v", room.ID, rollbackErr)
+	} else {
+		upgrade.State = model.UpgradeStateRolledBack
+		log.Printf("⚠️ 房间 %d 已回滚到 %s", room.ID, upgrade.FromVersion)
+		// 快照已恢复到房间目录，不再需要保留；回滚失败时保留快照用于手动恢复
+		if upgrade.SnapshotPath != "" {
+			if err := os.RemoveAll(upgrade.SnapshotPath); err != nil {
+				log.Printf("⚠️ 删除升级快照失败: %v", err)
+			} else {
+				upgrade.SnapshotPath = ""
+			}
+		}
+	}
+	upgrade.Step = upgradeStepDone
+	utils.DB.Save(upgrade)
+	s.pruneSnapshots(room.ID)
+}
+
+// rollback 停止服务器，恢复快照和原来的安装，并恢复原来的运行状态
+func (s *RoomUpgradeService) rollback(upgrade *model.RoomUpgrade, room *model.Room, wasRunning, switched bool) error {
+	if current, err := NewRoomService().GetRoomByID(room.ID); err == nil && current.Status == model.StatusRunning {
+		if err := NewRoomService().StopServer(room.ID); err != nil {
+			return fmt.Errorf("停止服务器失败: %w", err)
+		}
+	}
+	// 进程退出后再恢复快照，避免被仍在写入的进程覆盖
+	waitProcessExit(room.ID, restoreStopTimeout)
+	// 启动失败的进程可能仍停留在启动中状态
+	utils.DB.Model(&model.Room{}).Where("id = ? AND status = ?", room.ID, model.StatusStarting).
+		Updates(map[string]interface{}{"status": model.StatusStopped, "process_p_id": 0})
+
+	if upgrade.SnapshotPath != "" {
+		roomDir := getRoomDir(room.ID)
+		entries, err := os.ReadDir(roomDir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, entry := range entries {
+			if !isUpgradeSnapshotFile(entry.Name() + "/") {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(roomDir, entry.Name())); err != nil {
+				return err
+			}
+		}
+		if err := copyDirFiltered(upgrade.SnapshotPath, roomDir, nil); err != nil {
+			return fmt.Errorf("恢复快照失败: %w", err)
+		}
+	}
+
+	if switched {
+		if err := s.switchInstallation(room.ID, upgrade.FromInstallationID, upgrade.FromVersion); err != nil {
+			return fmt.Errorf("恢复版本失败: %w", err)
+		}
+	}
+
+	if wasRunning {
+		if err := NewRoomService().StartServer(room.ID); err != nil {
+			return fmt.Errorf("重新启动服务器失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// waitHealthy 等待服务器启动并监听端口，然后确认在一段时间内保持运行
+func (s *RoomUpgradeService) waitHealthy(roomId uint, port int) error {
+	deadline := time.Now().Add(upgradeBootTimeout)
+	var bootedAt time.Time
+	var pid int
+
+	for {
+		room, err := NewRoomService().GetRoomByID(roomId)
+		if err != nil {
+			return err
+		}
+
+		switch room.Status {
+		case model.StatusStopped, model.StatusError:
+			if bootedAt.IsZero() {
+				return errors.New("服务器启动失败")
+			}
+			return errors.New("服务器启动后崩溃")
+		case model.StatusRunning:
+			if bootedAt.IsZero() {
+				if isPortListening(port) {
+					bootedAt, pid = time.Now(), room.ProcessPID
+				}
+			} else if room.ProcessPID != pid {
+				return errors.New("服务器启动后崩溃并被重启")
+			} else if time.Since(bootedAt) >= upgradeStableDuration {
+				return nil
+			}
+		}
+
+		if bootedAt.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("服务器在 %s 内没有完成启动", upgradeBootTimeout)
+		}
+		time.Sleep(upgradePollInterval)
+	}
+}
+
+// switchInstallation 更新房间绑定的安装和版本号
+func (s *RoomUpgradeService) switchInstallation(roomId uint, installationId *uint, version string) error {
+	return utils.DB.Model(&model.Room{}).Where("id = ?", roomId).
+		Updates(map[string]interface{}{"installation_id": installationId, "version": version}).Error
+}
+
+// step 更新当前步骤
+func (s *RoomUpgradeService) step(upgrade *model.RoomUpgrade, step string) {
+	upgrade.Step = step
+	utils.DB.Save(upgrade)
+}
+
+// release 解除房间的升级锁
+func (s *RoomUpgradeService) release(roomId uint) {
+	upgradingRoomsMu.Lock()
+	delete(upgradingRooms, roomId)
+	upgradingRoomsMu.Unlock()
+}
+
+// pruneSnapshots 只保留最近几次升级的快照
+func (s *RoomUpgradeService) pruneSnapshots(roomId uint) {
+	var upgrades []model.RoomUpgrade
+	utils.DB.Where("room_id = ? AND snapshot_path <> ''", roomId).Order("id desc").Find(&upgrades)
+	for i, upgrade := range upgrades {
+		if i < maxUpgradeSnapshots {
+			continue
+		}
+		if err := os.RemoveAll(upgrade.SnapshotPath); err != nil {
+			log.Printf("⚠️ 删除升级快照失败: %v", err)
+			continue
+		}
+		utils.DB.Model(&upgrade).Update("snapshot_path", "")
+	}
+}
+
+// isUpgradeSnapshotFile 快照中不包含Mod更新时产生的备份和服务端日志
+// 回滚时这些目录保持不变，保留升级失败时的启动日志
+func isUpgradeSnapshotFile(rel string) bool {
+	return !strings.HasPrefix(rel, "ModBackups/") && !strings.HasPrefix(rel, "logs/")
+}
+
+// roomLogSize 房间服务端日志的当前大小，不存在时为 0
+func roomLogSize(roomId uint) int64 {
+	info, err := os.Stat(filepath.Join(getRoomDir(roomId), "logs", "server.log"))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// roomLogTail 读取服务端日志中 offset 之后的最后几行（最多读取 64KB）
+func roomLogTail(roomId uint, offset int64, n int) string {
+	f, err := os.Open(filepath.Join(getRoomDir(roomId), "logs", "server.log"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() <= offset {
+		return ""
+	}
+	if start := info.Size() - 64*1024; start > offset {
+		offset = start
+	}
+	content := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(content, offset); err != nil && err != io.EOF {
+		return ""
+	}
+	return lastLines(string(content), n)
+}
+
+// isPortListening 检查本机端口是否已在监听
+func isPortListening(port int) bool {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 2*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// migrateRoomConfig 按服务端类型迁移已知的配置变化，返回需要用户注意的问题
+func migrateRoomConfig(room *model.Room, fromVersion, toVersion string) ([]string, error) {
+	switch room.Type {
+	case model.ServerTypeTShock:
+		return migrateTShockConfig(room.ID, fromVersion, toVersion)
+	case model.ServerTypeTModLoader:
+		return migrateTModLoaderConfig(room.ID, fromVersion, toVersion)
+	}
+	return nil, nil
+}
+
+// TShock 4.5 起 config.json 和 sscconfig.json 的设置项移到了 Settings 对象中
+var tshockSettingsFiles = []string{"config.json", "sscconfig.json"}
+
+// tshockSettingsVersion 引入 Settings 对象的 TShock 版本
+const tshockSettingsVersion = "4.5"
+
+// migrateTShockConfig 迁移 TShock 配置，并检查已安装插件的兼容性
+func migrateTShockConfig(roomId uint, fromVersion, toVersion string) ([]string, error) {
+	var warnings []string
+	tshockDir := filepath.Join(getRoomDir(roomId), "tshock")
+
+	if utils.CompareVersions(fromVersion, tshockSettingsVersion) < 0 && utils.CompareVersions(toVersion, tshockSettingsVersion) >= 0 {
+		for _, name := range tshockSettingsFiles {
+			path := filepath.Join(tshockDir, name)
+			content, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return warnings, err
+			}
+
+			var settings map[string]interface{}
+			if err := json.Unmarshal(content, &settings); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s 格式错误，未迁移: %v", name, err))
+				continue
+			}
+			if _, ok := settings["Settings"]; ok {
+				continue
+			}
+
+			migrated, err := json.MarshalIndent(map[string]interface{}{"Settings": settings}, "", "  ")
+			if err != nil {
+				return warnings, err
+			}
+			if err := writeFileAtomic(path, migrated, 0644); err != nil {
+				return warnings, err
+			}
+			warnings = append(warnings, fmt.Sprintf("%s 已转换为 TShock 4.5 起的格式（设置项移到 Settings 中），TShock 会在启动时补全新增的设置项", name))
+		}
+	}
+	// 4.x 到 5.x 的设置项变化没有可靠的对照表，不做自动迁移
+	if versionMajor(fromVersion) < 5 && versionMajor(toVersion) >= 5 {
+		warnings = append(warnings, fmt.Sprintf("TShock %s → %s 没有自动迁移设置项：新增的设置项会在启动时使用默认值，已移除的设置项会被忽略，请检查 tshock/config.json", fromVersion, toVersion))
+	}
+
+	// 检查插件在新版本上的兼容性
+	var plugins []model.RoomPlugin
+	utils.DB.Where("room_id = ?", roomId).Find(&plugins)
+	if len(plugins) == 0 {
+		return warnings, nil
+	}
+	registry, err := NewPluginRegistryService().GetRegistry()
+	if err != nil {
+		warnings = append(warnings, "无法加载插件注册表，未检查插件兼容性: "+err.Error())
+		return warnings, nil
+	}
+	for _, installed := range plugins {
+		for _, plugin := range registry.Plugins {
+			if !strings.EqualFold(plugin.ID, installed.PluginID) {
+				continue
+			}
+			for _, v := range plugin.Versions {
+				if v.Version == installed.Version && !v.SupportsTShock(toVersion) {
+					warnings = append(warnings, fmt.Sprintf("插件 %s %s 不兼容 TShock %s，请更新或卸载", installed.Name, installed.Version, toVersion))
+				}
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// migrateTModLoaderConfig tModLoader 跨年度版本升级时提示检查Mod
+func migrateTModLoaderConfig(roomId uint, fromVersion, toVersion string) ([]string, error) {
+	if versionMajor(fromVersion) == versionMajor(toVersion) {
+		return nil, nil
+	}
+	var count int64
+	utils.DB.Model(&model.InstalledMod{}).Where("room_id = ?", roomId).Count(&count)
+	if count == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("tModLoader 从 %s 升级到 %s，已安装的 %d 个Mod可能需要更新", fromVersion, toVersion, count)}, nil
+}
+
+// versionMajor 版本号的第一段，无法解析时返回 0
+func versionMajor(version string) int {
+	major := 0
+	for _, r := range strings.TrimPrefix(version, "v") {
+		if r < '0' || r > '9' {
+			break
+		}
+		major = major*10 + int(r-'0')
+	}
+	return major
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// RuntimeInfo 检测到的运行时
+type RuntimeInfo struct {
+	Kind    string `json:"kind"`    // dotnet / mono
+	Version string `json:"version"` // dotnet 为 Microsoft.NETCore.App 版本
+	Path    string `json:"path"`    // 可执行文件路径
+	Root    string `json:"root"`    // dotnet 的安装根目录（DOTNET_ROOT）
+	Private bool   `json:"private"` // 安装在数据目录中的私有运行时
+}
+
+// RuntimeInstallRequest 安装私有 .NET 运行时
+// Archive 为服务器本机上的压缩包路径；未提供时按 URL 或配置的地址模板下载
+type RuntimeInstallRequest struct {
+	Version string `json:"version"`
+	Archive string `json:"archive"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+}
+
+// MissingRuntimeError 房间需要的运行时未安装
+type MissingRuntimeError struct {
+	Installation *model.Installation
+}
+
+func (e *MissingRuntimeError) Error() string {
+	inst := e.Installation
+	switch inst.Runtime {
+	case model.RuntimeDotnet:
+		return fmt.Sprintf("%s %s 需要 .NET %s 运行时（%s 或更高的 %d.x 版本），当前未安装。"+
+			"可以通过 POST /api/terraria/install/runtimes {\"version\":\"%s\"} 安装私有运行时，或在系统中安装 dotnet-runtime-%s",
+			inst.Type, inst.Version, dotnetChannel(inst.RuntimeVersion), inst.RuntimeVersion, versionMajor(inst.RuntimeVersion),
+			inst.RuntimeVersion, dotnetChannel(inst.RuntimeVersion))
+	case model.RuntimeMono:
+		return fmt.Sprintf("%s %s 需要 Mono 运行时，当前未安装。请通过系统包管理器安装 mono-complete（如 apt install mono-complete）",
+			inst.Type, inst.Version)
+	}
+	return fmt.Sprintf("%s %s 的运行时不可用", inst.Type, inst.Version)
+}
+
+// RuntimeService 运行时检测与私有运行时管理
+type RuntimeService struct{}
+
+// 同一时间只安装一个运行时
+var runtimeInstallMu sync.Mutex
+
+// NewRuntimeService 创建运行时服务
+func NewRuntimeService() *RuntimeService {
+	return &RuntimeService{}
+}
+
+// PrivateDotnetRoot 私有 .NET 运行时的安装目录
+func (s *RuntimeService) PrivateDotnetRoot() string {
+	return filepath.Clean(filepath.Join(config.GlobalConfig.DataPath, "runtimes", "dotnet"))
+}
+
+// DetectRuntimes 检测私有和系统中已安装的运行时
+func (s *RuntimeService) DetectRuntimes() []RuntimeInfo {
+	var runtimes []RuntimeInfo
+	seen := make(map[string]bool)
+	for _, root := range s.dotnetRoots("") {
+		for _, rt := range listDotnetRuntimes(root) {
+			rt.Private = root == s.PrivateDotnetRoot()
+			if !seen[rt.Root+"|"+rt.Version] {
+				seen[rt.Root+"|"+rt.Version] = true
+				runtimes = append(runtimes, rt)
+			}
+		}
+	}
+	if mono := detectMono(); mono != nil {
+		runtimes = append(runtimes, *mono)
+	}
+	return runtimes
+}
+
+// Resolve 查找满足安装要求的运行时，原生程序返回 nil
+// .NET 要求主版本相同且不低于 runtimeconfig.json 中的版本，优先使用私有运行时
+func (s *RuntimeService) Resolve(installation *model.Installation) (*RuntimeInfo, error) {
+	switch installation.Runtime {
+	case model.RuntimeNative, "":
+		return nil, nil
+	case model.RuntimeMono:
+		if mono := detectMono(); mono != nil {
+			return mono, nil
+		}
+	case model.RuntimeDotnet:
+		for _, root := range s.dotnetRoots(installation.Path) {
+			var best *RuntimeInfo
+			for _, rt := range listDotnetRuntimes(root) {
+				if !dotnetSatisfies(rt.Version, installation.RuntimeVersion) {
+					continue
+				}
+				if best == nil || utils.CompareVersions(rt.Version, best.Version) > 0 {
+					rt := rt
+					best = &rt
+				}
+			}
+			if best != nil {
+				best.Private = root == s.PrivateDotnetRoot()
+				return best, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("未知的运行时: %s", installation.Runtime)
+	}
+	return nil, &MissingRuntimeError{Installation: installation}
+}
+
+// InstallDotnet 从本地压缩包或下载地址安装私有 .NET 运行时
+func (s *RuntimeService) InstallDotnet(ctx context.Context, req RuntimeInstallRequest) (*RuntimeInfo, error) {
+	runtimeInstallMu.Lock()
+	defer runtimeInstallMu.Unlock()
+
+	archive := req.Archive
+	if archive == "" {
+		url := req.URL
+		if url == "" {
+			if req.Version == "" {
+				return nil, errors.New("请提供 version、url 或 archive")
+			}
+			url = dotnetDownloadURL(req.Version)
+		}
+		result, err := NewDownloadService().Fetch(ctx, DownloadRequest{URL: url, SHA256: req.SHA256})
+		if err != nil {
+			return nil, fmt.Errorf("下载运行时失败: %w", err)
+		}
+		archive = result.Path
+	} else if _, err := os.Stat(archive); err != nil {
+		return nil, fmt.Errorf("压缩包不存在: %w", err)
+	}
+
+	// 先解压到同一文件系统的临时目录并确认是 .NET 运行时，再移入私有运行时目录（多个版本可以共存）
+	root := s.PrivateDotnetRoot()
+	if err := os.MkdirAll(filepath.Dir(root), 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(root), ".dotnet-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := utils.ExtractArchive(ctx, archive, staging, utils.ExtractOptions{}); err != nil {
+		return nil, fmt.Errorf("解压运行时失败: %w", err)
+	}
+	installed := listDotnetRuntimes(staging)
+	if len(installed) == 0 {
+		return nil, errors.New("压缩包中没有 .NET 运行时（缺少 dotnet 和 shared/Microsoft.NETCore.App）")
+	}
+	if err := mergeDotnetRoot(staging, root); err != nil {
+		return nil, fmt.Errorf("安装运行时失败: %w", err)
+	}
+
+	rt := installed[len(installed)-1]
+	rt.Path = filepath.Join(root, filepath.Base(rt.Path))
+	rt.Root = root
+	rt.Private = true
+	log.Printf("✅ 已安装 .NET 运行时 %s", rt.Version)
+	return &rt, nil
+}
+
+// mergeDotnetRoot 把解压好的运行时移入私有运行时目录
+// 目录中还没有运行时时整体改名；否则只按版本目录移入 shared/<框架>/<版本> 和 host/fxr/<版本>，
+// 已有的版本和 dotnet 主程序保持不动，正在运行的服务器不会读到写了一半的文件
+func mergeDotnetRoot(staging, root string) error {
+	if len(listDotnetRuntimes(root)) == 0 {
+		if err := os.RemoveAll(root); err != nil {
+			return err
+		}
+		return os.Rename(staging, root)
+	}
+
+	patterns := []string{filepath.Join("shared", "*", "*"), filepath.Join("host", "fxr", "*")}
+	for _, pattern := range patterns {
+		dirs, _ := filepath.Glob(filepath.Join(staging, pattern))
+		for _, dir := range dirs {
+			rel, _ := filepath.Rel(staging, dir)
+			target := filepath.Join(root, rel)
+			if _, err := os.Stat(target); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(dir, target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dotnetRoots .NET 的候选安装根目录，按优先级排列
+// 依次为私有运行时、服务端自带的运行时（tModLoader 会安装到 dotnet/<版本>）、DOTNET_ROOT、PATH 中的 dotnet 及常见安装位置
+func (s *RuntimeService) dotnetRoots(installPath string) []string {
+	roots := []string{s.PrivateDotnetRoot()}
+	if installPath != "" {
+		bundled, _ := filepath.Glob(filepath.Join(installPath, "dotnet", "*"))
+		sort.Sort(sort.Reverse(sort.StringSlice(bundled)))
+		roots = append(roots, bundled...)
+	}
+	if root := os.Getenv("DOTNET_ROOT"); root != "" {
+		roots = append(roots, root)
+	}
+	if path, err := exec.LookPath(dotnetExecutable()); err == nil {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		roots = append(roots, filepath.Dir(path))
+	}
+	if runtime.GOOS == "windows" {
+		roots = append(roots, `C:\Program Files\dotnet`)
+	} else {
+		home, _ := os.UserHomeDir()
+		roots = append(roots, "/usr/share/dotnet", "/usr/lib/dotnet", "/usr/local/share/dotnet", "/opt/dotnet", filepath.Join(home, ".dotnet"))
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if !seen[root] {
+			seen[root] = true
+			unique = append(unique, root)
+		}
+	}
+	return unique
+}
+
+// listDotnetRuntimes 列出 .NET 根目录中的 Microsoft.NETCore.App 版本（从旧到新）
+func listDotnetRuntimes(root string) []RuntimeInfo {
+	executable := filepath.Join(root, dotnetExecutable())
+	if info, err := os.Stat(executable); err != nil || info.IsDir() {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "shared", "Microsoft.NETCore.App"))
+	if err != nil {
+		return nil
+	}
+
+	var runtimes []RuntimeInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runtimes = append(runtimes, RuntimeInfo{Kind: model.RuntimeDotnet, Version: entry.Name(), Path: executable, Root: root})
+		}
+	}
+	sort.Slice(runtimes, func(i, j int) bool {
+		return utils.CompareVersions(runtimes[i].Version, runtimes[j].Version) < 0
+	})
+	return runtimes
+}
+
+// detectMono 检测系统中的 Mono
+func detectMono() *RuntimeInfo {
+	path, err := exec.LookPath("mono")
+	if err != nil {
+		return nil
+	}
+	mono := &RuntimeInfo{Kind: model.RuntimeMono, Path: path}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err == nil {
+		// Mono JIT compiler version 6.12.0.200 (...)
+		line, _, _ := strings.Cut(string(output), "\n")
+		if i := strings.Index(line, "version "); i >= 0 {
+			mono.Version, _, _ = strings.Cut(line[i+len("version "):], " ")
+		}
+	}
+	return mono
+}
+
+// dotnetSatisfies 已安装的版本是否满足要求：主版本相同且不低于要求的版本
+func dotnetSatisfies(installed, required string) bool {
+	if required == "" {
+		return true
+	}
+	return versionMajor(installed) == versionMajor(required) && utils.CompareVersions(installed, required) >= 0
+}
+
+// dotnetChannel 版本号的前两段（如 6.0）
+func dotnetChannel(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// dotnetExecutable dotnet 可执行文件名
+func dotnetExecutable() string {
+	if runtime.GOOS == "windows" {
+		return "dotnet.exe"
+	}
+	return "dotnet"
+}
+
+// dotnetDownloadURL 按配置的地址模板生成 .NET 运行时下载地址
+func dotnetDownloadURL(version string) string {
+	osName := map[string]string{"linux": "linux", "darwin": "osx", "windows": "win"}[runtime.GOOS]
+	arch := map[string]string{"amd64": "x64", "arm64": "arm64", "arm": "arm", "386": "x86"}[runtime.GOARCH]
+	ext := "tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = "zip"
+	}
+	return strings.NewReplacer("{version}", version, "{os}", osName, "{arch}", arch, "{ext}", ext).
+		Replace(config.GlobalConfig.DotnetDownloadURL)
+}
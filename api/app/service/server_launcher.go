@@ -0,0 +1,225 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"terraria-api/app/model"
+	"time"
+)
+
+// roomProcess 运行中的服务端进程
+type roomProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser // 服务端控制台
+}
+
+// 运行中的服务端进程（房间ID -> *roomProcess）
+var roomProcesses sync.Map
+
+// sendConsoleCommand 向运行中的服务端控制台发送一条命令
+func sendConsoleCommand(roomId uint, command string) error {
+	p, ok := roomProcesses.Load(roomId)
+	if !ok {
+		return errors.New("服务器未在运行中")
+	}
+	_, err := io.WriteString(p.(*roomProcess).stdin, command+"\n")
+	return err
+}
+
+// serverCommand 按房间绑定的安装和运行时生成启动命令，工作目录为房间目录
+func serverCommand(room *model.Room, args ...string) (*exec.Cmd, error) {
+	installation := room.Installation
+	if installation == nil {
+		return nil, fmt.Errorf("房间没有可用的 %s 服务端，请先安装后在房间设置中选择版本", room.Type)
+	}
+
+	entry, err := filepath.Abs(filepath.Join(installation.Path, filepath.FromSlash(installation.EntryBinary)))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(entry); err != nil {
+		return nil, fmt.Errorf("服务端程序 %s 不存在，请重新安装 %s %s", installation.EntryBinary, installation.Type, installation.Version)
+	}
+
+	rt, err := NewRuntimeService().Resolve(installation)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case rt == nil:
+		cmd = exec.Command(entry, args...)
+	case rt.Kind == model.RuntimeDotnet:
+		cmd = exec.Command(rt.Path, append([]string{entry}, args...)...)
+		cmd.Env = append(os.Environ(), "DOTNET_ROOT="+rt.Root)
+	default:
+		cmd = exec.Command(rt.Path, append([]string{entry}, args...)...)
+	}
+
+	roomDir, err := filepath.Abs(getRoomDir(room.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(roomDir, 0755); err != nil {
+		return nil, err
+	}
+	cmd.Dir = roomDir
+	return cmd, nil
+}
+
+// openServerLog 打开房间的服务端日志（追加写入），每行输出加上时间戳并交给日志事件处理
+func openServerLog(roomId uint) (*serverLogWriter, error) {
+	logDir := filepath.Join(getRoomDir(roomId), "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(logDir, "server.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &serverLogWriter{roomId: roomId, file: file}, nil
+}
+
+// serverLogWriter 按行写入服务端输出（标准输出和标准错误共用，需要加锁）
+type serverLogWriter struct {
+	mu     sync.Mutex
+	roomId uint
+	file   *os.File
+	buf    []byte
+}
+
+// 服务端日志的时间戳格式
+const serverLogTimeLayout = "2006-01-02 15:04:05"
+
+func (w *serverLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+		w.writeLine(line)
+	}
+	// 控制台提示符等不换行的输出过长时直接写出
+	if len(w.buf) > 4096 {
+		w.writeLine(string(w.buf))
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// Close 写出剩余内容并关闭日志文件
+func (w *serverLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.writeLine(strings.TrimRight(string(w.buf), "\r"))
+		w.buf = nil
+	}
+	return w.file.Close()
+}
+
+func (w *serverLogWriter) writeLine(line string) {
+	at := time.Now()
+	fmt.Fprintf(w.file, "[%s] %s\n", at.Format(serverLogTimeLayout), line)
+	NewProgressionService().HandleLogLine(w.roomId, at, line)
+}
+
+// getRoomWorldsDir 房间的世界目录
+func getRoomWorldsDir(roomId uint) string {
+	return filepath.Join(getRoomDir(roomId), "Worlds")
+}
+
+// writeServerConfig 根据房间和世界配置生成 serverconfig.txt，返回其绝对路径
+// 密码等写在配置文件中，避免出现在进程参数里
+func writeServerConfig(room *model.Room) (string, error) {
+	worldsDir, err := filepath.Abs(getRoomWorldsDir(room.ID))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(worldsDir, 0755); err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		"world=" + filepath.Join(worldsDir, worldFileName(room.WorldName)),
+		"worldpath=" + worldsDir,
+		"worldname=" + room.WorldName,
+		fmt.Sprintf("port=%d", room.Port),
+		fmt.Sprintf("maxplayers=%d", max(room.MaxPlayers, 1)),
+		"secure=0",
+		"upnp=0",
+	}
+	if room.Password != "" {
+		lines = append(lines, "password="+room.Password)
+	}
+
+	size, difficulty, language := "2", "0", "zh-Hans"
+	if wc := room.WorldConfig; wc != nil {
+		if wc.Size != "" {
+			size = wc.Size
+		}
+		if wc.Difficulty != "" {
+			difficulty = wc.Difficulty
+		}
+		if wc.Language != "" {
+			language = terrariaLanguage(wc.Language)
+		}
+		if wc.Seed != "" {
+			lines = append(lines, "seed="+wc.Seed)
+		}
+		if wc.MOTD != "" {
+			lines = append(lines, "motd="+wc.MOTD)
+		}
+	}
+	// 世界不存在时按配置自动创建
+	lines = append(lines, "autocreate="+size, "difficulty="+difficulty, "language="+language)
+
+	path, err := filepath.Abs(filepath.Join(getRoomDir(room.ID), "serverconfig.txt"))
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// worldFileName 世界名称对应的 .wld 文件名
+func worldFileName(worldName string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(worldName))
+	if name == "" {
+		name = "World"
+	}
+	return name + ".wld"
+}
+
+// terrariaLanguage 将面板的语言代码转换为 Terraria 的语言代码
+func terrariaLanguage(lang string) string {
+	switch strings.ToLower(lang) {
+	case "zh-cn", "zh", "zh-hans":
+		return "zh-Hans"
+	case "en", "en-us":
+		return "en-US"
+	}
+	return lang
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"terraria-api/config"
+	"terraria-api/utils"
+)
+
+// setupTestEnv 使用临时目录作为服务端目录、数据目录和数据库，测试结束后恢复原来的配置
+func setupTestEnv(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		DBPath:     dir,
+		ServerPath: filepath.Join(dir, "servers"),
+		DataPath:   filepath.Join(dir, "data"),
+	}
+	for _, p := range []string{cfg.ServerPath, cfg.DataPath} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldConfig, oldDB := config.GlobalConfig, utils.DB
+	config.GlobalConfig = cfg
+	utils.InitDB(dir)
+	t.Cleanup(func() {
+		if sqlDB, err := utils.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		config.GlobalConfig, utils.DB = oldConfig, oldDB
+	})
+	return cfg
+}
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"terraria-api/app/model"
 	"terraria-api/utils"
+	"time"
 )
 
 // TShockService TShock配置服务
@@ -134,6 +137,50 @@ func (s *TShockService) UpdateSSCConfig(roomId uint, config map[string]interface
 	return os.WriteFile(configPath, content, 0644)
 }
 
+// ExecuteRestCommand 通过TShock REST API在运行中的服务器上执行命令
+func (s *TShockService) ExecuteRestCommand(roomId uint, command string) ([]string, error) {
+	var room model.Room
+	if err := utils.DB.Preload("TShockConfig").First(&room, roomId).Error; err != nil {
+		return nil, errors.New("房间不存在")
+	}
+
+	if room.Type != model.ServerTypeTShock {
+		return nil, errors.New("此房间不是TShock服务器")
+	}
+	if room.Status != model.StatusRunning {
+		return nil, errors.New("服务器未在运行中")
+	}
+	if room.TShockConfig == nil || room.TShockConfig.RestAPIToken == "" {
+		return nil, errors.New("未配置REST API令牌")
+	}
+
+	query := url.Values{}
+	query.Set("token", room.TShockConfig.RestAPIToken)
+	query.Set("cmd", command)
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/v3/server/rawcmd?%s", room.TShockConfig.RestAPIPort, query.Encode())
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status   string   `json:"status"`
+		Response []string `json:"response"`
+		Error    string   `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("REST API响应格式错误: %w", err)
+	}
+	if result.Status != "200" {
+		return nil, fmt.Errorf("REST API返回错误: %s %s", result.Status, result.Error)
+	}
+
+	return result.Response, nil
+}
+
 // getDefaultTShockConfig 获取默认TShock配置
 func (s *TShockService) getDefaultTShockConfig() map[string]interface{} {
 	return map[string]interface{}{
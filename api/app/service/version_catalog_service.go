@@ -0,0 +1,523 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// GameVersion 游戏版本信息
+type GameVersion struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Type        string   `json:"type"` // vanilla, tshock, tmodloader
+	Description string   `json:"description"`
+	DownloadURL string   `json:"download_url"`
+	Mirrors     []string `json:"mirrors,omitempty"` // 备用下载地址
+	SHA256      string   `json:"sha256"`            // 安装包的 SHA-256，为空时无法校验
+	Size        string   `json:"size"`
+	Prerelease  bool     `json:"prerelease"`
+	PublishedAt string   `json:"published_at,omitempty"`
+	Recommended bool     `json:"recommended"`
+	// Unverified 没有校验和（如离线时的内置版本），只能由管理员设置 unverified=true 后安装
+	Unverified bool `json:"unverified"`
+}
+
+// Verified 是否可以校验安装包
+func (v *GameVersion) Verified() bool {
+	return v.SHA256 != ""
+}
+
+// releaseFeed 通过 GitHub Releases 发布的服务端
+type releaseFeed struct {
+	Type        string
+	Repo        string
+	Name        string
+	Description string
+	AssetPrefix string // 安装包文件名前缀（小写），用于排除示例Mod等其他附件
+}
+
+var releaseFeeds = []releaseFeed{
+	{Type: "tshock", Repo: "Pryaxis/TShock", Name: "TShock", Description: "TShock服务端 - 支持插件和管理命令", AssetPrefix: "tshock"},
+	{Type: "tmodloader", Repo: "tModLoader/tModLoader", Name: "tModLoader", Description: "tModLoader服务端 - 支持模组", AssetPrefix: "tmodloader"},
+}
+
+// 每个来源最多保留的版本数
+const maxReleasesPerFeed = 10
+
+// githubRelease GitHub Releases API 返回的发布信息
+type githubRelease struct {
+	TagName     string        `json:"tag_name"`
+	Name        string        `json:"name"`
+	Draft       bool          `json:"draft"`
+	Prerelease  bool          `json:"prerelease"`
+	PublishedAt string        `json:"published_at"`
+	Assets      []githubAsset `json:"assets"`
+}
+
+// githubAsset 发布附件
+type githubAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	Size               int64  `json:"size"`
+	Digest             string `json:"digest"` // 形如 sha256:<hex>，旧的发布没有
+}
+
+// VersionCatalogService 可安装的服务端版本目录（全局共享缓存）
+// TShock 和 tModLoader 从 GitHub Releases 获取，原版服务端来自本地覆盖文件
+type VersionCatalogService struct {
+	mu        sync.RWMutex
+	feeds     map[string][]GameVersion // 按类型缓存的发布版本
+	fetchedAt time.Time
+	refreshMu sync.Mutex
+}
+
+var versionCatalogService = &VersionCatalogService{}
+
+// NewVersionCatalogService 获取版本目录服务
+func NewVersionCatalogService() *VersionCatalogService {
+	return versionCatalogService
+}
+
+// GetVersions 获取可用的游戏版本列表
+// 还没有拉取过时等待拉取完成；缓存过期时先返回旧的列表，在后台刷新
+func (s *VersionCatalogService) GetVersions() []GameVersion {
+	s.mu.RLock()
+	feeds, fetchedAt := s.feeds, s.fetchedAt
+	s.mu.RUnlock()
+
+	if feeds == nil {
+		s.refreshIfStale()
+		s.mu.RLock()
+		feeds = s.feeds
+		s.mu.RUnlock()
+	} else if time.Since(fetchedAt) >= config.GlobalConfig.VersionCatalogRefresh && s.refreshMu.TryLock() {
+		// 已有刷新在进行时不再启动新的
+		go func() {
+			defer s.refreshMu.Unlock()
+			s.refreshLocked()
+		}()
+	}
+
+	var versions []GameVersion
+	for _, feed := range releaseFeeds {
+		versions = append(versions, feeds[feed.Type]...)
+	}
+	versions = mergeVersionOverrides(versions, s.loadOverrides())
+	markRecommended(versions)
+	for i := range versions {
+		versions[i].Unverified = !versions[i].Verified()
+	}
+	return versions
+}
+
+// FindVersion 按类型和版本号查找目录中的版本
+func (s *VersionCatalogService) FindVersion(serverType, version string) *GameVersion {
+	for _, v := range s.GetVersions() {
+		if v.Type == serverType && v.Version == version {
+			return &v
+		}
+	}
+	return nil
+}
+
+// Refresh 重新拉取所有发布来源
+// 单个来源拉取失败时依次使用内存缓存、磁盘缓存和内置版本，不会返回空目录
+func (s *VersionCatalogService) Refresh() error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	return s.refreshLocked()
+}
+
+// refreshIfStale 缓存为空或过期时刷新，拿到锁后重新检查，等待同一次刷新的请求不会重复拉取
+func (s *VersionCatalogService) refreshIfStale() {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	s.mu.RLock()
+	fresh := s.feeds != nil && time.Since(s.fetchedAt) < config.GlobalConfig.VersionCatalogRefresh
+	s.mu.RUnlock()
+	if !fresh {
+		s.refreshLocked()
+	}
+}
+
+// refreshLocked 拉取所有发布来源，调用方需持有 refreshMu
+func (s *VersionCatalogService) refreshLocked() error {
+	s.mu.RLock()
+	previous := s.feeds
+	s.mu.RUnlock()
+
+	var cached map[string][]GameVersion
+	feeds := make(map[string][]GameVersion)
+	var errs []string
+	for _, feed := range releaseFeeds {
+		versions, err := s.fetchFeed(feed)
+		if err == nil && len(versions) == 0 {
+			err = fmt.Errorf("没有适用于 %s/%s 的安装包", runtime.GOOS, runtime.GOARCH)
+		}
+		if err == nil {
+			feeds[feed.Type] = versions
+			continue
+		}
+
+		errs = append(errs, feed.Name+": "+err.Error())
+		switch {
+		case len(previous[feed.Type]) > 0:
+			feeds[feed.Type] = previous[feed.Type]
+		default:
+			if cached == nil {
+				cached = s.readCache()
+			}
+			if len(cached[feed.Type]) > 0 {
+				feeds[feed.Type] = cached[feed.Type]
+			} else {
+				feeds[feed.Type] = builtinVersions(feed.Type)
+			}
+		}
+	}
+
+	if len(errs) < len(releaseFeeds) {
+		s.writeCache(feeds)
+	}
+
+	s.mu.Lock()
+	s.feeds = feeds
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+
+	if len(errs) > 0 {
+		err := errors.New(strings.Join(errs, "; "))
+		log.Printf("⚠️ 刷新版本目录失败，使用缓存: %v", err)
+		return err
+	}
+	log.Println("✅ 版本目录已刷新")
+	return nil
+}
+
+// fetchFeed 从 GitHub Releases API 获取一个来源的版本列表
+func (s *VersionCatalogService) fetchFeed(feed releaseFeed) ([]GameVersion, error) {
+	base := strings.TrimRight(config.GlobalConfig.ReleaseAPIBase, "/")
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=30", base, feed.Repo)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "terraria-panel")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []githubRelease
+	if err := json.Unmarshal(content, &releases); err != nil {
+		return nil, errors.New("发布列表格式错误: " + err.Error())
+	}
+
+	var versions []GameVersion
+	for _, release := range releases {
+		if release.Draft {
+			continue
+		}
+		asset := selectReleaseAsset(release.Assets, feed.AssetPrefix, runtime.GOOS, runtime.GOARCH)
+		if asset == nil {
+			continue
+		}
+
+		version := strings.TrimPrefix(strings.TrimPrefix(release.TagName, "v"), "V")
+		description := feed.Description
+		if release.Prerelease {
+			description += "（预览版）"
+		}
+		v := GameVersion{
+			Name:        feed.Name + " " + version,
+			Version:     version,
+			Type:        feed.Type,
+			Description: description,
+			DownloadURL: asset.BrowserDownloadURL,
+			Size:        formatDownloadSize(asset.Size),
+			Prerelease:  release.Prerelease,
+			PublishedAt: release.PublishedAt,
+		}
+		if digest, ok := strings.CutPrefix(asset.Digest, "sha256:"); ok {
+			v.SHA256 = strings.ToLower(digest)
+		}
+		versions = append(versions, v)
+		if len(versions) >= maxReleasesPerFeed {
+			break
+		}
+	}
+	return versions, nil
+}
+
+// loadOverrides 读取本地版本覆盖文件（原版服务端及手动补充的版本）
+// 文件不存在时使用内置的原版服务端
+func (s *VersionCatalogService) loadOverrides() []GameVersion {
+	content, err := os.ReadFile(config.GlobalConfig.VersionOverrides)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ 读取版本覆盖文件失败: %v", err)
+		}
+		return builtinVersions("vanilla")
+	}
+
+	var file struct {
+		Versions []GameVersion `json:"versions"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		log.Printf("⚠️ 版本覆盖文件格式错误: %v", err)
+		return builtinVersions("vanilla")
+	}
+
+	var versions []GameVersion
+	for _, v := range file.Versions {
+		if v.Type == "" || v.Version == "" || v.DownloadURL == "" {
+			log.Printf("⚠️ 版本覆盖文件中的 %s %s 缺少 type、version 或 download_url，已忽略", v.Type, v.Version)
+			continue
+		}
+		if v.Name == "" {
+			v.Name = v.Type + " " + v.Version
+		}
+		v.SHA256 = strings.ToLower(v.SHA256)
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// cachePath 版本目录的本地缓存路径
+func (s *VersionCatalogService) cachePath() string {
+	return filepath.Join(config.GlobalConfig.DBPath, "version_catalog.cache.json")
+}
+
+// readCache 读取上次成功拉取的版本目录
+func (s *VersionCatalogService) readCache() map[string][]GameVersion {
+	feeds := make(map[string][]GameVersion)
+	content, err := os.ReadFile(s.cachePath())
+	if err != nil {
+		return feeds
+	}
+	if err := json.Unmarshal(content, &feeds); err != nil {
+		log.Printf("⚠️ 版本目录缓存格式错误: %v", err)
+	}
+	return feeds
+}
+
+// writeCache 保存版本目录缓存
+func (s *VersionCatalogService) writeCache(feeds map[string][]GameVersion) {
+	content, err := json.MarshalIndent(feeds, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(s.cachePath(), content, 0644); err != nil {
+		log.Printf("⚠️ 写入版本目录缓存失败: %v", err)
+	}
+}
+
+// 安装包文件名中表示平台的片段
+var (
+	assetOSTokens = map[string][]string{
+		"linux":   {"linux"},
+		"windows": {"win", "windows", "win64", "win32"},
+		"darwin":  {"osx", "mac", "macos", "darwin"},
+	}
+	assetArchTokens = map[string][]string{
+		"amd64": {"x64", "amd64", "x86_64"},
+		"arm64": {"arm64", "aarch64"},
+		"arm":   {"arm", "armhf"},
+		"386":   {"x86", "i386"},
+	}
+)
+
+// selectReleaseAsset 选择适合当前系统和架构的安装包
+// 文件名中标明了其他系统或架构的附件会被排除；与当前平台完全匹配的优先，其次是不区分平台的安装包
+func selectReleaseAsset(assets []githubAsset, prefix, goos, goarch string) *githubAsset {
+	var best *githubAsset
+	bestScore := 0
+	for i := range assets {
+		asset := &assets[i]
+		name := strings.ToLower(asset.Name)
+		if !strings.HasPrefix(name, prefix) || !isServerArchiveName(name) {
+			continue
+		}
+
+		tokens := make(map[string]bool)
+		for _, t := range strings.FieldsFunc(name, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_')
+		}) {
+			tokens[t] = true
+		}
+
+		osMatch, osOther := matchAssetTokens(tokens, assetOSTokens, goos)
+		archMatch, archOther := matchAssetTokens(tokens, assetArchTokens, goarch)
+		if (osOther && !osMatch) || (archOther && !archMatch) {
+			continue
+		}
+
+		score := 1
+		if osMatch {
+			score += 2
+		}
+		if archMatch {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = asset, score
+		}
+	}
+	return best
+}
+
+// matchAssetTokens 判断文件名是否包含当前平台的片段，以及是否包含其他平台的片段
+func matchAssetTokens(tokens map[string]bool, table map[string][]string, current string) (match, other bool) {
+	for platform, names := range table {
+		for _, n := range names {
+			if !tokens[n] {
+				continue
+			}
+			if platform == current {
+				match = true
+			} else {
+				other = true
+			}
+		}
+	}
+	return match, other
+}
+
+// isServerArchiveName 判断文件名是否为可解压的安装包
+func isServerArchiveName(name string) bool {
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeVersionOverrides 合并覆盖文件中的版本，类型和版本号相同时覆盖文件优先
+func mergeVersionOverrides(versions, overrides []GameVersion) []GameVersion {
+	for _, o := range overrides {
+		replaced := false
+		for i := range versions {
+			if versions[i].Type == o.Type && versions[i].Version == o.Version {
+				versions[i] = o
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			versions = append(versions, o)
+		}
+	}
+	return versions
+}
+
+// markRecommended 将每种类型最新的正式版标记为推荐，同类型的版本从新到旧排列
+func markRecommended(versions []GameVersion) {
+	order := make(map[string]int)
+	for _, v := range versions {
+		if _, ok := order[v.Type]; !ok {
+			order[v.Type] = len(order)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Type != versions[j].Type {
+			return order[versions[i].Type] < order[versions[j].Type]
+		}
+		return utils.CompareVersions(versions[i].Version, versions[j].Version) > 0
+	})
+
+	seen := make(map[string]bool)
+	for i := range versions {
+		versions[i].Recommended = !versions[i].Prerelease && !seen[versions[i].Type]
+		if versions[i].Recommended {
+			seen[versions[i].Type] = true
+		}
+	}
+}
+
+// formatDownloadSize 格式化安装包大小
+func formatDownloadSize(size int64) string {
+	if size <= 0 {
+		return ""
+	}
+	if size < 1<<20 {
+		return fmt.Sprintf("%dKB", (size+1023)>>10)
+	}
+	return fmt.Sprintf("~%dMB", (size+1<<19)>>20)
+}
+
+// builtinTShockPlatforms 内置 TShock 版本各平台安装包文件名中的平台片段
+var builtinTShockPlatforms = map[string]string{
+	"linux/amd64":   "linux-x64",
+	"linux/arm64":   "linux-arm64",
+	"windows/amd64": "win-x64",
+	"darwin/amd64":  "osx-x64",
+	"darwin/arm64":  "osx-arm64",
+}
+
+// builtinVersions 内置版本，发布来源和缓存都不可用时使用
+// 内置版本没有校验和，只能由管理员以 unverified 方式安装；TShock 没有当前平台的安装包时不提供
+func builtinVersions(serverType string) []GameVersion {
+	var builtin []GameVersion
+	if platform, ok := builtinTShockPlatforms[runtime.GOOS+"/"+runtime.GOARCH]; ok {
+		builtin = append(builtin, GameVersion{
+			Name:        "TShock 5.2.0",
+			Version:     "5.2.0",
+			Type:        "tshock",
+			Description: "TShock服务端 - 支持插件和管理命令",
+			DownloadURL: fmt.Sprintf("https://github.com/Pryaxis/TShock/releases/download/v5.2.0/TShock-5.2.0-for-Terraria-1.4.4.9-%s-Release.zip", platform),
+			Size:        "~15MB",
+		})
+	}
+
+	var versions []GameVersion
+	for _, v := range append(builtin, []GameVersion{
+		{
+			Name:        "官方原版服务端",
+			Version:     "1.4.4.9",
+			Type:        "vanilla",
+			Description: "官方原版Terraria服务端 - 无插件支持",
+			DownloadURL: "https://terraria.org/api/download/pc-dedicated-server/terraria-server-1449.zip",
+			Size:        "~10MB",
+		},
+		{
+			Name:        "tModLoader",
+			Version:     "2023.8.3.0",
+			Type:        "tmodloader",
+			Description: "tModLoader服务端 - 支持模组",
+			DownloadURL: "https://github.com/tModLoader/tModLoader/releases/download/v2023.8.3.0/tModLoader.zip",
+			Size:        "~50MB",
+		},
+	}...) {
+		if v.Type == serverType {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
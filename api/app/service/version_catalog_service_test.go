@@ -0,0 +1,57 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVersionCatalogRefreshOnce(t *testing.T) {
+	cfg := setupTestEnv(t)
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	cfg.ReleaseAPIBase = server.URL
+	cfg.VersionCatalogRefresh = time.Hour
+
+	// 缓存为空时并发的请求只拉取一次
+	s := &VersionCatalogService{}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if len(s.GetVersions()) == 0 {
+				t.Error("版本目录不应为空")
+			}
+		}()
+	}
+	wg.Wait()
+	if got := hits.Load(); got != int32(len(releaseFeeds)) {
+		t.Fatalf("每个来源应只拉取一次，实际请求 %d 次", got)
+	}
+
+	// 缓存过期时立即返回旧的列表，后台只刷新一次
+	s.mu.Lock()
+	s.fetchedAt = time.Now().Add(-2 * time.Hour)
+	s.mu.Unlock()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		s.GetVersions()
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("缓存过期时不应等待刷新: %v", elapsed)
+	}
+	s.refreshMu.Lock()
+	s.refreshMu.Unlock()
+	if got := hits.Load(); got != int32(2*len(releaseFeeds)) {
+		t.Errorf("过期后应在后台刷新一次，实际请求 %d 次", got)
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"terraria-api/app/model"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// tModLoader 在Steam上的应用ID
+const tModLoaderAppID = "1281930"
+
+// steamcmd 同一时间只允许一个实例操作缓存目录
+var steamcmdMu sync.Mutex
+
+// steamcmdTimeout 单次下载的最长时间
+var steamcmdTimeout = 30 * time.Minute
+
+var workshopIDPattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+
+// WorkshopService Steam创意工坊服务
+type WorkshopService struct{}
+
+// NewWorkshopService 创建创意工坊服务
+func NewWorkshopService() *WorkshopService {
+	return &WorkshopService{}
+}
+
+// WorkshopBuild 创意工坊物品中针对某个tModLoader版本的构建
+type WorkshopBuild struct {
+	Folder            string `json:"folder"` // 构建所在子目录（如 2023.8），位于根目录时为空
+	File              string `json:"file"`   // 相对物品目录的 .tmod 路径
+	TModLoaderVersion string `json:"tModLoaderVersion"`
+	ModVersion        string `json:"modVersion"`
+}
+
+// SearchItems 搜索本地已下载的创意工坊物品
+func (s *WorkshopService) SearchItems(query string, page, pageSize int) ([]model.WorkshopItem, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	db := utils.DB.Model(&model.WorkshopItem{})
+	if query != "" {
+		like := "%" + query + "%"
+		db = db.Where("workshop_id = ? OR name LIKE ? OR display_name LIKE ? OR author LIKE ? OR description LIKE ?",
+			query, like, like, like, like)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	items := []model.WorkshopItem{}
+	err := db.Order("display_name").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error
+	return items, total, err
+}
+
+// GetItem 获取已下载的物品，本地缓存缺失时返回错误
+func (s *WorkshopService) GetItem(workshopId string) (*model.WorkshopItem, error) {
+	var item model.WorkshopItem
+	if err := utils.DB.Where("workshop_id = ?", workshopId).First(&item).Error; err != nil {
+		return nil, errors.New("创意工坊物品尚未下载")
+	}
+	if _, err := os.Stat(item.Path); err != nil {
+		return nil, errors.New("创意工坊物品缓存已丢失，请重新下载")
+	}
+	return &item, nil
+}
+
+// EnsureDownloaded 物品未缓存时通过 steamcmd 下载
+func (s *WorkshopService) EnsureDownloaded(workshopId string) (*model.WorkshopItem, error) {
+	if item, err := s.GetItem(workshopId); err == nil {
+		return item, nil
+	}
+	return s.Download(workshopId)
+}
+
+// Download 通过 steamcmd 下载（或更新）创意工坊物品并写入本地索引
+func (s *WorkshopService) Download(workshopId string) (*model.WorkshopItem, error) {
+	if !workshopIDPattern.MatchString(workshopId) {
+		return nil, errors.New("无效的创意工坊ID")
+	}
+
+	cacheDir, err := filepath.Abs(filepath.Join(config.GlobalConfig.DataPath, "workshop"))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+
+	steamcmdMu.Lock()
+	defer steamcmdMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), steamcmdTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, config.GlobalConfig.SteamCMDPath,
+		"+force_install_dir", cacheDir,
+		"+login", "anonymous",
+		"+workshop_download_item", tModLoaderAppID, workshopId, "validate",
+		"+quit",
+	)
+	// 超时结束 steamcmd 后，子进程可能仍占用输出管道，不再无限等待
+	cmd.WaitDelay = 10 * time.Second
+	output, err := cmd.CombinedOutput()
+	itemDir := filepath.Join(cacheDir, "steamapps", "workshop", "content", tModLoaderAppID, workshopId)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("steamcmd下载超时: %s", lastLines(string(output), 5))
+	}
+	if err != nil || strings.Contains(string(output), "ERROR!") {
+		return nil, fmt.Errorf("steamcmd下载失败: %s", lastLines(string(output), 5))
+	}
+	if _, err := os.Stat(itemDir); err != nil {
+		return nil, fmt.Errorf("steamcmd未生成物品目录: %s", lastLines(string(output), 5))
+	}
+
+	return s.indexItem(workshopId, itemDir)
+}
+
+// SelectBuild 为房间的tModLoader版本选择合适的构建
+// 选取兼容房间版本的构建中tModLoader版本最高的一个
+func (s *WorkshopService) SelectBuild(item *model.WorkshopItem, roomVersion string) (string, *WorkshopBuild, error) {
+	var builds []WorkshopBuild
+	if err := json.Unmarshal([]byte(item.Builds), &builds); err != nil || len(builds) == 0 {
+		return "", nil, errors.New("创意工坊物品中没有 .tmod 文件")
+	}
+
+	var best *WorkshopBuild
+	var reasons []string
+	for i := range builds {
+		build := &builds[i]
+		tmod := &utils.TmodFile{TModLoaderVersion: build.TModLoaderVersion}
+		if _, err := checkTModLoaderCompatibility(tmod, roomVersion); err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		if best == nil || utils.CompareVersions(build.TModLoaderVersion, best.TModLoaderVersion) > 0 {
+			best = build
+		}
+	}
+	if best == nil {
+		return "", nil, fmt.Errorf("没有适用于 tModLoader %s 的构建: %s", roomVersion, strings.Join(reasons, "; "))
+	}
+
+	return filepath.Join(item.Path, filepath.FromSlash(best.File)), best, nil
+}
+
+// indexItem 扫描物品目录中的 .tmod 构建并更新本地索引
+// tModLoader 1.4 的创意工坊物品按tModLoader版本分子目录存放，旧物品直接放在根目录
+func (s *WorkshopService) indexItem(workshopId, itemDir string) (*model.WorkshopItem, error) {
+	var builds []WorkshopBuild
+	var latest *utils.TmodFile
+	var size int64
+
+	err := filepath.WalkDir(itemDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(itemDir, p)
+		if d.IsDir() {
+			// 只扫描根目录和一级子目录
+			if rel != "." && strings.Count(filepath.ToSlash(rel), "/") >= 1 {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		if !strings.EqualFold(filepath.Ext(p), ".tmod") {
+			return nil
+		}
+
+		tmod, err := utils.ReadTmodFile(p, false)
+		if err != nil {
+			return nil
+		}
+		folder := filepath.ToSlash(filepath.Dir(rel))
+		if folder == "." {
+			folder = ""
+		}
+		builds = append(builds, WorkshopBuild{
+			Folder:            folder,
+			File:              filepath.ToSlash(rel),
+			TModLoaderVersion: tmod.TModLoaderVersion,
+			ModVersion:        tmod.Version,
+		})
+		if latest == nil || utils.CompareVersions(tmod.TModLoaderVersion, latest.TModLoaderVersion) > 0 {
+			latest = tmod
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, errors.New("创意工坊物品中没有有效的 .tmod 文件")
+	}
+
+	sort.Slice(builds, func(i, j int) bool {
+		return utils.CompareVersions(builds[i].TModLoaderVersion, builds[j].TModLoaderVersion) > 0
+	})
+	buildsContent, _ := json.Marshal(builds)
+
+	var item model.WorkshopItem
+	utils.DB.Where("workshop_id = ?", workshopId).First(&item)
+	item.WorkshopID = workshopId
+	item.Name = latest.Name
+	item.DisplayName = latest.Name
+	item.Version = latest.Version
+	item.Builds = string(buildsContent)
+	item.Path = itemDir
+	item.Size = size
+	item.DownloadedAt = time.Now()
+	if latest.Info != nil {
+		if latest.Info.DisplayName != "" {
+			item.DisplayName = latest.Info.DisplayName
+		}
+		item.Author = latest.Info.Author
+		item.Description = latest.Info.Description
+	}
+
+	if err := utils.DB.Save(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// lastLines 取输出的最后几行用于错误信息
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, " | ")
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeDotNetString 按 .NET BinaryWriter 的格式写入字符串（7 位变长长度前缀）
+func writeDotNetString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	for n >= 0x80 {
+		buf.WriteByte(byte(n) | 0x80)
+		n >>= 7
+	}
+	buf.WriteByte(byte(n))
+	buf.WriteString(s)
+}
+
+// buildTestTmod 生成只包含 Info 条目的 1.4 格式 .tmod
+func buildTestTmod(name, version, tmlVersion, displayName string) []byte {
+	var info bytes.Buffer
+	writeDotNetString(&info, "displayName")
+	writeDotNetString(&info, displayName)
+	writeDotNetString(&info, "author")
+	writeDotNetString(&info, "tester")
+	writeDotNetString(&info, "")
+
+	var data bytes.Buffer
+	writeDotNetString(&data, name)
+	writeDotNetString(&data, version)
+	binary.Write(&data, binary.LittleEndian, int32(1))
+	writeDotNetString(&data, "Info")
+	binary.Write(&data, binary.LittleEndian, int32(info.Len()))
+	binary.Write(&data, binary.LittleEndian, int32(info.Len()))
+	data.Write(info.Bytes())
+
+	var file bytes.Buffer
+	file.WriteString("TMOD")
+	writeDotNetString(&file, tmlVersion)
+	file.Write(make([]byte, 20+256))
+	binary.Write(&file, binary.LittleEndian, int32(data.Len()))
+	file.Write(data.Bytes())
+	return file.Bytes()
+}
+
+// setupFakeSteamCMD 用 shell 脚本代替 steamcmd，脚本收到的参数与真实调用相同
+func setupFakeSteamCMD(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("假 steamcmd 使用 shell 脚本")
+	}
+	cfg := setupTestEnv(t)
+	cfg.SteamCMDPath = filepath.Join(t.TempDir(), "steamcmd.sh")
+	if err := os.WriteFile(cfg.SteamCMDPath, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkshopDownload(t *testing.T) {
+	setupFakeSteamCMD(t, `
+# 参数: +force_install_dir <dir> +login anonymous +workshop_download_item <app> <id> validate +quit
+dir="$2/steamapps/workshop/content/$6/$7/2024.1"
+mkdir -p "$dir"
+cp "$FAKE_TMOD" "$dir/TestMod.tmod"
+echo "Success. Downloaded item $7"
+`)
+	tmodPath := filepath.Join(t.TempDir(), "TestMod.tmod")
+	if err := os.WriteFile(tmodPath, buildTestTmod("TestMod", "1.2.3", "2024.1.3.1", "Test Mod"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_TMOD", tmodPath)
+
+	item, err := NewWorkshopService().Download("123456")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if item.WorkshopID != "123456" || item.Name != "TestMod" || item.Version != "1.2.3" {
+		t.Errorf("物品信息不符: %+v", item)
+	}
+	if item.DisplayName != "Test Mod" || item.Author != "tester" {
+		t.Errorf("Info 未写入索引: displayName=%q author=%q", item.DisplayName, item.Author)
+	}
+	if !strings.Contains(item.Builds, `"folder":"2024.1"`) {
+		t.Errorf("构建列表不符: %s", item.Builds)
+	}
+
+	cached, err := NewWorkshopService().GetItem("123456")
+	if err != nil || cached.ID != item.ID {
+		t.Fatalf("GetItem: %v", err)
+	}
+}
+
+func TestWorkshopDownloadError(t *testing.T) {
+	setupFakeSteamCMD(t, `
+echo "Downloading item $7 ..."
+echo "ERROR! Download item $7 failed (Access Denied)."
+exit 0
+`)
+	_, err := NewWorkshopService().Download("123456")
+	if err == nil || !strings.Contains(err.Error(), "Access Denied") {
+		t.Fatalf("期望返回 steamcmd 的错误输出，实际为 %v", err)
+	}
+	if _, err := NewWorkshopService().GetItem("123456"); err == nil {
+		t.Error("下载失败的物品不应写入索引")
+	}
+}
+
+func TestWorkshopDownloadTimeout(t *testing.T) {
+	setupFakeSteamCMD(t, `
+echo "Downloading item $7 ..."
+exec sleep 30
+`)
+	old := steamcmdTimeout
+	steamcmdTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { steamcmdTimeout = old })
+
+	start := time.Now()
+	_, err := NewWorkshopService().Download("123456")
+	if err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Fatalf("期望超时错误，实际为 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("超时后等待过久: %v", elapsed)
+	}
+}
+
+func TestWorkshopDownloadInvalidID(t *testing.T) {
+	setupFakeSteamCMD(t, "exit 1\n")
+	for _, id := range []string{"", "abc", "1/../2", "123 456"} {
+		if _, err := NewWorkshopService().Download(id); err == nil {
+			t.Errorf("Download(%q) 应返回错误", id)
+		}
+	}
+}
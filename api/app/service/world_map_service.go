@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"terraria-api/config"
+	"terraria-api/utils"
+	"time"
+)
+
+// 地图渲染任务状态
+const (
+	WorldMapStateQueued    = "queued"
+	WorldMapStateRendering = "rendering"
+	WorldMapStateDone      = "done"
+	WorldMapStateFailed    = "failed"
+)
+
+const (
+	// 未指定缩放时地图的最大宽度（像素）
+	worldMapMaxWidth = 2100
+	// 每像素最多对应的图格数（边长）
+	worldMapMaxScale = 16
+	// 已结束的任务保留时长
+	worldMapJobRetention = time.Hour
+	// 超过该时长未访问的地图缓存会被清理
+	worldMapCacheRetention = 7 * 24 * time.Hour
+)
+
+// WorldMapJob 世界地图渲染任务
+type WorldMapJob struct {
+	ID         string     `json:"id"` // 与缓存文件名相同：世界哈希、配色和缩放
+	RoomID     uint       `json:"roomId"`
+	WorldName  string     `json:"worldName"`
+	WorldHash  string     `json:"worldHash"` // 世界文件的 SHA-256
+	Scale      int        `json:"scale"`     // 每像素对应 scale×scale 个图格
+	State      string     `json:"state"`
+	Progress   float64    `json:"progress"` // 0~1
+	Width      int        `json:"width"`    // 地图像素尺寸，完成后填写
+	Height     int        `json:"height"`
+	Cached     bool       `json:"cached"` // 直接使用已有的地图缓存
+	Error      string     `json:"error"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+
+	worldPath string
+	mapPath   string
+	palette   *utils.WorldMapPalette
+}
+
+// Finished 任务是否已结束
+func (j *WorldMapJob) Finished() bool {
+	return j.State == WorldMapStateDone || j.State == WorldMapStateFailed
+}
+
+// snapshot 复制任务的公开状态
+func (j *WorldMapJob) snapshot() WorldMapJob {
+	snapshot := *j
+	snapshot.palette = nil
+	return snapshot
+}
+
+// WorldMapService 世界地图渲染与缓存
+type WorldMapService struct {
+	mu     sync.Mutex
+	jobs   map[string]*WorldMapJob
+	hashes map[string]worldFileHash
+	slots  chan struct{}
+}
+
+// worldFileHash 按文件大小和修改时间缓存的哈希
+type worldFileHash struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// worldMapPaletteFile 配色文件格式，颜色为 #RRGGBB
+type worldMapPaletteFile struct {
+	Tiles       map[string]string `json:"tiles"` // 图格类型ID -> 颜色
+	Walls       map[string]string `json:"walls"` // 墙壁类型ID -> 颜色
+	Tile        string            `json:"tile"`
+	Wall        string            `json:"wall"`
+	Water       string            `json:"water"`
+	Lava        string            `json:"lava"`
+	Honey       string            `json:"honey"`
+	Shimmer     string            `json:"shimmer"`
+	Sky         string            `json:"sky"`
+	Underground string            `json:"underground"`
+	Cavern      string            `json:"cavern"`
+	Underworld  string            `json:"underworld"`
+}
+
+var (
+	worldMapServiceOnce     sync.Once
+	worldMapServiceInstance *WorldMapService
+)
+
+// NewWorldMapService 获取地图服务（全局共享任务列表）
+func NewWorldMapService() *WorldMapService {
+	worldMapServiceOnce.Do(func() {
+		worldMapServiceInstance = &WorldMapService{
+			jobs:   make(map[string]*WorldMapJob),
+			hashes: make(map[string]worldFileHash),
+			slots:  make(chan struct{}, 1), // 渲染占用较多内存和CPU，同时只执行一个
+		}
+	})
+	return worldMapServiceInstance
+}
+
+// GetMap 获取世界地图，已有缓存时返回图片路径，否则在后台开始渲染并返回任务
+// scale 为 0 时按地图最大宽度自动选择
+func (s *WorldMapService) GetMap(roomId uint, name string, scale int) (string, *WorldMapJob, error) {
+	job, err := s.Render(roomId, name, scale, false)
+	if err != nil {
+		return "", nil, err
+	}
+	if job.State == WorldMapStateDone {
+		path := worldMapPath(job.ID)
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return path, nil, nil
+	}
+	return "", job, nil
+}
+
+// Render 开始渲染世界地图，同一世界内容、配色和缩放只渲染一次
+// force 为 true 时忽略已有缓存重新渲染
+func (s *WorldMapService) Render(roomId uint, name string, scale int, force bool) (*WorldMapJob, error) {
+	if _, err := getWorldRoom(roomId); err != nil {
+		return nil, err
+	}
+	name, err := worldBaseName(name)
+	if err != nil {
+		return nil, err
+	}
+	if scale < 0 || scale > worldMapMaxScale {
+		return nil, fmt.Errorf("缩放必须在 1~%d 之间", worldMapMaxScale)
+	}
+	worldPath := filepath.Join(getRoomWorldsDir(roomId), worldFileName(name))
+	if _, err := os.Stat(worldPath); err != nil {
+		return nil, errors.New("世界文件不存在")
+	}
+	if scale == 0 {
+		info, err := utils.ReadWorldFile(worldPath)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取世界: %w", err)
+		}
+		scale = utils.WorldMapScale(info.Width, worldMapMaxWidth)
+	}
+
+	hash, err := s.worldHash(worldPath)
+	if err != nil {
+		return nil, err
+	}
+	palette, paletteHash, err := loadWorldMapPalette()
+	if err != nil {
+		return nil, err
+	}
+	id := fmt.Sprintf("%s-%s-s%d", hash[:16], paletteHash, scale)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked()
+	if job, ok := s.jobs[id]; ok && !job.Finished() {
+		snapshot := job.snapshot()
+		return &snapshot, nil
+	}
+	now := time.Now()
+	job := &WorldMapJob{
+		ID:        id,
+		RoomID:    roomId,
+		WorldName: name,
+		WorldHash: hash,
+		Scale:     scale,
+		State:     WorldMapStateQueued,
+		CreatedAt: now,
+		worldPath: worldPath,
+		mapPath:   worldMapPath(id),
+		palette:   palette,
+	}
+	if !force {
+		if cfg, err := readPNGSize(job.mapPath); err == nil {
+			job.State, job.Progress, job.Cached = WorldMapStateDone, 1, true
+			job.Width, job.Height = cfg.Width, cfg.Height
+			job.FinishedAt = &now
+			snapshot := job.snapshot()
+			return &snapshot, nil
+		}
+	}
+	s.jobs[id] = job
+
+	go s.run(job)
+
+	snapshot := job.snapshot()
+	return &snapshot, nil
+}
+
+// run 在后台渲染地图并写入缓存
+func (s *WorldMapService) run(job *WorldMapJob) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	s.update(job, func() { job.State = WorldMapStateRendering })
+	start := time.Now()
+	err := s.render(job)
+	now := time.Now()
+	s.update(job, func() {
+		job.FinishedAt = &now
+		if err != nil {
+			job.State, job.Error = WorldMapStateFailed, err.Error()
+			return
+		}
+		job.State, job.Progress = WorldMapStateDone, 1
+	})
+	if err != nil {
+		log.Printf("❌ 房间 %d 世界 %s 地图渲染失败: %v", job.RoomID, job.WorldName, err)
+		return
+	}
+	log.Printf("✅ 房间 %d 世界 %s 地图渲染完成（%dx%d，耗时 %s）", job.RoomID, job.WorldName, job.Width, job.Height, time.Since(start).Round(time.Millisecond))
+	s.pruneCache()
+}
+
+func (s *WorldMapService) render(job *WorldMapJob) error {
+	lastReport := time.Time{}
+	img, _, err := utils.RenderWorldMap(context.Background(), job.worldPath, job.palette, job.Scale, func(p float64) {
+		if time.Since(lastReport) < 200*time.Millisecond && p < 1 {
+			return
+		}
+		lastReport = time.Now()
+		s.update(job, func() { job.Progress = p })
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(job.mapPath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(job.mapPath), ".map-*.png")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), job.mapPath); err != nil {
+		return err
+	}
+	s.update(job, func() {
+		job.Width, job.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	})
+	return nil
+}
+
+// update 修改任务状态
+func (s *WorldMapService) update(job *WorldMapJob, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// worldHash 计算世界文件的 SHA-256，文件未变化时复用上次的结果
+func (s *WorldMapService) worldHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	cached, ok := s.hashes[path]
+	s.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	s.hashes[path] = worldFileHash{size: info.Size(), modTime: info.ModTime(), hash: hash}
+	s.mu.Unlock()
+	return hash, nil
+}
+
+// worldMapPath 地图缓存文件路径
+func worldMapPath(id string) string {
+	return filepath.Join(config.GlobalConfig.DataPath, "maps", id+".png")
+}
+
+// pruneLocked 清理过期的已结束任务
+func (s *WorldMapService) pruneLocked() {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > worldMapJobRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// pruneCache 删除长时间未访问的地图缓存
+func (s *WorldMapService) pruneCache() {
+	dir := filepath.Join(config.GlobalConfig.DataPath, "maps")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || filepath.Ext(entry.Name()) != ".png" {
+			continue
+		}
+		if time.Since(info.ModTime()) > worldMapCacheRetention {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// readPNGSize 读取已缓存地图的尺寸
+func readPNGSize(path string) (image.Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer f.Close()
+	return png.DecodeConfig(f)
+}
+
+// loadWorldMapPalette 读取配色文件（未配置的颜色使用默认值），返回配色和用于缓存文件名的标识
+func loadWorldMapPalette() (*utils.WorldMapPalette, string, error) {
+	palette := utils.DefaultWorldMapPalette()
+	data, err := os.ReadFile(config.GlobalConfig.MapPalette)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return palette, "default", nil
+		}
+		return nil, "", fmt.Errorf("读取地图配色失败: %w", err)
+	}
+
+	var file worldMapPaletteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, "", fmt.Errorf("地图配色格式错误: %w", err)
+	}
+	for _, group := range []struct {
+		colors map[string]string
+		target map[int]color.RGBA
+	}{{file.Tiles, palette.Tiles}, {file.Walls, palette.Walls}} {
+		for idStr, hexColor := range group.colors {
+			id, err := strconv.Atoi(idStr)
+			if err != nil || id < 0 {
+				return nil, "", fmt.Errorf("地图配色中的类型ID无效: %s", idStr)
+			}
+			c, err := parseHexColor(hexColor)
+			if err != nil {
+				return nil, "", err
+			}
+			group.target[id] = c
+		}
+	}
+	for _, field := range []struct {
+		value  string
+		target *color.RGBA
+	}{
+		{file.Tile, &palette.Tile}, {file.Wall, &palette.Wall},
+		{file.Water, &palette.Water}, {file.Lava, &palette.Lava}, {file.Honey, &palette.Honey}, {file.Shimmer, &palette.Shimmer},
+		{file.Sky, &palette.Sky}, {file.Underground, &palette.Underground}, {file.Cavern, &palette.Cavern}, {file.Underworld, &palette.Underworld},
+	} {
+		if field.value == "" {
+			continue
+		}
+		c, err := parseHexColor(field.value)
+		if err != nil {
+			return nil, "", err
+		}
+		*field.target = c
+	}
+
+	sum := sha256.Sum256(data)
+	return palette, hex.EncodeToString(sum[:4]), nil
+}
+
+// parseHexColor 解析 #RRGGBB 格式的颜色
+func parseHexColor(s string) (color.RGBA, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(v) != 6 {
+		return color.RGBA{}, fmt.Errorf("无效的颜色: %s", s)
+	}
+	n, err := strconv.ParseUint(v, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("无效的颜色: %s", s)
+	}
+	return color.RGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 0xFF}, nil
+}
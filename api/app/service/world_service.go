@@ -0,0 +1,317 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"terraria-api/app/model"
+	"terraria-api/utils"
+	"time"
+)
+
+// WorldService 房间世界文件管理服务
+type WorldService struct{}
+
+// NewWorldService 创建世界服务
+func NewWorldService() *WorldService {
+	return &WorldService{}
+}
+
+// WorldFile 房间 Worlds 目录中的世界
+type WorldFile struct {
+	Name      string            `json:"name"` // 世界文件名去掉 .wld
+	FileName  string            `json:"fileName"`
+	Size      int64             `json:"size"`
+	Modified  time.Time         `json:"modified"`
+	Active    bool              `json:"active"` // 房间启动时加载的世界
+	Backups   []WorldBackupFile `json:"backups"`
+	Info      *model.WorldInfo  `json:"info"`      // 世界文件头部信息，无法解析时为空或只有部分字段
+	InfoError string            `json:"infoError"` // 文件损坏或版本不支持的原因
+}
+
+// WorldBackupFile 服务端保存世界时生成的备份（.bak / .bak2）
+type WorldBackupFile struct {
+	Kind     string    `json:"kind"` // bak / bak2
+	FileName string    `json:"fileName"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// SwitchWorldResult 切换世界的结果
+type SwitchWorldResult struct {
+	WorldName       string `json:"worldName"`
+	RestartRequired bool   `json:"restartRequired"`
+	Message         string `json:"message"`
+}
+
+// 世界的备份文件后缀
+var worldBackupKinds = []string{"bak", "bak2"}
+
+// GetWorlds 获取房间的世界列表
+func (s *WorldService) GetWorlds(roomId uint) ([]WorldFile, error) {
+	room, err := getWorldRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(getRoomWorldsDir(roomId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []WorldFile{}, nil
+		}
+		return nil, err
+	}
+
+	activeFile := worldFileName(room.WorldName)
+	worlds := []WorldFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".wld") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		world := WorldFile{
+			Name:     strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())),
+			FileName: entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			Active:   entry.Name() == activeFile,
+			Backups:  []WorldBackupFile{},
+		}
+		var infoErr error
+		world.Info, infoErr = utils.ReadWorldFile(filepath.Join(getRoomWorldsDir(roomId), entry.Name()))
+		world.InfoError = errorText(infoErr)
+		for _, kind := range worldBackupKinds {
+			backupName := entry.Name() + "." + kind
+			if info, err := os.Stat(filepath.Join(getRoomWorldsDir(roomId), backupName)); err == nil {
+				world.Backups = append(world.Backups, WorldBackupFile{
+					Kind:     kind,
+					FileName: backupName,
+					Size:     info.Size(),
+					Modified: info.ModTime(),
+				})
+			}
+		}
+		worlds = append(worlds, world)
+	}
+
+	sort.Slice(worlds, func(i, j int) bool {
+		return worlds[i].Modified.After(worlds[j].Modified)
+	})
+	return worlds, nil
+}
+
+// UploadWorld 上传世界文件，同名世界会被覆盖（运行中房间的当前世界除外）
+func (s *WorldService) UploadWorld(roomId uint, fileHeader *multipart.FileHeader) (*WorldFile, error) {
+	room, err := getWorldRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(fileHeader.Filename), ".wld") {
+		return nil, errors.New("只能上传 .wld 世界文件")
+	}
+	name, err := worldBaseName(strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename)))
+	if err != nil {
+		return nil, err
+	}
+	if worldFileName(name) == worldFileName(room.WorldName) && room.Status != model.StatusStopped && room.Status != model.StatusError {
+		return nil, errors.New("不能覆盖运行中房间正在使用的世界，请先停止服务器")
+	}
+
+	worldsDir := getRoomWorldsDir(roomId)
+	if err := os.MkdirAll(worldsDir, 0755); err != nil {
+		return nil, err
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// 先写临时文件，完整写入后再替换
+	tmp, err := os.CreateTemp(worldsDir, ".upload-*.wld")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, src)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, errors.New("世界文件为空")
+	}
+	// 版本不支持或部分损坏的世界仍允许上传，只拒绝不是世界文件的内容
+	info, infoErr := utils.ReadWorldFile(tmp.Name())
+	if errors.Is(infoErr, utils.ErrNotWorldFile) {
+		return nil, infoErr
+	}
+
+	target := filepath.Join(worldsDir, worldFileName(name))
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	return &WorldFile{
+		Name:      name,
+		FileName:  filepath.Base(target),
+		Size:      stat.Size(),
+		Modified:  stat.ModTime(),
+		Active:    filepath.Base(target) == worldFileName(room.WorldName),
+		Backups:   []WorldBackupFile{},
+		Info:      info,
+		InfoError: errorText(infoErr),
+	}, nil
+}
+
+// GetWorldFilePath 获取世界文件（或其备份）的路径，用于下载
+func (s *WorldService) GetWorldFilePath(roomId uint, name, backup string) (string, error) {
+	if _, err := getWorldRoom(roomId); err != nil {
+		return "", err
+	}
+	name, err := worldBaseName(name)
+	if err != nil {
+		return "", err
+	}
+
+	fileName := worldFileName(name)
+	if backup != "" {
+		if backup != "bak" && backup != "bak2" {
+			return "", fmt.Errorf("无效的备份类型: %s", backup)
+		}
+		fileName += "." + backup
+	}
+
+	path := filepath.Join(getRoomWorldsDir(roomId), fileName)
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", errors.New("世界文件不存在")
+	}
+	return path, nil
+}
+
+// DeleteWorld 删除世界及其备份（tModLoader 的 .twld 一并删除），不能删除运行中房间的当前世界
+func (s *WorldService) DeleteWorld(roomId uint, name string) error {
+	room, err := getWorldRoom(roomId)
+	if err != nil {
+		return err
+	}
+	name, err = worldBaseName(name)
+	if err != nil {
+		return err
+	}
+	if worldFileName(name) == worldFileName(room.WorldName) && room.Status != model.StatusStopped && room.Status != model.StatusError {
+		return errors.New("不能删除运行中房间正在使用的世界，请先停止服务器")
+	}
+
+	worldsDir := getRoomWorldsDir(roomId)
+	if _, err := os.Stat(filepath.Join(worldsDir, worldFileName(name))); err != nil {
+		return errors.New("世界文件不存在")
+	}
+
+	base := strings.TrimSuffix(worldFileName(name), ".wld")
+	for _, ext := range []string{".wld", ".twld"} {
+		for _, suffix := range append([]string{""}, ".bak", ".bak2") {
+			if err := os.Remove(filepath.Join(worldsDir, base+ext+suffix)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SwitchWorld 设置房间启动时加载的世界，并重新生成服务端配置
+// 运行中的房间需要重启后才会加载新世界
+func (s *WorldService) SwitchWorld(roomId uint, name string) (*SwitchWorldResult, error) {
+	room, err := getWorldRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+	name, err = worldBaseName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(getRoomWorldsDir(roomId), worldFileName(name))); err != nil {
+		return nil, errors.New("世界文件不存在")
+	}
+	if room.Status == model.StatusStarting || room.Status == model.StatusStopping {
+		return nil, fmt.Errorf("房间正在%s，请稍后再试", map[model.ServerStatus]string{model.StatusStarting: "启动", model.StatusStopping: "停止"}[room.Status])
+	}
+
+	// 先写配置再更新数据库，任一步失败都恢复原来的世界，保证两者一致
+	previous := room.WorldName
+	room.WorldName = name
+	if _, err := writeServerConfig(room); err != nil {
+		room.WorldName = previous
+		writeServerConfig(room)
+		return nil, fmt.Errorf("生成服务端配置失败: %w", err)
+	}
+	if err := utils.DB.Model(&model.Room{}).Where("id = ?", roomId).Update("world_name", name).Error; err != nil {
+		room.WorldName = previous
+		writeServerConfig(room)
+		return nil, err
+	}
+
+	result := &SwitchWorldResult{WorldName: name, Message: "已切换世界，下次启动时加载"}
+	if room.Status == model.StatusRunning {
+		result.RestartRequired = true
+		result.Message = "已切换世界，需要重启服务器后生效"
+	}
+	return result, nil
+}
+
+// FillRoomWorld 读取房间当前世界的头部信息（世界尚未生成时不填写）
+func (s *WorldService) FillRoomWorld(room *model.Room) {
+	path := filepath.Join(getRoomWorldsDir(room.ID), worldFileName(room.WorldName))
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	info, err := utils.ReadWorldFile(path)
+	room.World, room.WorldError = info, errorText(err)
+}
+
+// errorText 错误信息，无错误时为空
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// getWorldRoom 获取房间（含世界配置，用于生成服务端配置）
+func getWorldRoom(roomId uint) (*model.Room, error) {
+	var room model.Room
+	if err := utils.DB.Preload("WorldConfig").First(&room, roomId).Error; err != nil {
+		return nil, errors.New("房间不存在")
+	}
+	return &room, nil
+}
+
+// worldBaseName 校验世界名称（不含 .wld），防止路径穿越
+func worldBaseName(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".wld")
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("无效的世界名称: %s", name)
+	}
+	if strings.TrimSuffix(worldFileName(name), ".wld") != name {
+		return "", fmt.Errorf("世界名称包含非法字符: %s", name)
+	}
+	return name, nil
+}
@@ -4,12 +4,49 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // Config 全局配置
 type Config struct {
-	DBPath     string
+	DBPath string
+	// ServerPath 游戏服务端安装目录
 	ServerPath string
+	// DataPath 数据目录（模组包、缓存等）
+	DataPath string
+
+	// PluginRegistry 插件注册表地址（本地JSON文件路径或HTTP URL）
+	PluginRegistry string
+	// PluginRegistryRefresh 插件注册表刷新间隔
+	PluginRegistryRefresh time.Duration
+
+	// SteamCMDPath steamcmd 可执行文件路径
+	SteamCMDPath string
+	// ModUpdateInterval Mod更新检查间隔
+	ModUpdateInterval time.Duration
+
+	// DownloadMirrors 下载镜像配置文件（URL改写规则）
+	DownloadMirrors string
+
+	// ReleaseAPIBase GitHub API 地址（可替换为本地兼容服务）
+	ReleaseAPIBase string
+	// VersionOverrides 本地版本覆盖文件（原版服务端等）
+	VersionOverrides string
+	// VersionCatalogRefresh 版本目录刷新间隔
+	VersionCatalogRefresh time.Duration
+
+	// DotnetDownloadURL .NET 运行时下载地址模板，支持 {version} {os} {arch} {ext}
+	DotnetDownloadURL string
+
+	// ProgressionInterval 运行中房间的世界进度快照间隔
+	ProgressionInterval time.Duration
+
+	// MapPalette 世界地图配色文件
+	MapPalette string
+
+	// BackupLocalRoots 本地备份存储允许使用的目录，本地存储的路径必须位于其中之一
+	BackupLocalRoots []string
 }
 
 var GlobalConfig *Config
@@ -17,13 +54,27 @@ var GlobalConfig *Config
 // Init 初始化配置
 func Init(dbPath string) {
 	GlobalConfig = &Config{
-		DBPath:     dbPath,
-		ServerPath: "./terraria_servers",
+		DBPath:                dbPath,
+		ServerPath:            getEnv("TERRARIA_INSTALL_DIR", "./terraria_servers"),
+		DataPath:              getEnv("TERRARIA_DATA_DIR", "./data"),
+		PluginRegistry:        getEnv("TERRARIA_PLUGIN_REGISTRY", filepath.Join(dbPath, "plugin_registry.json")),
+		PluginRegistryRefresh: getEnvDuration("TERRARIA_PLUGIN_REGISTRY_REFRESH", time.Hour),
+		SteamCMDPath:          getEnv("TERRARIA_STEAMCMD", "steamcmd"),
+		ModUpdateInterval:     getEnvDuration("TERRARIA_MOD_UPDATE_INTERVAL", 6*time.Hour),
+		DownloadMirrors:       getEnv("TERRARIA_DOWNLOAD_MIRRORS", filepath.Join(dbPath, "download_mirrors.json")),
+		ReleaseAPIBase:        getEnv("TERRARIA_RELEASE_API", "https://api.github.com"),
+		VersionOverrides:      getEnv("TERRARIA_VERSION_OVERRIDES", filepath.Join(dbPath, "versions.json")),
+		VersionCatalogRefresh: getEnvDuration("TERRARIA_VERSION_REFRESH", time.Hour),
+		DotnetDownloadURL:     getEnv("TERRARIA_DOTNET_URL", "https://builds.dotnet.microsoft.com/dotnet/Runtime/{version}/dotnet-runtime-{version}-{os}-{arch}.{ext}"),
+		ProgressionInterval:   getEnvDuration("TERRARIA_PROGRESSION_INTERVAL", 10*time.Minute),
+		MapPalette:            getEnv("TERRARIA_MAP_PALETTE", filepath.Join(dbPath, "map_palette.json")),
+		BackupLocalRoots:      getEnvList("TERRARIA_BACKUP_LOCAL_ROOTS"),
 	}
 
 	// 确保目录存在
 	ensureDir(dbPath)
 	ensureDir(GlobalConfig.ServerPath)
+	ensureDir(GlobalConfig.DataPath)
 
 	log.Println("✅ 配置初始化成功")
 }
@@ -37,6 +88,39 @@ func ensureDir(dir string) {
 	}
 }
 
+// getEnv 读取环境变量，未设置时返回默认值
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvList 读取路径列表类型的环境变量（按系统的路径分隔符分隔，Linux 为 :）
+func getEnvList(key string) []string {
+	var list []string
+	for _, v := range filepath.SplitList(os.Getenv(key)) {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// getEnvDuration 读取时长类型的环境变量（如 30m、2h）
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ 环境变量 %s 格式错误，使用默认值 %s", key, def)
+		return def
+	}
+	return d
+}
+
 // GetServerPath 获取服务器路径
 func GetServerPath(roomID uint, serverType string) string {
 	return filepath.Join(GlobalConfig.ServerPath, serverType, string(rune(roomID)))
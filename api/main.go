@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"terraria-api/app/router"
+	"terraria-api/app/service"
 	"terraria-api/config"
 	"terraria-api/utils"
 
@@ -31,6 +32,18 @@ func main() {
 	// 初始化数据库
 	utils.InitDB(*dbPath)
 
+	// 启动插件注册表定时刷新
+	service.NewPluginRegistryService().StartAutoRefresh()
+
+	// 启动Mod定时更新检查
+	service.NewModUpdateService().StartAutoCheck()
+
+	// 启动运行中房间的进度快照
+	service.NewProgressionService().StartAutoSnapshot()
+
+	// 启动房间定时备份
+	service.NewBackupService().StartScheduler()
+
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -0,0 +1,419 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractOptions 解压选项
+type ExtractOptions struct {
+	// StripTopLevel 归档内只有一个顶层目录时，去掉该目录直接解压其内容
+	StripTopLevel bool
+}
+
+// archiveEntry zip 和 tar 条目的统一表示
+type archiveEntry struct {
+	name     string
+	mode     os.FileMode
+	linkname string // 符号链接或硬链接的目标
+	hardlink bool
+	open     func() (io.ReadCloser, error)
+}
+
+// ExtractArchive 解压 zip、tar 或 tar.gz 归档到目标目录（按文件头识别格式）
+// 拒绝越出目标目录的路径和符号链接，保留文件的可执行权限
+func ExtractArchive(ctx context.Context, archivePath, destDir string, opts ExtractOptions) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	switch {
+	case n >= 4 && string(magic) == "PK\x03\x04", n >= 4 && string(magic) == "PK\x05\x06":
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return fmt.Errorf("zip格式错误: %w", err)
+		}
+		return ExtractZip(ctx, zr, destDir, opts)
+	case n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return extractTarFile(ctx, f, true, destDir, opts)
+	default:
+		return extractTarFile(ctx, f, false, destDir, opts)
+	}
+}
+
+// ExtractZip 解压已打开的 zip 归档
+func ExtractZip(ctx context.Context, zr *zip.Reader, destDir string, opts ExtractOptions) error {
+	entries := make([]archiveEntry, 0, len(zr.File))
+	for _, f := range zr.File {
+		f := f
+		entry := archiveEntry{
+			name: f.Name,
+			mode: f.Mode(),
+			open: f.Open,
+		}
+		if entry.mode&os.ModeSymlink != 0 {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			target, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			entry.linkname = string(target)
+		}
+		entries = append(entries, entry)
+	}
+
+	names := make([]string, len(entries))
+	for i := range entries {
+		names[i] = entries[i].name
+	}
+	prefix := ""
+	if opts.StripTopLevel {
+		prefix = singleTopLevelDir(names)
+	}
+
+	x := &extractor{destDir: destDir, prefix: prefix}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := x.extract(entry); err != nil {
+			return err
+		}
+	}
+	return x.verifySymlinks()
+}
+
+// extractTarFile tar 需要顺序读取，去掉顶层目录时先扫描一遍条目名
+func extractTarFile(ctx context.Context, f *os.File, gzipped bool, destDir string, opts ExtractOptions) error {
+	openTar := func() (*tar.Reader, func(), error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+		var r io.Reader = bufio.NewReader(f)
+		closeFn := func() {}
+		if gzipped {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, nil, fmt.Errorf("gzip格式错误: %w", err)
+			}
+			r = gz
+			closeFn = func() { gz.Close() }
+		}
+		return tar.NewReader(r), closeFn, nil
+	}
+
+	prefix := ""
+	if opts.StripTopLevel {
+		tr, closeFn, err := openTar()
+		if err != nil {
+			return err
+		}
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				closeFn()
+				return fmt.Errorf("tar格式错误: %w", err)
+			}
+			if hdr.Typeflag == tar.TypeXGlobalHeader {
+				continue
+			}
+			names = append(names, hdr.Name)
+		}
+		closeFn()
+		prefix = singleTopLevelDir(names)
+	}
+
+	tr, closeFn, err := openTar()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	x := &extractor{destDir: destDir, prefix: prefix}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return x.verifySymlinks()
+		}
+		if err != nil {
+			return fmt.Errorf("tar格式错误: %w", err)
+		}
+
+		entry := archiveEntry{
+			name: hdr.Name,
+			mode: hdr.FileInfo().Mode(),
+			open: func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeRegA:
+		case tar.TypeSymlink:
+			entry.linkname = hdr.Linkname
+		case tar.TypeLink:
+			entry.linkname = hdr.Linkname
+			entry.hardlink = true
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			// 设备文件、管道等不解压
+			continue
+		}
+		if err := x.extract(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// extractor 执行单个条目的解压
+type extractor struct {
+	destDir  string
+	prefix   string   // 需要去掉的顶层目录（含末尾的 /）
+	symlinks []string // 已创建的符号链接，解压结束后统一校验实际指向
+}
+
+func (x *extractor) extract(entry archiveEntry) error {
+	name := strings.TrimPrefix(normalizeArchiveName(entry.name), x.prefix)
+	if name == "" || name == "." || name == "/" {
+		return nil
+	}
+
+	target, err := SafeArchiveJoin(x.destDir, name)
+	if err != nil {
+		return err
+	}
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+
+	switch {
+	case entry.mode.IsDir():
+		return os.MkdirAll(target, dirMode(entry.mode))
+
+	case entry.mode&os.ModeSymlink != 0:
+		linkTarget := entry.linkname
+		if filepath.IsAbs(linkTarget) || path.IsAbs(linkTarget) {
+			return fmt.Errorf("归档中的符号链接指向绝对路径: %s -> %s", entry.name, linkTarget)
+		}
+		resolved := filepath.Join(filepath.Dir(target), filepath.FromSlash(linkTarget))
+		if !isWithinDir(x.destDir, resolved) {
+			return fmt.Errorf("归档中的符号链接越出目标目录: %s -> %s", entry.name, linkTarget)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Symlink(linkTarget, target); err != nil {
+			return err
+		}
+		x.symlinks = append(x.symlinks, target)
+		return nil
+
+	case entry.hardlink:
+		linkName := strings.TrimPrefix(normalizeArchiveName(entry.linkname), x.prefix)
+		source, err := SafeArchiveJoin(x.destDir, linkName)
+		if err != nil {
+			return err
+		}
+		if err := x.checkParents(source); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return copyRegularFile(source, target, entry.mode)
+
+	default:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		rc, err := entry.open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return writeRegularFile(target, rc, entry.mode)
+	}
+}
+
+// verifySymlinks 按实际解析结果校验符号链接，防止多个链接组合后指向目录外
+func (x *extractor) verifySymlinks() error {
+	dest, err := filepath.EvalSymlinks(x.destDir)
+	if err != nil {
+		return err
+	}
+	for _, link := range x.symlinks {
+		resolved, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			// 指向不存在的文件，无法越出目标目录
+			continue
+		}
+		if !isWithinDir(dest, resolved) {
+			os.Remove(link)
+			return fmt.Errorf("归档中的符号链接越出目标目录: %s", link)
+		}
+	}
+	return nil
+}
+
+// checkParents 确认目标路径的上级目录中没有指向目录外的符号链接
+func (x *extractor) checkParents(target string) error {
+	rel, err := filepath.Rel(x.destDir, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return nil
+	}
+	current := x.destDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if err != nil {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(current)
+		if err != nil {
+			return err
+		}
+		dest, err := filepath.EvalSymlinks(x.destDir)
+		if err != nil {
+			return err
+		}
+		if !isWithinDir(dest, resolved) {
+			return fmt.Errorf("归档路径经由符号链接越出目标目录: %s", target)
+		}
+	}
+	return nil
+}
+
+// SafeArchiveJoin 将归档内的路径拼接到目标目录，拒绝绝对路径和越出目标目录的路径
+func SafeArchiveJoin(destDir, name string) (string, error) {
+	if !IsSafeArchivePath(name) {
+		return "", fmt.Errorf("归档中包含非法路径: %s", name)
+	}
+	target := filepath.Join(destDir, filepath.FromSlash(path.Clean(name)))
+	if !isWithinDir(destDir, target) {
+		return "", fmt.Errorf("归档中包含非法路径: %s", name)
+	}
+	return target, nil
+}
+
+// IsSafeArchivePath 检查归档内路径不会越出目标目录
+func IsSafeArchivePath(name string) bool {
+	if name == "" || strings.Contains(name, "\\") || path.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	clean := path.Clean(name)
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// isWithinDir 判断 target 是否位于 dir 之内（或等于 dir）
+func isWithinDir(dir, target string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(target))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// singleTopLevelDir 所有条目都位于同一个顶层目录下时返回该目录（含末尾 /），否则返回空
+func singleTopLevelDir(names []string) string {
+	top := ""
+	for _, name := range names {
+		name = normalizeArchiveName(name)
+		if name == "" {
+			continue
+		}
+		first, _, nested := strings.Cut(name, "/")
+		if !nested || (top != "" && first != top) {
+			return ""
+		}
+		top = first
+	}
+	if top == "" {
+		return ""
+	}
+	return top + "/"
+}
+
+// normalizeArchiveName 统一分隔符并去掉开头的 ./
+func normalizeArchiveName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	for strings.HasPrefix(name, "./") {
+		name = name[2:]
+	}
+	return name
+}
+
+// writeRegularFile 写入文件并保留权限位（至少保证所有者可读写）
+func writeRegularFile(target string, r io.Reader, mode os.FileMode) error {
+	os.Remove(target)
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode(mode))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// OpenFile 的权限受 umask 影响，这里显式设置以保留可执行位
+	return os.Chmod(target, fileMode(mode))
+}
+
+// copyRegularFile 复制已解压的文件（用于 tar 硬链接），条目未记录权限时沿用源文件的权限
+func copyRegularFile(source, target string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return errors.New("硬链接指向的文件不存在: " + source)
+	}
+	defer in.Close()
+	if mode.Perm() == 0 {
+		if info, err := in.Stat(); err == nil {
+			mode = info.Mode()
+		}
+	}
+	return writeRegularFile(target, in, mode)
+}
+
+func fileMode(mode os.FileMode) os.FileMode {
+	return mode.Perm() | 0600
+}
+
+func dirMode(mode os.FileMode) os.FileMode {
+	return mode.Perm() | 0700
+}
@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// testArchiveEntry 测试归档中的条目，linkname 非空时为链接
+type testArchiveEntry struct {
+	name     string
+	body     string
+	linkname string
+	hardlink bool
+	dir      bool
+}
+
+func buildTestZip(t *testing.T, entries []testArchiveEntry) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		switch {
+		case e.dir:
+			hdr.SetMode(os.ModeDir | 0755)
+		case e.linkname != "":
+			hdr.SetMode(os.ModeSymlink | 0777)
+			body = e.linkname
+		default:
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+// buildTestTar 生成 tar（gzipped 时为 tar.gz）并写入临时文件
+func buildTestTar(t *testing.T, entries []testArchiveEntry, gzipped bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		switch {
+		case e.dir:
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		case e.hardlink:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e.linkname, 0
+		case e.linkname != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Mode, hdr.Size = tar.TypeSymlink, e.linkname, 0777, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	archive := filepath.Join(t.TempDir(), "test.tar")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func extractTestTar(t *testing.T, entries []testArchiveEntry, dest string, opts ExtractOptions) error {
+	t.Helper()
+	f, err := os.Open(buildTestTar(t, entries, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return extractTarFile(context.Background(), f, false, dest, opts)
+}
+
+// testExtractDirs 返回目标目录和与其同级的外部目录，越界写入会落在外部目录中
+func testExtractDirs(t *testing.T) (dest, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	dest = filepath.Join(base, "dest")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{dest, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dest, outside
+}
+
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) > 0 {
+		t.Errorf("%s 中不应写入文件，实际有 %s", dir, entries[0].Name())
+	}
+}
+
+func TestExtractRejectsUnsafePaths(t *testing.T) {
+	names := []string{"../outside/evil.txt", "a/../../outside/evil.txt", "/tmp/evil.txt", `..\outside\evil.txt`}
+	for _, name := range names {
+		entries := []testArchiveEntry{{name: name, body: "evil"}}
+
+		dest, outside := testExtractDirs(t)
+		if err := ExtractZip(context.Background(), buildTestZip(t, entries), dest, ExtractOptions{}); err == nil {
+			t.Errorf("zip 条目 %q 应返回错误", name)
+		}
+		assertEmptyDir(t, outside)
+
+		dest, outside = testExtractDirs(t)
+		if err := extractTestTar(t, entries, dest, ExtractOptions{}); err == nil {
+			t.Errorf("tar 条目 %q 应返回错误", name)
+		}
+		assertEmptyDir(t, outside)
+	}
+}
+
+func TestExtractRejectsSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("需要创建符号链接")
+	}
+	tests := []struct {
+		name    string
+		entries []testArchiveEntry
+	}{
+		{"相对路径越界", []testArchiveEntry{
+			{name: "link", linkname: "../outside"},
+			{name: "link/evil.txt", body: "evil"},
+		}},
+		{"绝对路径", []testArchiveEntry{
+			{name: "link", linkname: "/tmp"},
+			{name: "link/evil.txt", body: "evil"},
+		}},
+		// 单独看每个链接都在目录内，组合后 b 指向目标目录的上级
+		{"链接组合", []testArchiveEntry{
+			{name: "a", linkname: "."},
+			{name: "a/b", linkname: ".."},
+			{name: "b/outside/evil.txt", body: "evil"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, outside := testExtractDirs(t)
+			if err := ExtractZip(context.Background(), buildTestZip(t, tt.entries), dest, ExtractOptions{}); err == nil {
+				t.Error("zip 应返回错误")
+			}
+			assertEmptyDir(t, outside)
+
+			dest, outside = testExtractDirs(t)
+			if err := extractTestTar(t, tt.entries, dest, ExtractOptions{}); err == nil {
+				t.Error("tar 应返回错误")
+			}
+			assertEmptyDir(t, outside)
+		})
+	}
+}
+
+func TestExtractVerifySymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("需要创建符号链接")
+	}
+	// 最后一个条目是组合后越界的链接，没有文件经由它写入，由 verifySymlinks 在结束时发现并删除
+	dest, _ := testExtractDirs(t)
+	entries := []testArchiveEntry{
+		{name: "a", linkname: "."},
+		{name: "a/b", linkname: ".."},
+	}
+	if err := extractTestTar(t, entries, dest, ExtractOptions{}); err == nil {
+		t.Fatal("越界的符号链接应返回错误")
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "b")); !os.IsNotExist(err) {
+		t.Error("越界的符号链接应被删除")
+	}
+
+	// 指向目录内的链接保留
+	dest, _ = testExtractDirs(t)
+	entries = []testArchiveEntry{
+		{name: "lib/real.so", body: "so"},
+		{name: "lib/current.so", linkname: "real.so"},
+	}
+	if err := extractTestTar(t, entries, dest, ExtractOptions{}); err != nil {
+		t.Fatalf("目录内的符号链接不应报错: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "lib", "current.so")); string(got) != "so" {
+		t.Errorf("符号链接内容不符: %q", got)
+	}
+}
+
+func TestExtractRejectsHardlinkEscape(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, linkname := range []string{"../outside/secret.txt", secret} {
+		dest, _ := testExtractDirs(t)
+		entries := []testArchiveEntry{{name: "copy.txt", linkname: linkname, hardlink: true}}
+		if err := extractTestTar(t, entries, dest, ExtractOptions{}); err == nil {
+			t.Errorf("指向 %s 的硬链接应返回错误", linkname)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "copy.txt")); !os.IsNotExist(err) {
+			t.Errorf("指向 %s 的硬链接不应创建文件", linkname)
+		}
+	}
+
+	// 指向归档内文件的硬链接复制为普通文件
+	dest, _ := testExtractDirs(t)
+	entries := []testArchiveEntry{
+		{name: "data.txt", body: "data"},
+		{name: "copy.txt", linkname: "data.txt", hardlink: true},
+	}
+	if err := extractTestTar(t, entries, dest, ExtractOptions{}); err != nil {
+		t.Fatalf("归档内的硬链接不应报错: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "copy.txt")); string(got) != "data" {
+		t.Errorf("硬链接内容不符: %q", got)
+	}
+}
+
+func TestExtractStripTopLevel(t *testing.T) {
+	entries := []testArchiveEntry{
+		{name: "server-1.0/", dir: true},
+		{name: "server-1.0/TerrariaServer", body: "bin"},
+		{name: "server-1.0/lib/a.dll", body: "dll"},
+	}
+	check := func(t *testing.T, dest string) {
+		t.Helper()
+		for name, want := range map[string]string{"TerrariaServer": "bin", "lib/a.dll": "dll"} {
+			if got, err := os.ReadFile(filepath.Join(dest, name)); err != nil || string(got) != want {
+				t.Errorf("%s 内容不符: %q, %v", name, got, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dest, "server-1.0")); !os.IsNotExist(err) {
+			t.Error("顶层目录应被去掉")
+		}
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		dest, _ := testExtractDirs(t)
+		if err := ExtractZip(context.Background(), buildTestZip(t, entries), dest, ExtractOptions{StripTopLevel: true}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, dest)
+	})
+	t.Run("tar.gz", func(t *testing.T) {
+		dest, _ := testExtractDirs(t)
+		if err := ExtractArchive(context.Background(), buildTestTar(t, entries, true), dest, ExtractOptions{StripTopLevel: true}); err != nil {
+			t.Fatal(err)
+		}
+		check(t, dest)
+	})
+
+	// 有多个顶层条目时不去掉
+	dest, _ := testExtractDirs(t)
+	multi := append(entries, testArchiveEntry{name: "README.txt", body: "readme"})
+	if err := extractTestTar(t, multi, dest, ExtractOptions{StripTopLevel: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "server-1.0", "TerrariaServer")); err != nil {
+		t.Errorf("多个顶层条目时不应去掉目录: %v", err)
+	}
+}
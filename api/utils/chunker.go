@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"io"
+)
+
+// 分块大小：最小 16KB、平均约 64KB、最大 256KB
+const (
+	ChunkMinSize = 16 << 10
+	ChunkAvgSize = 64 << 10
+	ChunkMaxSize = 256 << 10
+)
+
+// 达到平均大小前使用更严格的掩码（更难切分），之后使用更宽松的掩码，使块大小集中在平均值附近
+// 只取哈希的高位：gear 哈希每次左移，低位只受最近几个字节影响
+const (
+	chunkMaskS = uint64(1<<18-1) << (64 - 18)
+	chunkMaskL = uint64(1<<14-1) << (64 - 14)
+)
+
+// gearTable 每个字节值对应的随机数，由固定种子生成
+// 修改后切分位置会变化，新备份将无法复用已有的块（不影响已有备份的恢复）
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x7465727261726961) // "terraria"
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker 按内容切分数据（FastCDC）。切分位置只取决于附近的内容，
+// 文件中间插入或删除数据时只有附近的块会变化，其余块可以在增量备份中复用
+type Chunker struct {
+	r          io.Reader
+	buf        []byte
+	start, end int
+	eof        bool
+}
+
+// NewChunker 创建分块器
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{r: r, buf: make([]byte, 4*ChunkMaxSize)}
+}
+
+// Next 返回下一个块，数据读完时返回 io.EOF
+// 返回的切片在下次调用前有效，需要保留时调用方自行复制
+func (c *Chunker) Next() ([]byte, error) {
+	if c.end-c.start < ChunkMaxSize && !c.eof {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		c.end += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := chunkCutPoint(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// chunkCutPoint 在 data 中找到第一个切分位置，返回块的长度
+func chunkCutPoint(data []byte) int {
+	n := len(data)
+	if n <= ChunkMinSize {
+		return n
+	}
+	if n > ChunkMaxSize {
+		n = ChunkMaxSize
+	}
+	normal := ChunkAvgSize
+	if normal > n {
+		normal = n
+	}
+
+	var h uint64
+	i := ChunkMinSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&chunkMaskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&chunkMaskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -30,6 +30,19 @@ func InitDB(dbPath string) {
 		&model.TShockConfig{},
 		&model.TModLoaderConfig{},
 		&model.Player{},
+		&model.RoomPlugin{},
+		&model.ModPack{},
+		&model.WorkshopItem{},
+		&model.InstalledMod{},
+		&model.ConfigRevision{},
+		&model.Installation{},
+		&model.RoomUpgrade{},
+		&model.ProgressionSnapshot{},
+		&model.ProgressionEvent{},
+		&model.Backup{},
+		&model.BackupSchedule{},
+		&model.BackupTarget{},
+		&model.BackupCopy{},
 	)
 	if err != nil{
 		log.Fatalf("❌ 数据库迁移失败: %v", err)
@@ -37,3 +37,12 @@ func ResponseErrorWithCode(c *gin.Context, code string, msg string) {
 		Msg:  msg,
 	})
 }
+
+// ResponseErrorWithData 带数据的错误响应（如需要用户确认的详细信息）
+func ResponseErrorWithData(c *gin.Context, msg string, data interface{}) {
+	c.JSON(200, Response{
+		Code: "1",
+		Data: data,
+		Msg:  msg,
+	})
+}
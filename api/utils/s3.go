@@ -0,0 +1,401 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash 空请求体的 SHA-256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config S3 兼容存储（AWS S3、MinIO、R2 等）的连接参数
+type S3Config struct {
+	Endpoint  string // 如 https://s3.amazonaws.com、http://127.0.0.1:9000
+	Region    string // 为空时使用 us-east-1
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // 使用 endpoint/bucket/key 形式的地址（MinIO 等自建服务一般需要）
+}
+
+// S3Client 只包含备份需要的几个操作，请求使用 AWS Signature V4 签名
+// 带请求体的请求都附带 Content-MD5 和签名的 SHA-256，服务端据此校验数据完整性
+type S3Client struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// S3Object 列表中的对象
+type S3Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	ETag         string    `json:"etag"`
+}
+
+// S3Part 分片上传完成后的分片
+type S3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// S3Error 服务端返回的错误
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 请求失败: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("S3 请求失败: %s %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// IsS3NotFound 对象或存储桶不存在
+func IsS3NotFound(err error) bool {
+	var s3Err *S3Error
+	return errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound
+}
+
+// NewS3Client 创建客户端，client 为空时使用 http.DefaultClient
+func NewS3Client(cfg S3Config, client *http.Client) (*S3Client, error) {
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("无效的 S3 地址: %s", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("未设置存储桶")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("未设置访问密钥")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Client{cfg: cfg, endpoint: endpoint, client: client}, nil
+}
+
+// HeadBucket 检查存储桶是否存在且有访问权限
+func (c *S3Client) HeadBucket(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodHead, "", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PutObject 上传一个对象（适合不超过一个分片大小的数据）
+func (c *S3Client) PutObject(ctx context.Context, key string, data []byte, meta map[string]string) error {
+	resp, err := c.do(ctx, http.MethodPut, key, nil, metaHeaders(meta), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkETag(resp, data)
+}
+
+// CreateMultipartUpload 开始分片上传，返回 UploadId
+func (c *S3Client) CreateMultipartUpload(ctx context.Context, key string, meta map[string]string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, metaHeaders(meta), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", errors.New("S3 未返回 UploadId")
+	}
+	return result.UploadID, nil
+}
+
+// UploadPart 上传一个分片（分片编号从 1 开始，除最后一个外每片至少 5MB）
+func (c *S3Client) UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (S3Part, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	resp, err := c.do(ctx, http.MethodPut, key, query, nil, data)
+	if err != nil {
+		return S3Part{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkETag(resp, data); err != nil {
+		return S3Part{}, err
+	}
+	return S3Part{PartNumber: partNumber, ETag: resp.Header.Get("ETag")}, nil
+}
+
+// CompleteMultipartUpload 合并已上传的分片
+func (c *S3Client) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []S3Part) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []S3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 合并失败时服务端可能返回 200 和错误内容
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		return parseS3Error(resp.StatusCode, data)
+	}
+	return nil
+}
+
+// AbortMultipartUpload 放弃分片上传并删除已上传的分片
+func (c *S3Client) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// GetObject 下载对象，调用方负责关闭
+func (c *S3Client) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DeleteObject 删除对象（对象不存在时不报错）
+func (c *S3Client) DeleteObject(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		if IsS3NotFound(err) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListObjects 列出前缀下的所有对象（自动翻页）
+func (c *S3Client) ListObjects(ctx context.Context, prefix string) ([]S3Object, error) {
+	objects := []S3Object{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents              []S3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析对象列表失败: %w", err)
+		}
+		for _, obj := range result.Contents {
+			obj.ETag = strings.Trim(obj.ETag, `"`)
+			objects = append(objects, obj)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do 发送签名后的请求，非 2xx 响应转换为 S3Error
+func (c *S3Client) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	host := c.endpoint.Host
+	path := strings.TrimRight(c.endpoint.Path, "/")
+	if c.cfg.PathStyle {
+		path += "/" + c.cfg.Bucket
+	} else {
+		host = c.cfg.Bucket + "." + host
+	}
+	path += "/" + key
+
+	rawQuery := canonicalS3Query(query)
+	u := c.endpoint.Scheme + "://" + host + encodeS3Path(path)
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+		md5Sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]))
+	}
+	c.sign(req, host, encodeS3Path(path), rawQuery, payloadHash, time.Now().UTC())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		return nil, parseS3Error(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+// sign 按 AWS Signature V4 为请求签名
+func (c *S3Client) sign(req *http.Request, host, canonicalURI, canonicalQuery, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Host = host
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-md5" || lk == "content-type" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, canonicalURI, canonicalQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := date + "/" + c.cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), date)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// metaHeaders 自定义元数据转换为 x-amz-meta-* 请求头
+func metaHeaders(meta map[string]string) http.Header {
+	header := http.Header{}
+	for k, v := range meta {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	return header
+}
+
+// checkETag 普通上传和分片上传的 ETag 是数据的 MD5，不一致说明传输中数据被改动
+// 使用 SSE-KMS 等加密方式时 ETag 不是 MD5，此时只依赖服务端对 Content-MD5 的校验
+func checkETag(resp *http.Response, data []byte) error {
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if len(etag) != 32 {
+		return nil
+	}
+	sum := md5.Sum(data)
+	if !strings.EqualFold(etag, hex.EncodeToString(sum[:])) {
+		return fmt.Errorf("上传校验失败: ETag %s 与数据的 MD5 不一致", etag)
+	}
+	return nil
+}
+
+func parseS3Error(status int, data []byte) error {
+	s3Err := &S3Error{StatusCode: status}
+	xml.Unmarshal(data, s3Err)
+	return s3Err
+}
+
+// encodeS3Path 按 S3 的规则编码路径（保留 /，其余非保留字符全部转义）
+func encodeS3Path(p string) string {
+	return strings.ReplaceAll(encodeS3(p), "%2F", "/")
+}
+
+// canonicalS3Query 按键排序的查询字符串
+func canonicalS3Query(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, encodeS3(k)+"="+encodeS3(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// encodeS3 RFC 3986 编码（只保留 A-Z a-z 0-9 - _ . ~）
+func encodeS3(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,391 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxTmodInfoSize Info 条目的最大长度，只包含构建属性，正常不超过几 KB
+const maxTmodInfoSize = 1 << 20
+
+// TmodFile .tmod 文件的头部信息
+type TmodFile struct {
+	TModLoaderVersion string      `json:"tModLoaderVersion"`
+	Name              string      `json:"name"`
+	Version           string      `json:"version"`
+	Hash              string      `json:"hash"`      // 数据区的 SHA-1（十六进制）
+	Signed            bool        `json:"signed"`    // 是否带有浏览器签名
+	HashValid         *bool       `json:"hashValid"` // 未校验时为空
+	Files             []TmodEntry `json:"-"`
+	Info              *TmodInfo   `json:"info"`
+}
+
+// TmodEntry .tmod 内部文件条目
+type TmodEntry struct {
+	Path             string
+	Length           int
+	CompressedLength int
+	offset           int64
+}
+
+// TmodInfo .tmod 中 Info 条目（构建属性）
+type TmodInfo struct {
+	DisplayName    string          `json:"displayName"`
+	Author         string          `json:"author"`
+	Version        string          `json:"version"`
+	Homepage       string          `json:"homepage"`
+	Description    string          `json:"description"`
+	BuildVersion   string          `json:"buildVersion"`
+	Side           string          `json:"side"` // Both / Client / Server / NoSync
+	ModReferences  []TmodReference `json:"modReferences"`
+	WeakReferences []TmodReference `json:"weakReferences"`
+	DllReferences  []string        `json:"dllReferences"`
+	SortAfter      []string        `json:"sortAfter"`
+	SortBefore     []string        `json:"sortBefore"`
+}
+
+// TmodReference Mod依赖（Name@Version）
+type TmodReference struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+var tmodSides = []string{"Both", "Client", "Server", "NoSync"}
+
+// IsLegacy 是否为 tModLoader 1.3（0.x）时代构建的Mod
+func (f *TmodFile) IsLegacy() bool {
+	return CompareVersions(f.TModLoaderVersion, "1.0") < 0
+}
+
+// ReadTmodFile 读取 .tmod 文件的头部和 Info 条目
+// verifyHash 为 true 时会读取整个数据区校验 SHA-1
+func ReadTmodFile(path string, verifyHash bool) (*TmodFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadTmod(f, verifyHash)
+}
+
+// ReadTmod 从可随机访问的数据源读取 .tmod
+func ReadTmod(r io.ReadSeeker, verifyHash bool) (*TmodFile, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != "TMOD" {
+		return nil, errors.New("不是有效的 .tmod 文件")
+	}
+
+	tmod := &TmodFile{}
+	var err error
+	if tmod.TModLoaderVersion, err = readDotNetString(br); err != nil {
+		return nil, fmt.Errorf("读取tModLoader版本失败: %w", err)
+	}
+
+	hash := make([]byte, 20)
+	signature := make([]byte, 256)
+	if _, err := io.ReadFull(br, hash); err != nil {
+		return nil, fmt.Errorf("读取哈希失败: %w", err)
+	}
+	if _, err := io.ReadFull(br, signature); err != nil {
+		return nil, fmt.Errorf("读取签名失败: %w", err)
+	}
+	var dataLen int32
+	if err := binary.Read(br, binary.LittleEndian, &dataLen); err != nil {
+		return nil, fmt.Errorf("读取数据长度失败: %w", err)
+	}
+	tmod.Hash = hex.EncodeToString(hash)
+	tmod.Signed = !bytes.Equal(signature, make([]byte, 256))
+
+	dataPos := int64(4 + dotNetStringSize(tmod.TModLoaderVersion) + 20 + 256 + 4)
+
+	if verifyHash {
+		if _, err := r.Seek(dataPos, io.SeekStart); err != nil {
+			return nil, err
+		}
+		h := sha1.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return nil, err
+		}
+		valid := bytes.Equal(h.Sum(nil), hash)
+		tmod.HashValid = &valid
+		if _, err := r.Seek(dataPos, io.SeekStart); err != nil {
+			return nil, err
+		}
+		br.Reset(r)
+	}
+
+	if CompareVersions(tmod.TModLoaderVersion, "0.11") < 0 {
+		return nil, fmt.Errorf("不支持的 .tmod 格式（tModLoader %s）", tmod.TModLoaderVersion)
+	}
+
+	if tmod.IsLegacy() {
+		// 0.11 格式：数据区整体为 deflate 压缩，文件内容紧跟在条目后
+		err = readLegacyTmodData(flate.NewReader(br), tmod)
+	} else {
+		err = readTmodData(r, br, dataPos, tmod)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tmod, nil
+}
+
+// readTmodData 读取 1.4 格式的文件表和 Info 条目
+func readTmodData(r io.ReadSeeker, br *bufio.Reader, dataPos int64, tmod *TmodFile) error {
+	cr := &countingReader{r: br}
+	var err error
+	if tmod.Name, err = readDotNetString(cr); err != nil {
+		return fmt.Errorf("读取Mod名称失败: %w", err)
+	}
+	if tmod.Version, err = readDotNetString(cr); err != nil {
+		return fmt.Errorf("读取Mod版本失败: %w", err)
+	}
+
+	var count int32
+	if err := binary.Read(cr, binary.LittleEndian, &count); err != nil {
+		return fmt.Errorf("读取文件表失败: %w", err)
+	}
+	if count < 0 || count > 1<<20 {
+		return errors.New("文件表损坏")
+	}
+
+	var offset int64
+	for i := int32(0); i < count; i++ {
+		var entry TmodEntry
+		var length, compressed int32
+		if entry.Path, err = readDotNetString(cr); err != nil {
+			return fmt.Errorf("读取文件表失败: %w", err)
+		}
+		if err := binary.Read(cr, binary.LittleEndian, &length); err != nil {
+			return fmt.Errorf("读取文件表失败: %w", err)
+		}
+		if err := binary.Read(cr, binary.LittleEndian, &compressed); err != nil {
+			return fmt.Errorf("读取文件表失败: %w", err)
+		}
+		entry.Length = int(length)
+		entry.CompressedLength = int(compressed)
+		entry.offset = offset
+		offset += int64(compressed)
+		tmod.Files = append(tmod.Files, entry)
+	}
+
+	fileStart := dataPos + cr.n
+	for _, entry := range tmod.Files {
+		if entry.Path != "Info" {
+			continue
+		}
+		if entry.Length < 0 || entry.Length > maxTmodInfoSize || entry.CompressedLength < 0 {
+			return errors.New("Info 过大，文件可能已损坏")
+		}
+		if _, err := r.Seek(fileStart+entry.offset, io.SeekStart); err != nil {
+			return err
+		}
+		var src io.Reader = io.LimitReader(r, int64(entry.CompressedLength))
+		if entry.CompressedLength != entry.Length {
+			src = flate.NewReader(src)
+		}
+		content, err := io.ReadAll(io.LimitReader(src, int64(entry.Length)))
+		if err != nil {
+			return fmt.Errorf("读取Info失败: %w", err)
+		}
+		tmod.Info, err = parseTmodInfo(content)
+		return err
+	}
+	return nil
+}
+
+// readLegacyTmodData 读取 0.11 格式的数据区
+func readLegacyTmodData(r io.Reader, tmod *TmodFile) error {
+	br := bufio.NewReader(r)
+	var err error
+	if tmod.Name, err = readDotNetString(br); err != nil {
+		return fmt.Errorf("读取Mod名称失败: %w", err)
+	}
+	if tmod.Version, err = readDotNetString(br); err != nil {
+		return fmt.Errorf("读取Mod版本失败: %w", err)
+	}
+
+	var count int32
+	if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+		return fmt.Errorf("读取文件表失败: %w", err)
+	}
+	for i := int32(0); i < count; i++ {
+		path, err := readDotNetString(br)
+		if err != nil {
+			return fmt.Errorf("读取文件表失败: %w", err)
+		}
+		var length int32
+		if err := binary.Read(br, binary.LittleEndian, &length); err != nil || length < 0 {
+			return errors.New("读取文件表失败")
+		}
+		tmod.Files = append(tmod.Files, TmodEntry{Path: path, Length: int(length), CompressedLength: int(length)})
+
+		if path == "Info" {
+			if length > maxTmodInfoSize {
+				return errors.New("Info 过大，文件可能已损坏")
+			}
+			content := make([]byte, length)
+			if _, err := io.ReadFull(br, content); err != nil {
+				return fmt.Errorf("读取Info失败: %w", err)
+			}
+			tmod.Info, err = parseTmodInfo(content)
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, br, int64(length)); err != nil {
+			return fmt.Errorf("读取文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseTmodInfo 解析 Info 条目（BuildProperties 的二进制格式）
+// 遇到未知标签时停止解析并保留已读取的字段
+func parseTmodInfo(content []byte) (*TmodInfo, error) {
+	info := &TmodInfo{Side: tmodSides[0]}
+	r := bytes.NewReader(content)
+
+	readList := func() ([]string, error) {
+		var items []string
+		for {
+			item, err := readDotNetString(r)
+			if err != nil || item == "" {
+				return items, err
+			}
+			items = append(items, item)
+		}
+	}
+
+	for {
+		tag, err := readDotNetString(r)
+		if err != nil {
+			if err == io.EOF {
+				return info, nil
+			}
+			return info, fmt.Errorf("Info格式错误: %w", err)
+		}
+
+		switch tag {
+		case "":
+			return info, nil
+		case "dllReferences":
+			info.DllReferences, err = readList()
+		case "modReferences":
+			var refs []string
+			refs, err = readList()
+			info.ModReferences = parseTmodReferences(refs)
+		case "weakReferences":
+			var refs []string
+			refs, err = readList()
+			info.WeakReferences = parseTmodReferences(refs)
+		case "sortAfter":
+			info.SortAfter, err = readList()
+		case "sortBefore":
+			info.SortBefore, err = readList()
+		case "author":
+			info.Author, err = readDotNetString(r)
+		case "version":
+			info.Version, err = readDotNetString(r)
+		case "displayName":
+			info.DisplayName, err = readDotNetString(r)
+		case "homepage":
+			info.Homepage, err = readDotNetString(r)
+		case "description":
+			info.Description, err = readDotNetString(r)
+		case "buildVersion":
+			info.BuildVersion, err = readDotNetString(r)
+		case "eacPath":
+			_, err = readDotNetString(r)
+		case "side":
+			var side byte
+			side, err = r.ReadByte()
+			if int(side) < len(tmodSides) {
+				info.Side = tmodSides[side]
+			}
+		case "languageVersion":
+			var v int32
+			err = binary.Read(r, binary.LittleEndian, &v)
+		case "noCompile", "!hideCode", "!hideResources", "hideCode", "hideResources",
+			"includeSource", "includePDB", "editAndContinue", "beta", "!playableOnPreview", "translationMod":
+			// 无附加数据的标记
+		default:
+			return info, nil
+		}
+		if err != nil {
+			return info, fmt.Errorf("Info格式错误: %w", err)
+		}
+	}
+}
+
+// parseTmodReferences 解析 "Name@Version" 形式的引用
+func parseTmodReferences(items []string) []TmodReference {
+	refs := []TmodReference{}
+	for _, item := range items {
+		name, version, _ := strings.Cut(item, "@")
+		refs = append(refs, TmodReference{Name: name, Version: version})
+	}
+	return refs
+}
+
+// readDotNetString 读取 .NET BinaryWriter 写入的字符串（7位变长长度前缀 + UTF-8）
+func readDotNetString(r io.Reader) (string, error) {
+	var length, shift int
+	buf := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		length |= int(buf[0]&0x7f) << shift
+		if buf[0]&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 28 {
+			return "", errors.New("字符串长度格式错误")
+		}
+	}
+	if length > 1<<20 {
+		return "", errors.New("字符串过长")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// dotNetStringSize 计算 .NET 字符串写入后占用的字节数
+func dotNetStringSize(s string) int {
+	n := len(s)
+	size := 1
+	for n >= 0x80 {
+		n >>= 7
+		size++
+	}
+	return size + len(s)
+}
+
+// countingReader 统计已读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions 比较两个点分版本号（如 5.2.0 与 4.5.20）
+// 返回 -1 表示 a < b，0 表示相等，1 表示 a > b；非数字段按字符串比较
+func CompareVersions(a, b string) int {
+	pa := splitVersion(a)
+	pb := splitVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var sa, sb string
+		if i < len(pa) {
+			sa = pa[i]
+		}
+		if i < len(pb) {
+			sb = pb[i]
+		}
+		if c := compareVersionPart(sa, sb); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// MatchVersionPrefix 判断版本是否匹配前缀模式
+// 模式 "5" 匹配 5.x.x，"4.5" 或 "4.5.x" 匹配 4.5.x，"*" 匹配任意版本
+func MatchVersionPrefix(pattern, version string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	pp := splitVersion(pattern)
+	pv := splitVersion(version)
+	for i, part := range pp {
+		if part == "x" || part == "*" {
+			return true
+		}
+		if i >= len(pv) || compareVersionPart(part, pv[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitVersion 拆分版本号，忽略前缀 v 和构建元数据
+func splitVersion(v string) []string {
+	v = strings.TrimSpace(v)
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "v"), "V")
+	if i := strings.IndexAny(v, "+ "); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil
+	}
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+}
+
+// compareVersionPart 比较单个版本段，缺失段视为 0
+func compareVersionPart(a, b string) int {
+	if a == "" {
+		a = "0"
+	}
+	if b == "" {
+		b = "0"
+	}
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		if na < nb {
+			return -1
+		}
+		if na > nb {
+			return 1
+		}
+		return 0
+	case errA == nil:
+		// 纯数字段大于预发布标记（5.2.0 > 5.2.0-beta）
+		return 1
+	case errB == nil:
+		return -1
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// SatisfiesVersion 判断版本是否满足约束
+// 支持 ">=1.2.0"、">1.0"、"<=2"、"<2.0"、"=1.5.2"、"!=1.3" 以及前缀形式 "1.2.x"，
+// 多个条件用逗号或空格分隔表示同时满足，约束为空时总是满足
+func SatisfiesVersion(version, constraint string) bool {
+	for _, cond := range constraintConditions(constraint) {
+		op, target := splitConstraint(cond)
+		c := CompareVersions(version, target)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = c >= 0
+		case "<=":
+			ok = c <= 0
+		case ">":
+			ok = c > 0
+		case "<":
+			ok = c < 0
+		case "!=":
+			ok = c != 0
+		case "=", "==":
+			ok = c == 0
+		default:
+			ok = MatchVersionPrefix(target, version)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitConstraint 拆分约束中的比较符与版本号
+func splitConstraint(cond string) (string, string) {
+	for _, op := range []string{">=", "<=", "!=", "==", ">", "<", "="} {
+		if strings.HasPrefix(cond, op) {
+			return op, strings.TrimSpace(cond[len(op):])
+		}
+	}
+	return "", cond
+}
+
+// constraintConditions 将约束拆分为单个条件，兼容 ">= 1.2.0" 这种带空格的写法
+func constraintConditions(constraint string) []string {
+	var conds []string
+	pending := ""
+	for _, token := range strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		if strings.Trim(token, "<>=!") == "" {
+			pending += token
+			continue
+		}
+		conds = append(conds, pending+token)
+		pending = ""
+	}
+	return conds
+}
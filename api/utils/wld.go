@@ -0,0 +1,467 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"terraria-api/app/model"
+	"time"
+)
+
+// 支持解析的世界文件版本范围（1.3 起的世界带有 relogic 文件头，279 为 1.4.4.9）
+const (
+	minWorldRelease = 135
+	maxWorldRelease = 279
+)
+
+// ErrNotWorldFile 文件不是 Terraria 世界文件
+var ErrNotWorldFile = errors.New("不是有效的世界文件")
+
+// WorldBosses 世界文件中记录的Boss（按游戏进度排列）
+var WorldBosses = []string{
+	"kingSlime", "eyeOfCthulhu", "eaterOfWorlds", "brainOfCthulhu", "queenBee", "skeletron", "deerclops", "wallOfFlesh",
+	"queenSlime", "destroyer", "twins", "skeletronPrime", "plantera", "golem", "dukeFishron", "empressOfLight",
+	"lunaticCultist", "solarPillar", "vortexPillar", "nebulaPillar", "stardustPillar", "moonLord",
+	"mourningWood", "pumpking", "everscream", "santaNK1", "iceQueen",
+}
+
+// WorldInvasions 世界文件中记录的入侵事件（按游戏进度排列）
+var WorldInvasions = []string{"goblinArmy", "frostLegion", "pirateInvasion", "oldOnesArmyT1", "oldOnesArmyT2", "oldOnesArmyT3", "martianMadness"}
+
+// 世界宽度与尺寸的对应关系
+var worldSizes = map[int32]string{4200: "1", 6400: "2", 8400: "3"}
+
+// ReadWorldFile 读取 .wld 文件的头部信息
+func ReadWorldFile(path string) (*model.WorldInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadWorld(f)
+}
+
+// ReadWorld 从可随机访问的数据源读取世界文件头部
+// 高于已知版本的世界会返回世界名称和错误，损坏的文件只返回错误
+func ReadWorld(r io.ReadSeeker) (*model.WorldInfo, error) {
+	format, err := readWorldFormat(r)
+	if err != nil {
+		return nil, err
+	}
+	start, end := int64(format.sections[0]), int64(format.sections[1])
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// 头部段之外的内容不会被读取，越界说明文件损坏或格式不符
+	info := &model.WorldInfo{Release: format.release, Revision: format.revision, SpecialSeeds: []string{}, DownedBosses: []string{}, Invasions: []string{}}
+	wr := &worldReader{r: bufio.NewReader(io.LimitReader(r, end-start))}
+	info.Name = wr.str()
+	if format.release > maxWorldRelease {
+		if wr.err != nil {
+			return nil, errors.New("世界头部损坏")
+		}
+		return info, fmt.Errorf("不支持的世界版本 %d（高于已知的 %d），只读取了世界名称", format.release, maxWorldRelease)
+	}
+	if err := readWorldHeader(wr, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// worldFormat 世界文件的文件头
+type worldFormat struct {
+	release   int32
+	revision  uint32
+	sections  []int32 // 各数据段的起始位置：头部、图格、箱子、标牌……
+	important []bool  // 需要保存帧坐标的图格类型
+	size      int64
+}
+
+// readWorldFormat 读取并校验文件头和段表
+func readWorldFormat(r io.ReadSeeker) (*worldFormat, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	format := &worldFormat{size: size}
+	if err := binary.Read(br, binary.LittleEndian, &format.release); err != nil {
+		return nil, ErrNotWorldFile
+	}
+	if format.release < minWorldRelease || format.release > 10000 {
+		if format.release > 0 && format.release < minWorldRelease {
+			return nil, fmt.Errorf("不支持的世界版本 %d（1.3 之前的世界）", format.release)
+		}
+		return nil, ErrNotWorldFile
+	}
+
+	// 文件头：relogic 标识 + 文件类型（2=世界）、修订号、收藏标记
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic[:7]) != "relogic" {
+		return nil, ErrNotWorldFile
+	}
+	if magic[7] != 2 {
+		return nil, fmt.Errorf("%w（文件类型 %d）", ErrNotWorldFile, magic[7])
+	}
+	if err := binary.Read(br, binary.LittleEndian, &format.revision); err != nil {
+		return nil, errors.New("世界文件头损坏")
+	}
+	if _, err := br.Discard(8); err != nil {
+		return nil, errors.New("世界文件头损坏")
+	}
+
+	// 各数据段的起始位置，第一段为世界头部
+	var sectionCount int16
+	if err := binary.Read(br, binary.LittleEndian, &sectionCount); err != nil || sectionCount < 2 || sectionCount > 64 {
+		return nil, errors.New("世界文件段表损坏")
+	}
+	format.sections = make([]int32, sectionCount)
+	if err := binary.Read(br, binary.LittleEndian, format.sections); err != nil {
+		return nil, errors.New("世界文件段表损坏")
+	}
+	for i, offset := range format.sections {
+		if offset <= 0 || int64(offset) > size || (i > 0 && offset < format.sections[i-1]) {
+			return nil, errors.New("世界文件段表损坏")
+		}
+	}
+	if format.sections[1] <= format.sections[0] {
+		return nil, errors.New("世界文件段表损坏")
+	}
+
+	// 图格帧标记：数量 + 按位存储的布尔数组
+	var tileCount int16
+	if err := binary.Read(br, binary.LittleEndian, &tileCount); err != nil || tileCount <= 0 {
+		return nil, errors.New("世界文件头损坏")
+	}
+	bits := make([]byte, (int(tileCount)+7)/8)
+	if _, err := io.ReadFull(br, bits); err != nil {
+		return nil, errors.New("世界文件头损坏")
+	}
+	format.important = make([]bool, tileCount)
+	for i := range format.important {
+		format.important[i] = bits[i/8]&(1<<(i%8)) != 0
+	}
+	return format, nil
+}
+
+// readWorldHeader 按 Terraria 的 WorldFile.LoadHeader 顺序读取头部段
+func readWorldHeader(wr *worldReader, info *model.WorldInfo) error {
+	release := info.Release
+	if release >= 179 {
+		if release == 179 {
+			info.Seed = strconv.Itoa(int(wr.i32()))
+		} else {
+			info.Seed = wr.str()
+		}
+		wr.skip(8) // 世界生成器版本
+	}
+	if release >= 181 {
+		info.UniqueID = formatGUID(wr.bytes(16))
+	}
+	wr.skip(4 + 16) // 世界ID、左右上下边界
+	info.Height = wr.i32()
+	info.Width = wr.i32()
+	info.Size = worldSizes[info.Width]
+
+	if release >= 209 {
+		gameMode := wr.i32()
+		if gameMode >= 0 && gameMode <= 3 {
+			info.Difficulty = strconv.Itoa(int(gameMode))
+		}
+		for _, seed := range []struct {
+			release int32
+			name    string
+		}{
+			{222, "drunk"}, {227, "getGoodWorld"}, {238, "tenthAnniversary"}, {239, "dontStarve"},
+			{241, "notTheBees"}, {249, "remix"}, {266, "noTraps"}, {267, "zenith"},
+		} {
+			if release >= seed.release && wr.bool() {
+				info.SpecialSeeds = append(info.SpecialSeeds, seed.name)
+			}
+		}
+	} else {
+		info.Difficulty = "0"
+		if release >= 112 && wr.bool() {
+			info.Difficulty = "1"
+		}
+		if release >= 208 && wr.bool() {
+			info.Difficulty = "2"
+		}
+	}
+
+	if release >= 141 {
+		info.CreatedAt = dotNetDateTime(wr.i64())
+	}
+	// 游玩时长只记录在角色文件（.plr）中，世界文件的头部没有这一项，PlayTime 保持为空
+	wr.skip(1)                       // 月亮样式
+	wr.skip(4 * (3 + 4 + 3 + 4 + 3)) // 树木、洞穴背景的位置和样式，冰雪/丛林/地狱背景
+	info.SpawnX = wr.i32()
+	info.SpawnY = wr.i32()
+	info.SurfaceLevel = wr.f64()
+	info.RockLevel = wr.f64()
+	info.Time = wr.f64()
+	info.DayTime = wr.bool()
+	wr.skip(4 + 1 + 1) // 月相、血月、日食
+	wr.skip(4 + 4)     // 地牢位置
+	crimson := wr.bool()
+	info.Evil = "corruption"
+	if crimson {
+		info.Evil = "crimson"
+	}
+
+	downed := map[string]bool{}
+	evilBoss := "eaterOfWorlds"
+	if crimson {
+		evilBoss = "brainOfCthulhu"
+	}
+	for _, boss := range []string{"eyeOfCthulhu", evilBoss, "skeletron", "queenBee", "destroyer", "twins", "skeletronPrime", "", "plantera", "golem"} {
+		if wr.bool() && boss != "" {
+			downed[boss] = true
+		}
+	}
+	if release >= 118 {
+		downed["kingSlime"] = wr.bool()
+	}
+	wr.skip(3) // 解救的NPC
+	invasions := map[string]bool{}
+	for _, invasion := range []string{"goblinArmy", "", "frostLegion", "pirateInvasion"} {
+		if wr.bool() && invasion != "" {
+			invasions[invasion] = true
+		}
+	}
+	wr.skip(1 + 1 + 1) // 暗影珠、陨石、暗影珠计数
+	wr.skip(4)         // 祭坛计数
+	info.Hardmode = wr.bool()
+	downed["wallOfFlesh"] = info.Hardmode
+	if release >= 257 {
+		wr.skip(1) // 派对之后
+	}
+
+	wr.skip(4 + 4 + 4 + 8) // 入侵
+	if release >= 118 {
+		wr.skip(8) // 史莱姆雨
+	}
+	if release >= 113 {
+		wr.skip(1) // 日晷冷却
+	}
+	wr.skip(1 + 4 + 4)     // 下雨
+	wr.skip(4 * 3)         // 困难模式矿石
+	wr.skip(8 + 4 + 2 + 4) // 背景样式、云层、风速
+
+	if release >= 95 {
+		for i, n := int32(0), wr.count(); i < n; i++ {
+			wr.str() // 今日完成渔夫任务的玩家
+		}
+	}
+	if release >= 99 {
+		wr.skip(1)
+	}
+	if release >= 101 {
+		wr.skip(4)
+	}
+	if release >= 104 {
+		wr.skip(1)
+	}
+	if release >= 129 {
+		wr.skip(1)
+	}
+	if release >= 201 {
+		wr.skip(1)
+	}
+	if release >= 107 {
+		wr.skip(4)
+	}
+	if release >= 108 {
+		wr.skip(4)
+	}
+	if release >= 109 {
+		wr.skip(4 * int(wr.i16())) // 击杀计数
+	}
+	if release >= 128 {
+		wr.skip(1)
+	}
+	if release >= 131 {
+		downed["dukeFishron"] = wr.bool()
+		invasions["martianMadness"] = wr.bool()
+		for _, boss := range []string{"lunaticCultist", "moonLord", "pumpking", "mourningWood", "iceQueen", "santaNK1", "everscream"} {
+			downed[boss] = wr.bool()
+		}
+	}
+	if release >= 140 {
+		for _, boss := range []string{"solarPillar", "vortexPillar", "nebulaPillar", "stardustPillar"} {
+			downed[boss] = wr.bool()
+		}
+		wr.skip(5) // 天界柱存活状态、月亮事件
+	}
+	if release >= 170 {
+		wr.skip(1 + 1 + 4)
+		wr.skip(4 * int(wr.count())) // 派对
+	}
+	if release >= 174 {
+		wr.skip(1 + 4 + 4 + 4) // 沙尘暴
+	}
+	if release >= 178 {
+		wr.skip(1)
+		for _, invasion := range []string{"oldOnesArmyT1", "oldOnesArmyT2", "oldOnesArmyT3"} {
+			invasions[invasion] = wr.bool()
+		}
+	}
+	if release >= 195 {
+		wr.skip(1) // 蘑菇背景
+	}
+	if release >= 215 {
+		wr.skip(1) // 地狱背景
+	}
+	if release >= 195 {
+		wr.skip(3) // 森林背景
+	}
+	if release >= 204 {
+		wr.skip(1)
+	}
+	if release >= 207 {
+		wr.skip(4 + 1 + 1 + 1) // 灯笼夜
+	}
+	if release >= 211 {
+		wr.skip(4 * int(wr.count())) // 树顶样式
+	}
+	if release >= 212 {
+		wr.skip(2)
+	}
+	if release >= 216 {
+		wr.skip(4 * 4) // 矿石
+	}
+	if release >= 217 {
+		wr.skip(3)
+	}
+	if release >= 223 {
+		downed["empressOfLight"] = wr.bool()
+		downed["queenSlime"] = wr.bool()
+	}
+	if release >= 240 {
+		downed["deerclops"] = wr.bool()
+	}
+	if wr.err != nil {
+		return errors.New("世界头部损坏或格式不符")
+	}
+
+	for _, boss := range WorldBosses {
+		if downed[boss] {
+			info.DownedBosses = append(info.DownedBosses, boss)
+		}
+	}
+	for _, invasion := range WorldInvasions {
+		if invasions[invasion] {
+			info.Invasions = append(info.Invasions, invasion)
+		}
+	}
+	return nil
+}
+
+// worldReader 顺序读取 .NET BinaryWriter 写入的数据，出错后后续读取都返回零值
+type worldReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (w *worldReader) bytes(n int) []byte {
+	buf := make([]byte, n)
+	if w.err == nil {
+		_, w.err = io.ReadFull(w.r, buf)
+	}
+	return buf
+}
+
+func (w *worldReader) skip(n int) {
+	if w.err == nil && n > 0 {
+		_, w.err = w.r.Discard(n)
+	} else if n < 0 {
+		w.err = errors.New("长度错误")
+	}
+}
+
+func (w *worldReader) bool() bool {
+	return w.bytes(1)[0] != 0
+}
+
+func (w *worldReader) i16() int16 {
+	return int16(binary.LittleEndian.Uint16(w.bytes(2)))
+}
+
+func (w *worldReader) i32() int32 {
+	return int32(binary.LittleEndian.Uint32(w.bytes(4)))
+}
+
+func (w *worldReader) i64() int64 {
+	return int64(binary.LittleEndian.Uint64(w.bytes(8)))
+}
+
+func (w *worldReader) f64() float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(w.bytes(8)))
+}
+
+// count 读取列表长度，超出合理范围视为损坏
+func (w *worldReader) count() int32 {
+	n := w.i32()
+	if n < 0 || n > 1<<16 {
+		if w.err == nil {
+			w.err = errors.New("列表长度错误")
+		}
+		return 0
+	}
+	return n
+}
+
+func (w *worldReader) str() string {
+	if w.err != nil {
+		return ""
+	}
+	var s string
+	s, w.err = readDotNetString(w.r)
+	return s
+}
+
+// dotNetDateTime 转换 DateTime.ToBinary 的结果，0 表示未记录
+func dotNetDateTime(v int64) *time.Time {
+	const (
+		ticksMask    = 0x3FFFFFFFFFFFFFFF
+		ticksCeiling = 0x4000000000000000
+		maxTicks     = 3155378975999999999
+		unixEpoch    = 621355968000000000 // 0001-01-01 到 1970-01-01 的刻数
+	)
+	if v == 0 {
+		return nil
+	}
+	ticks := v & ticksMask
+	// 本地时间在序列化时已经转换为 UTC 刻数，负数会回绕
+	if v < 0 && ticks > maxTicks {
+		ticks -= ticksCeiling
+	}
+	if ticks <= 0 || ticks > maxTicks {
+		return nil
+	}
+	ticks -= unixEpoch
+	t := time.Unix(ticks/1e7, ticks%1e7*100).UTC()
+	return &t
+}
+
+// formatGUID 按 .NET Guid 的字节序格式化
+func formatGUID(b []byte) string {
+	if len(b) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%08x-%04x-%04x-%s-%s",
+		binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]),
+		hex.EncodeToString(b[8:10]), hex.EncodeToString(b[10:16]))
+}
@@ -0,0 +1,340 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"terraria-api/app/model"
+)
+
+// WorldMapPalette 世界地图配色
+type WorldMapPalette struct {
+	Tiles map[int]color.RGBA // 按图格类型
+	Walls map[int]color.RGBA // 按墙壁类型
+	Tile  color.RGBA         // 未配置的图格
+	Wall  color.RGBA         // 未配置的墙壁
+
+	Water   color.RGBA
+	Lava    color.RGBA
+	Honey   color.RGBA
+	Shimmer color.RGBA
+
+	// 空白处按深度使用的背景色
+	Sky         color.RGBA
+	Underground color.RGBA
+	Cavern      color.RGBA
+	Underworld  color.RGBA
+}
+
+// 默认配色中的图格（参考游戏内地图颜色）
+var defaultTileColors = map[int]uint32{
+	0: 0x976B4B, 1: 0x808080, 2: 0x1CD85E, 3: 0x1BC56D, 4: 0xFDDD03, 5: 0x976B4B, 6: 0x8C6550, 7: 0x964316,
+	8: 0xB9A417, 9: 0xB9C2C3, 10: 0x772F1C, 11: 0x772F1C, 12: 0xAE1845, 19: 0xBF8F6F, 21: 0xAF8B4A, 22: 0x625FA7,
+	23: 0x8D89DF, 24: 0x7A74DA, 25: 0x6D5A80, 27: 0xE6B421, 28: 0x97515A, 30: 0xAA7854, 32: 0x6E5F95, 37: 0x685654,
+	38: 0x8C8C8C, 40: 0x925144, 41: 0x4A5181, 43: 0x406441, 44: 0x80405F, 45: 0xB9A417, 48: 0xAEADAE, 51: 0xC0CACB,
+	52: 0x17B14C, 53: 0xD3C66F, 56: 0x3A2A57, 57: 0x444444, 58: 0x8E4242, 59: 0x5C4449, 60: 0x8FD71D, 61: 0x87C41F,
+	62: 0x79B018, 63: 0x6E8CB6, 64: 0xC4607B, 65: 0x36C380, 66: 0xB69C35, 67: 0x975BB4, 68: 0xA3B5B9, 69: 0x4C7A25,
+	70: 0x5D7FFF, 71: 0x9CA7FF, 72: 0x6F70B9, 75: 0x3D3B52, 76: 0x8E3030, 80: 0x497811, 107: 0x0B508F, 108: 0x5BA9A9,
+	109: 0x4EC1E3, 111: 0x801A34, 112: 0x67627A, 116: 0xD5C4C5, 117: 0xB5ACBE, 123: 0x6A6B76, 147: 0xD3ECF1,
+	161: 0x90C3E8, 163: 0x9A84E3, 164: 0xDA8ADB, 166: 0x817D5D, 167: 0x3E524B, 168: 0x8EA990, 169: 0xB6C2C5,
+	189: 0xDFFFFF, 199: 0xD05050, 200: 0xD88E8E, 203: 0x8D3838, 204: 0xB32D2D, 211: 0x79D920, 221: 0xEF5A32,
+	222: 0xD260A3, 223: 0xA0ACB1, 225: 0xE3B903, 226: 0x8D3800, 229: 0xFFC23F, 232: 0xA0614B, 234: 0x352C29,
+	367: 0xA8B2CC, 368: 0x1A1A3C, 396: 0xBE9B5A, 397: 0x948056, 404: 0xC0A070,
+}
+
+// 默认配色中的墙壁
+var defaultWallColors = map[int]uint32{
+	1: 0x343434, 2: 0x583D2E, 3: 0x3D3A4E, 4: 0x583D2E, 5: 0x3A3A3A, 7: 0x1A2E51, 8: 0x1A4B4B, 9: 0x4B1A3A,
+	15: 0x331A1A, 16: 0x583D2E, 27: 0x583D2E, 28: 0x583D2E, 34: 0x232323, 40: 0x575D73, 59: 0x2D2D18,
+	62: 0x2B2B11, 63: 0x1E3A18, 64: 0x27421E, 65: 0x1F3D15, 66: 0x5A5A1B, 68: 0x28341B, 69: 0x5B3B5B,
+	70: 0x2A4D66, 71: 0x4A4A62, 80: 0x2B4761, 81: 0x3E2D2D, 83: 0x4B1617, 86: 0x583D2E, 87: 0x514B1C,
+	187: 0x84705C, 216: 0x6E5A3A,
+}
+
+// DefaultWorldMapPalette 默认的世界地图配色
+func DefaultWorldMapPalette() *WorldMapPalette {
+	palette := &WorldMapPalette{
+		Tiles:       make(map[int]color.RGBA, len(defaultTileColors)),
+		Walls:       make(map[int]color.RGBA, len(defaultWallColors)),
+		Tile:        rgb(0x9A7A5A),
+		Wall:        rgb(0x3E3024),
+		Water:       rgb(0x093DBF),
+		Lava:        rgb(0xFD2003),
+		Honey:       rgb(0xFEC214),
+		Shimmer:     rgb(0xC8A0FF),
+		Sky:         rgb(0x84AAF8),
+		Underground: rgb(0x583D2E),
+		Cavern:      rgb(0x4A433C),
+		Underworld:  rgb(0x330000),
+	}
+	for t, c := range defaultTileColors {
+		palette.Tiles[t] = rgb(c)
+	}
+	for w, c := range defaultWallColors {
+		palette.Walls[w] = rgb(c)
+	}
+	return palette
+}
+
+func rgb(c uint32) color.RGBA {
+	return color.RGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 0xFF}
+}
+
+// WorldMapScale 地图宽度不超过 maxWidth 时每像素对应的图格数
+func WorldMapScale(worldWidth int32, maxWidth int) int {
+	if maxWidth <= 0 || worldWidth <= 0 {
+		return 1
+	}
+	return (int(worldWidth) + maxWidth - 1) / maxWidth
+}
+
+// RenderWorldMap 解码世界的图格、墙壁和液体，每 scale×scale 个图格取平均颜色绘制为一个像素
+// progress 按列回报进度（0~1），可以为空
+func RenderWorldMap(ctx context.Context, path string, palette *WorldMapPalette, scale int, progress func(float64)) (*image.RGBA, *model.WorldInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := ReadWorld(f)
+	if err != nil {
+		return nil, info, err
+	}
+	format, err := readWorldFormat(f)
+	if err != nil {
+		return nil, info, err
+	}
+	if len(format.sections) < 3 {
+		return nil, info, errors.New("世界文件缺少图格数据")
+	}
+	width, height := int(info.Width), int(info.Height)
+	if width <= 0 || height <= 0 || width > 1<<14 || height > 1<<14 {
+		return nil, info, errors.New("世界尺寸异常")
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	if palette == nil {
+		palette = DefaultWorldMapPalette()
+	}
+
+	start, end := int64(format.sections[1]), int64(format.sections[2])
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, info, err
+	}
+	tr := &tileReader{r: bufio.NewReaderSize(io.LimitReader(f, end-start), 1<<16), important: format.important}
+
+	// 背景的深度分界：地表、岩石层和地狱（底部 200 格）
+	surface, rock, underworld := int(info.SurfaceLevel), int(info.RockLevel), height-200
+	background := func(y int) color.RGBA {
+		switch {
+		case y < surface:
+			return palette.Sky
+		case y < rock:
+			return palette.Underground
+		case y < underworld:
+			return palette.Cavern
+		default:
+			return palette.Underworld
+		}
+	}
+
+	outW, outH := (width+scale-1)/scale, (height+scale-1)/scale
+	sums := make([]uint32, outW*outH*3)
+	counts := make([]uint16, outW*outH)
+	for x := 0; x < width; x++ {
+		if x%64 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, info, err
+			}
+			if progress != nil {
+				progress(float64(x) / float64(width))
+			}
+		}
+		for y := 0; y < height; {
+			tile, run := tr.next()
+			if tr.err != nil {
+				return nil, info, errors.New("世界图格数据损坏")
+			}
+			if y+run > height {
+				return nil, info, errors.New("世界图格数据损坏")
+			}
+
+			var c color.RGBA
+			switch {
+			case tile.active:
+				c = palette.tile(tile.kind)
+			case tile.liquid > 0:
+				c = palette.liquid(tile.liquidKind)
+			case tile.wall > 0:
+				c = palette.wall(tile.wall)
+			}
+			for end := y + run; y < end; y++ {
+				pc := c
+				if pc.A == 0 {
+					pc = background(y)
+				}
+				i := y/scale*outW + x/scale
+				sums[i*3] += uint32(pc.R)
+				sums[i*3+1] += uint32(pc.G)
+				sums[i*3+2] += uint32(pc.B)
+				counts[i]++
+			}
+		}
+	}
+	if progress != nil {
+		progress(1)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		img.Pix[i*4] = uint8(sums[i*3] / uint32(n))
+		img.Pix[i*4+1] = uint8(sums[i*3+1] / uint32(n))
+		img.Pix[i*4+2] = uint8(sums[i*3+2] / uint32(n))
+		img.Pix[i*4+3] = 0xFF
+	}
+	return img, info, nil
+}
+
+func (p *WorldMapPalette) tile(kind int) color.RGBA {
+	if c, ok := p.Tiles[kind]; ok {
+		return c
+	}
+	return p.Tile
+}
+
+func (p *WorldMapPalette) wall(kind int) color.RGBA {
+	if c, ok := p.Walls[kind]; ok {
+		return c
+	}
+	return p.Wall
+}
+
+func (p *WorldMapPalette) liquid(kind int) color.RGBA {
+	switch kind {
+	case liquidLava:
+		return p.Lava
+	case liquidHoney:
+		return p.Honey
+	case liquidShimmer:
+		return p.Shimmer
+	default:
+		return p.Water
+	}
+}
+
+// 液体类型
+const (
+	liquidWater = iota
+	liquidLava
+	liquidHoney
+	liquidShimmer
+)
+
+// mapTile 绘制地图需要的图格字段
+type mapTile struct {
+	active     bool
+	kind       int
+	wall       int
+	liquid     byte
+	liquidKind int
+}
+
+// tileReader 按 WorldFile.LoadWorldTiles 的格式读取图格，相同图格以游程编码
+type tileReader struct {
+	r         *bufio.Reader
+	important []bool
+	err       error
+}
+
+func (t *tileReader) byte() byte {
+	if t.err != nil {
+		return 0
+	}
+	b, err := t.r.ReadByte()
+	if err != nil {
+		t.err = err
+	}
+	return b
+}
+
+func (t *tileReader) skip(n int) {
+	if t.err == nil {
+		_, t.err = t.r.Discard(n)
+	}
+}
+
+// next 读取一个图格及其重复次数（含自身）
+func (t *tileReader) next() (mapTile, int) {
+	var tile mapTile
+	var header2, header3 byte
+	header1 := t.byte()
+	if header1&1 != 0 {
+		header2 = t.byte()
+		if header2&1 != 0 {
+			header3 = t.byte()
+			if header3&1 != 0 {
+				t.byte() // 1.4.4 的涂层标记
+			}
+		}
+	}
+
+	if header1&2 != 0 {
+		tile.active = true
+		if header1&0x20 != 0 {
+			tile.kind = int(binary.LittleEndian.Uint16([]byte{t.byte(), t.byte()}))
+		} else {
+			tile.kind = int(t.byte())
+		}
+		if tile.kind >= len(t.important) {
+			if t.err == nil {
+				t.err = errors.New("图格类型超出范围")
+			}
+			return tile, 1
+		}
+		if t.important[tile.kind] {
+			t.skip(4) // 帧坐标
+		}
+		if header3&0x08 != 0 {
+			t.skip(1) // 图格油漆
+		}
+	}
+	if header1&4 != 0 {
+		tile.wall = int(t.byte())
+		if header3&0x10 != 0 {
+			t.skip(1) // 墙壁油漆
+		}
+	}
+	if liquidBits := (header1 & 0x18) >> 3; liquidBits != 0 {
+		tile.liquid = t.byte()
+		switch {
+		case header3&0x80 != 0:
+			tile.liquidKind = liquidShimmer
+		case liquidBits == 2:
+			tile.liquidKind = liquidLava
+		case liquidBits == 3:
+			tile.liquidKind = liquidHoney
+		}
+	}
+	if header3&0x40 != 0 {
+		tile.wall |= int(t.byte()) << 8 // 墙壁类型高位
+	}
+
+	run := 1
+	switch (header1 & 0xC0) >> 6 {
+	case 1:
+		run += int(t.byte())
+	case 2:
+		run += int(binary.LittleEndian.Uint16([]byte{t.byte(), t.byte()}))
+	}
+	return tile, run
+}